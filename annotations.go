@@ -0,0 +1,113 @@
+package egcl
+
+import (
+	"sync"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const (
+	EGCLvalid              = EGCLUriExpansion + "valid"
+	EGCLvalidatedAt        = EGCLUriExpansion + "validatedAt"
+	EGCLschema             = EGCLUriExpansion + "schema"
+	EGCLschemaVersion      = EGCLUriExpansion + "schemaVersion"
+	EGCLviolatedConstraint = EGCLUriExpansion + "violatedConstraint"
+	EGCLviolationCount     = EGCLUriExpansion + "violationCount"
+)
+
+// ValidationAnnotator is a ValidationObserver that records the validation status of each entity validated through
+// ValidateEntity, ValidateEntityCollection or ValidateDataset. Each annotation has the id of the entity it describes
+// and only egcl: properties, so when it is stored in a companion dataset the datahub merges it into the entity as a
+// partial and downstream jobs can filter on egcl:valid.
+type ValidationAnnotator struct {
+	lock        sync.Mutex
+	annotations []*egdm.Entity
+	positions   map[string]int
+}
+
+func NewValidationAnnotator() *ValidationAnnotator {
+	return &ValidationAnnotator{annotations: make([]*egdm.Entity, 0), positions: make(map[string]int)}
+}
+
+func (a *ValidationAnnotator) ObserveInstance(schema *Schema, class string, entity *egdm.Entity) {}
+
+func (a *ValidationAnnotator) ObserveCheck(schema *Schema, class string, constraint ConstraintType, entity *egdm.Entity, valid bool, violation *ConstraintViolation) {
+}
+
+// ObserveEntity records the annotation of the entity, replacing an earlier one for the same entity
+func (a *ValidationAnnotator) ObserveEntity(schema *Schema, entity *egdm.Entity, ok bool, violations []*ConstraintViolation) {
+	annotation := newValidationAnnotation(schema, entity, ok, violations, time.Now().UTC())
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if position, found := a.positions[entity.ID]; found {
+		a.annotations[position] = annotation
+		return
+	}
+	a.positions[entity.ID] = len(a.annotations)
+	a.annotations = append(a.annotations, annotation)
+}
+
+// Annotations returns the annotations recorded so far in the order the entities were first validated
+func (a *ValidationAnnotator) Annotations() []*egdm.Entity {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return append(make([]*egdm.Entity, 0, len(a.annotations)), a.annotations...)
+}
+
+// Store writes the recorded annotations to the dataset and forgets them, so that it can be called after each batch.
+// The dataset is created first when the store can create datasets, like *datahub.Client.
+func (a *ValidationAnnotator) Store(store EntityStore, dataset string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.annotations) == 0 {
+		return nil
+	}
+
+	if creator, ok := store.(interface {
+		AddDataset(name string, namespaces []string) error
+	}); ok {
+		if err := creator.AddDataset(dataset, nil); err != nil {
+			return errors.Wrapf(err, "creating dataset %s", dataset)
+		}
+	}
+
+	annotations, err := compactAnnotatedEntities(a.annotations)
+	if err != nil {
+		return err
+	}
+	if err := store.StoreEntities(dataset, annotations); err != nil {
+		return errors.Wrapf(err, "storing %d annotations", len(a.annotations))
+	}
+
+	a.annotations = make([]*egdm.Entity, 0)
+	a.positions = make(map[string]int)
+	return nil
+}
+
+// newValidationAnnotation describes the validation of an entity with the status, time, schema and violated constraints
+func newValidationAnnotation(schema *Schema, entity *egdm.Entity, ok bool, violations []*ConstraintViolation, validatedAt time.Time) *egdm.Entity {
+	annotation := egdm.NewEntity().SetID(entity.ID)
+	annotation.SetProperty(EGCLvalid, ok)
+	annotation.SetProperty(EGCLvalidatedAt, validatedAt.Format(time.RFC3339))
+	annotation.SetProperty(EGCLviolationCount, len(violations))
+	if schema.Version != "" {
+		annotation.SetProperty(EGCLschemaVersion, schema.Version)
+	}
+	if schema.BaseURI != "" {
+		annotation.SetReference(EGCLschema, schema.BaseURI)
+	}
+
+	constraints := make([]string, 0)
+	for _, violation := range violations {
+		if violation.Constraint != nil && !containsString(constraints, violation.Constraint.GetID()) {
+			constraints = append(constraints, violation.Constraint.GetID())
+		}
+	}
+	if len(constraints) > 0 {
+		annotation.SetReference(EGCLviolatedConstraint, constraints)
+	}
+	return annotation
+}
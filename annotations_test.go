@@ -0,0 +1,61 @@
+package egcl
+
+import (
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestValidationAnnotator(t *testing.T) {
+	schema, err := parseYaml([]byte(qualitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema.Version = "1.2.0"
+
+	ec := egdm.NewEntityCollection(nil)
+	for _, id := range []string{"alice", "bob"} {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+		if id == "alice" {
+			e.SetProperty("http://data.mimiro.io/amodel/name", id)
+		}
+		_ = ec.AddEntity(e)
+	}
+
+	annotator := NewValidationAnnotator()
+	if _, _, err := NewValidator().WithObserver(annotator).ValidateEntityCollection(schema, ec); err != nil {
+		t.Fatal(err)
+	}
+	annotations := annotator.Annotations()
+	if len(annotations) != 2 {
+		t.Fatalf("expected 2 annotations, got %d", len(annotations))
+	}
+
+	alice, bob := annotations[0], annotations[1]
+	if alice.ID != "http://data.mimiro.io/things/alice" || alice.Properties[EGCLvalid] != true || alice.References[EGCLviolatedConstraint] != nil {
+		t.Errorf("unexpected annotation for alice %+v", alice)
+	}
+	if bob.Properties[EGCLvalid] != false || bob.Properties[EGCLschemaVersion] != "1.2.0" || bob.Properties[EGCLviolationCount] != 1 {
+		t.Errorf("unexpected annotation for bob %+v", bob)
+	}
+	if constraints := makeStringArray(bob.References[EGCLviolatedConstraint]); len(constraints) != 1 || constraints[0] != "http://data.mimiro.io/amodel/nameRequired" {
+		t.Errorf("expected nameRequired to be violated, got %v", constraints)
+	}
+	if _, err := time.Parse(time.RFC3339, bob.Properties[EGCLvalidatedAt].(string)); err != nil {
+		t.Errorf("expected an RFC3339 timestamp, got %v", bob.Properties[EGCLvalidatedAt])
+	}
+
+	store := &jsonDatasetStore{datasets: make(map[string]*egdm.EntityCollection)}
+	if err := annotator.Store(store, "people.quality"); err != nil {
+		t.Fatal(err)
+	}
+	stored := store.datasets["people.quality"]
+	if stored == nil || len(stored.Entities) != 2 || stored.Entities[1].Properties[EGCLvalid] != false {
+		t.Fatalf("expected the annotations to be stored, got %+v", stored)
+	}
+	if len(annotator.Annotations()) != 0 {
+		t.Errorf("expected stored annotations to be forgotten")
+	}
+}
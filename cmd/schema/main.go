@@ -1,31 +1,468 @@
 package main
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
 	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egcl "github.com/mimiro-io/entity-graph-constraint-language"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
 )
 
 func main() {
-	var closedWorldFlag bool
-	var clientSecret string
-	var clientKey string
-	var server string
-	var privateKey string
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			os.Exit(Diff(os.Args[2:], os.Stdout, os.Stderr))
+		case "docs":
+			os.Exit(Docs(os.Args[2:], os.Stdout, os.Stderr))
+		case "infer":
+			os.Exit(Infer(os.Args[2:], os.Stdout, os.Stderr))
+		case "publish":
+			os.Exit(Publish(os.Args[2:], os.Stdout, os.Stderr))
+		case "serve":
+			os.Exit(Serve(os.Args[2:], os.Stdout, os.Stderr))
+		case "profile":
+			os.Exit(Profile(os.Args[2:], os.Stdout, os.Stderr))
+		case "validate":
+			os.Exit(Validate(os.Args[2:], os.Stdout, os.Stderr))
+		}
+	}
+	os.Exit(Validate(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Validate validates a dataset, read from a datahub or an EGDM JSON file, against a schema and writes the violations as
+// text or JSON. The exit code is 0 when the dataset is valid, 1 when it is not and 2 on errors.
+func Validate(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var source dataSourceFlags
+	source.register(flags)
+	var schemaLocation string
 	var validateRelated bool
-	var schema string
-	var dataset string
-	var authType string
-
-	flag.StringVar(&server, "server", "", "Server")
-	flag.StringVar(&authType, "authentication type", "none", "One of: client, key")
-	flag.StringVar(&clientSecret, "clientSecret", "", "Client secret")
-	flag.StringVar(&clientKey, "clientKey", "", "Client key")
-	flag.StringVar(&privateKey, "privateKey", "", "Private key")
-	flag.BoolVar(&closedWorldFlag, "closedWorld", false, "Closed world assumption. Only allow what is defined in the model.")
-	flag.BoolVar(&validateRelated, "validateRelated", false, "validate related entities, check to see they exist and are of the correct type")
-	flag.StringVar(&schema, "schema", "", "Schema file location or remote location")
-	flag.StringVar(&dataset, "dataset", "", "Dataset file or URL")
-	flag.Parse()
-}
-
-func Validate() {
+	var closedWorld bool
+	var format string
+	flags.StringVar(&schemaLocation, "schema", "", "Schema file, URL or dataset:<name> on the server")
+	flags.BoolVar(&validateRelated, "validateRelated", false, "validate related entities, check to see they exist and are of the correct type")
+	flags.BoolVar(&closedWorld, "closedWorld", false, "Closed world assumption. Only allow what is defined in the model.")
+	flags.StringVar(&format, "format", "text", "Output format, one of: text, json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema [validate] -schema <schema> (-server <url> -dataset <name> | -file <entities.json>) [-validateRelated] [-closedWorld] [-format text|json]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if schemaLocation == "" || (format != "text" && format != "json") {
+		flags.Usage()
+		return 2
+	}
+
+	provider, dataset, err := source.provider()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		flags.Usage()
+		return 2
+	}
+	schema, err := loadSchemaFrom(schemaLocation, provider)
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", schemaLocation, err)
+		return 2
+	}
+
+	validator := egcl.NewValidator().WithSettings(&egcl.ValidatorSettings{ValidateRelated: validateRelated, StrictValidation: closedWorld}).WithDataProvider(provider)
+	valid, violations, err := validator.ValidateDataset(schema, dataset)
+	if err != nil {
+		fmt.Fprintf(stderr, "error validating %s: %v\n", dataset, err)
+		return 2
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(violations); err != nil {
+			fmt.Fprintf(stderr, "error writing violations: %v\n", err)
+			return 2
+		}
+	} else {
+		for _, violation := range violations {
+			fmt.Fprintln(stdout, violation.Message)
+		}
+		fmt.Fprintf(stdout, "%d violations in %s\n", len(violations), dataset)
+	}
+
+	if !valid {
+		return 1
+	}
+	return 0
+}
+
+// Diff compares two schema files and writes the changes as text or JSON. The exit code is 0 without breaking changes,
+// 1 if there are breaking changes and 2 on errors.
+func Diff(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var format string
+	flags.StringVar(&format, "format", "text", "Output format, one of: text, json")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema diff [-format text|json] <old schema> <new schema>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		flags.Usage()
+		return 2
+	}
+
+	oldSchema, err := loadSchema(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", flags.Arg(0), err)
+		return 2
+	}
+	newSchema, err := loadSchema(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", flags.Arg(1), err)
+		return 2
+	}
+
+	diff := egcl.DiffSchemas(oldSchema, newSchema)
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(diff); err != nil {
+			fmt.Fprintf(stderr, "error writing diff: %v\n", err)
+			return 2
+		}
+	case "text":
+		writeDiffText(stdout, diff)
+	default:
+		fmt.Fprintf(stderr, "unknown format %s, expected text or json\n", format)
+		return 2
+	}
+
+	if diff.IsBreaking() {
+		return 1
+	}
+	return 0
+}
+
+// Docs writes Markdown documentation for a schema file. The exit code is 2 on errors.
+func Docs(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: schema docs <schema>")
+		return 2
+	}
+	schema, err := loadSchema(args[0])
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", args[0], err)
+		return 2
+	}
+	if err := egcl.GenerateMarkdown(schema, stdout); err != nil {
+		fmt.Fprintf(stderr, "error writing documentation: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+func writeDiffText(w io.Writer, diff *egcl.SchemaDiff) {
+	if len(diff.Changes) == 0 {
+		fmt.Fprintln(w, "no changes")
+		return
+	}
+	for _, change := range diff.Changes {
+		compatibility := "compatible"
+		if change.Breaking {
+			compatibility = "BREAKING"
+		}
+		fmt.Fprintf(w, "%-10s %-22s %s\n", compatibility, change.ChangeType, change.Description)
+	}
+	fmt.Fprintf(w, "%d changes, %d breaking\n", len(diff.Changes), len(diff.GetBreakingChanges()))
+}
+
+// loadSchema reads a schema file or URL together with the schemas it imports
+func loadSchema(location string) (*egcl.Schema, error) {
+	return egcl.LoadSchema(location, nil)
+}
+
+// loadSchemaFrom loads a schema stored in a dataset of the provider when the location is dataset:<name>, and any other
+// location like loadSchema
+func loadSchemaFrom(location string, provider egcl.DataProvider) (*egcl.Schema, error) {
+	if strings.HasPrefix(location, egcl.DatasetSchemaPrefix) {
+		return egcl.LoadSchemaFromDataset(provider, strings.TrimPrefix(location, egcl.DatasetSchemaPrefix))
+	}
+	return loadSchema(location)
+}
+
+// Publish stores a schema file in a datahub dataset, so that it can be loaded with LoadSchemaFromDataset or as
+// dataset:<name>. The exit code is 2 on errors.
+func Publish(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var target dataSourceFlags
+	target.register(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema publish -server <url> -dataset <name> <schema>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || target.dataset == "" {
+		flags.Usage()
+		return 2
+	}
+
+	schema, err := loadSchema(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", flags.Arg(0), err)
+		return 2
+	}
+	client, err := target.client()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
+	if err := egcl.PublishSchema(client, schema, target.dataset); err != nil {
+		fmt.Fprintf(stderr, "error publishing to %s: %v\n", target.dataset, err)
+		return 2
+	}
+	fmt.Fprintf(stdout, "published %d entity classes to %s\n", len(schema.EntityClasses), target.dataset)
+	return 0
+}
+
+// Infer writes a draft schema in YAML for the entities of a dataset, read from a datahub or an EGDM JSON file. The exit
+// code is 2 on errors.
+func Infer(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("infer", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var source dataSourceFlags
+	source.register(flags)
+	var resolveReferences bool
+	var output string
+	flags.BoolVar(&resolveReferences, "resolveReferences", false, "Look up referenced entities outside the dataset to find their types")
+	flags.StringVar(&output, "o", "", "Write the schema to this file instead of standard out")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema infer (-server <url> -dataset <name> | -file <entities.json>) [-resolveReferences] [-o <file>]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	provider, dataset, err := source.provider()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		flags.Usage()
+		return 2
+	}
+
+	inference, err := egcl.InferSchema(provider, dataset, &egcl.InferenceSettings{ResolveReferences: resolveReferences})
+	if err != nil {
+		fmt.Fprintf(stderr, "error inferring schema from %s: %v\n", dataset, err)
+		return 2
+	}
+	data, err := inference.Yaml()
+	if err != nil {
+		fmt.Fprintf(stderr, "error writing schema: %v\n", err)
+		return 2
+	}
+
+	if output != "" {
+		err = os.WriteFile(output, data, 0644)
+	} else {
+		_, err = stdout.Write(data)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error writing schema: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// Profile validates a dataset against a schema and writes a data quality report as JSON or HTML. The exit code is 2 on
+// errors.
+func Profile(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("profile", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var source dataSourceFlags
+	source.register(flags)
+	var schemaLocation string
+	var format string
+	var output string
+	flags.StringVar(&schemaLocation, "schema", "", "Schema file, URL or dataset:<name> on the server")
+	flags.StringVar(&format, "format", "json", "Output format, one of: json, html")
+	flags.StringVar(&output, "o", "", "Write the report to this file instead of standard out")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema profile -schema <schema> (-server <url> -dataset <name> | -file <entities.json>) [-format json|html] [-o <file>]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if schemaLocation == "" || (format != "json" && format != "html") {
+		flags.Usage()
+		return 2
+	}
+
+	provider, dataset, err := source.provider()
+	if err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		flags.Usage()
+		return 2
+	}
+	schema, err := loadSchemaFrom(schemaLocation, provider)
+	if err != nil {
+		fmt.Fprintf(stderr, "error loading %s: %v\n", schemaLocation, err)
+		return 2
+	}
+
+	report, err := egcl.NewValidator().WithDataProvider(provider).ProfileDataset(schema, dataset)
+	if err != nil {
+		fmt.Fprintf(stderr, "error profiling %s: %v\n", dataset, err)
+		return 2
+	}
+
+	writer := stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Fprintf(stderr, "error writing report: %v\n", err)
+			return 2
+		}
+		defer file.Close()
+		writer = file
+	}
+	if format == "html" {
+		err = report.WriteHTML(writer)
+	} else {
+		err = report.WriteJSON(writer)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "error writing report: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// dataSourceFlags are the flags of subcommands that read a dataset from a datahub or from a file
+type dataSourceFlags struct {
+	server       string
+	dataset      string
+	file         string
+	authorizer   string
+	audience     string
+	authType     string
+	clientKey    string
+	clientSecret string
+	privateKey   string
+}
+
+func (f *dataSourceFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.server, "server", "", "Datahub server")
+	flags.StringVar(&f.dataset, "dataset", "", "Dataset name, defaults to the file name when reading a file")
+	flags.StringVar(&f.file, "file", "", "EGDM JSON file to read entities from instead of a datahub")
+	flags.StringVar(&f.authorizer, "authorizer", "", "Token endpoint for client key and secret authentication")
+	flags.StringVar(&f.audience, "audience", "", "Audience for client key and secret authentication")
+	flags.StringVar(&f.authType, "authentication type", "none", "One of: client, key")
+	flags.StringVar(&f.clientKey, "clientKey", "", "Client key")
+	flags.StringVar(&f.clientSecret, "clientSecret", "", "Client secret")
+	flags.StringVar(&f.privateKey, "privateKey", "", "Private key")
+}
+
+// provider returns the data provider for the flags and the name of the dataset to read
+func (f *dataSourceFlags) provider() (egcl.DataProvider, string, error) {
+	if f.file != "" {
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return nil, "", err
+		}
+		ec, err := egdm.NewEntityParser(egdm.NewNamespaceContext()).WithExpandURIs().LoadEntityCollection(strings.NewReader(string(data)))
+		if err != nil {
+			return nil, "", err
+		}
+		dataset := f.dataset
+		if dataset == "" {
+			dataset = strings.TrimSuffix(filepath.Base(f.file), filepath.Ext(f.file))
+		}
+		return egcl.NewCollectionDataProvider().WithDataset(dataset, ec), dataset, nil
+	}
+
+	if f.server == "" || f.dataset == "" {
+		return nil, "", fmt.Errorf("either a file or a server and dataset is needed")
+	}
+	client, err := f.client()
+	if err != nil {
+		return nil, "", err
+	}
+	provider, err := egcl.NewRemoteDataProvider(client)
+	if err != nil {
+		return nil, "", err
+	}
+	return provider, f.dataset, nil
+}
+
+// client returns a datahub client for the server and authentication flags
+func (f *dataSourceFlags) client() (*datahub.Client, error) {
+	if f.server == "" {
+		return nil, fmt.Errorf("a server is needed")
+	}
+	client, err := datahub.NewClient(f.server)
+	if err != nil {
+		return nil, err
+	}
+	switch f.authType {
+	case "key":
+		// the private key is a PEM file, the client key identifies the client it belongs to
+		privateKey, err := loadPrivateKey(f.privateKey)
+		if err != nil {
+			return nil, err
+		}
+		client = client.WithPublicKeyAuth(f.clientKey, privateKey)
+	case "client", "none":
+		// a client key without an authentication type still means client key and secret authentication
+		if f.authType == "client" || f.clientKey != "" {
+			client = client.WithClientKeyAndSecretAuth(f.authorizer, f.audience, f.clientKey, f.clientSecret)
+		}
+	default:
+		return nil, fmt.Errorf("unknown authentication type %s", f.authType)
+	}
+	return client, nil
+}
+
+// loadPrivateKey reads an RSA private key from a PKCS #1 or PKCS #8 PEM file
+func loadPrivateKey(location string) (*rsa.PrivateKey, error) {
+	if location == "" {
+		return nil, fmt.Errorf("a private key is needed for key authentication")
+	}
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", location)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key in %s is not an RSA key", location)
+	}
+	return rsaKey, nil
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "people.yaml")
+	if err := os.WriteFile(schemaFile, []byte(servePersonSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entitiesFile := filepath.Join(dir, "people.json")
+	if err := os.WriteFile(entitiesFile, []byte(servePeople), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := Validate([]string{"-schema", schemaFile, "-file", entitiesFile}, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("expected exit code 1 for an invalid dataset, got %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "http://data.mimiro.io/amodel/bob") || !strings.Contains(stdout.String(), "1 violations in people") {
+		t.Errorf("unexpected output %s", stdout.String())
+	}
+
+	stdout.Reset()
+	code = Validate([]string{"-schema", schemaFile, "-file", entitiesFile, "-format", "json"}, &stdout, &stderr)
+	if code != 1 || !strings.HasPrefix(strings.TrimSpace(stdout.String()), "[") {
+		t.Errorf("expected violations as json, got %d: %s", code, stdout.String())
+	}
+
+	stdout.Reset()
+	code = Validate([]string{"-schema", schemaFile, "-file", entitiesFile, "-closedWorld"}, &stdout, &stderr)
+	if code != 1 || !strings.Contains(stdout.String(), "violations in people") {
+		t.Errorf("expected a closed world validation, got %d: %s %s", code, stdout.String(), stderr.String())
+	}
+
+	if code := Validate([]string{"-schema", schemaFile, "-server", "http://localhost:1", "-dataset", "people", "-authentication type", "token"}, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 for an unknown authentication type, got %d", code)
+	}
+
+	// the file has no dataset with a published schema
+	stderr.Reset()
+	if code := Validate([]string{"-schema", "dataset:schemas", "-file", entitiesFile}, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2, got %d", code)
+	}
+	if code := Validate([]string{"-file", entitiesFile}, &stdout, &stderr); code != 2 {
+		t.Errorf("expected exit code 2 without a schema, got %d", code)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	egcl "github.com/mimiro-io/entity-graph-constraint-language"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = time.Minute
+	serveWriteTimeout      = 5 * time.Minute
+	serveIdleTimeout       = 2 * time.Minute
+)
+
+// Serve hosts an HTTP API that validates EGDM JSON entity collections against the schemas in the given files and
+// directories. Schema files are reloaded when they change. The exit code is 2 on errors.
+func Serve(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var addr string
+	var reloadInterval time.Duration
+	var maxBodySize int64
+	flags.StringVar(&addr, "addr", ":8080", "Address to listen on")
+	flags.DurationVar(&reloadInterval, "reload", 2*time.Second, "How often to check schema files for changes, 0 turns reloading off")
+	flags.Int64Var(&maxBodySize, "max-body-size", defaultMaxBodySize, "Largest entity collection accepted for validation, in bytes")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: schema serve [-addr :8080] [-reload 2s] [-max-body-size bytes] <schema file or directory>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	server := newSchemaServer(flags.Args(), stderr)
+	server.maxBodySize = maxBodySize
+	if err := server.reload(); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
+	if reloadInterval > 0 {
+		go func() {
+			for range time.Tick(reloadInterval) {
+				if err := server.reload(); err != nil {
+					fmt.Fprintf(stderr, "error reloading schemas: %v\n", err)
+				}
+			}
+		}()
+	}
+
+	fmt.Fprintf(stdout, "serving %d schemas on %s\n", len(server.list()), addr)
+	httpServer := &http.Server{
+		Addr:              addr,
+		Handler:           server,
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+		WriteTimeout:      serveWriteTimeout,
+		IdleTimeout:       serveIdleTimeout,
+	}
+	if err := httpServer.ListenAndServe(); err != nil {
+		fmt.Fprintf(stderr, "error: %v\n", err)
+		return 2
+	}
+	return 0
+}
+
+// servedSchema is a schema file, the id is the file name without extension, or the path without extension when files
+// in different directories have the same name
+type servedSchema struct {
+	ID       string `json:"id"`
+	Location string `json:"location"`
+	Title    string `json:"title,omitempty"`
+	Version  string `json:"version,omitempty"`
+	BaseURI  string `json:"baseURI,omitempty"`
+	Loaded   string `json:"loaded"`
+	// Error is the last load error, the previously loaded version of the schema is still served
+	Error string `json:"error,omitempty"`
+
+	schema *egcl.Schema
+	// documents are the modification times of the schema file and the files it imports when it was loaded
+	documents map[string]time.Time
+}
+
+// changed is true when the schema file or one of its imports was modified, created or removed since it was loaded
+func (served *servedSchema) changed() bool {
+	for location, modTime := range served.documents {
+		if !fileModTime(location).Equal(modTime) {
+			return true
+		}
+	}
+	return len(served.documents) == 0
+}
+
+// fileModTime returns the modification time of a file, or the zero time for missing files and URLs
+func fileModTime(location string) time.Time {
+	info, err := os.Stat(location)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// schemaServer serves the validation API over the schema files it keeps loaded
+type schemaServer struct {
+	locations   []string
+	log         io.Writer
+	maxBodySize int64
+
+	lock    sync.RWMutex
+	schemas map[string]*servedSchema
+}
+
+func newSchemaServer(locations []string, log io.Writer) *schemaServer {
+	return &schemaServer{locations: locations, log: log, maxBodySize: defaultMaxBodySize, schemas: make(map[string]*servedSchema)}
+}
+
+// defaultMaxBodySize is the largest request body accepted for validation
+const defaultMaxBodySize = 64 << 20
+
+// schemaFiles lists the files given as locations and the schema files in the directories given as locations
+func (s *schemaServer) schemaFiles() ([]string, error) {
+	files := make([]string, 0)
+	for _, location := range s.locations {
+		info, err := os.Stat(location)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, location)
+			continue
+		}
+		entries, err := os.ReadDir(location)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(location, entry.Name()))
+				}
+			}
+		}
+	}
+	return files, nil
+}
+
+// schemaIds maps each file to its id, which is the file name without extension unless files in different directories
+// have the same name. Those are identified by their path without extension.
+func schemaIds(files []string) map[string]string {
+	name := func(file string) string {
+		return strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+	directories := make(map[string]map[string]bool)
+	for _, file := range files {
+		if directories[name(file)] == nil {
+			directories[name(file)] = make(map[string]bool)
+		}
+		directories[name(file)][filepath.Dir(filepath.Clean(file))] = true
+	}
+	ids := make(map[string]string, len(files))
+	for _, file := range files {
+		ids[file] = name(file)
+		if len(directories[name(file)]) > 1 {
+			ids[file] = filepath.ToSlash(strings.TrimSuffix(filepath.Clean(file), filepath.Ext(file)))
+		}
+	}
+	return ids
+}
+
+// reload loads the schema files that are new or modified since they were last loaded, or whose imports were modified,
+// and drops removed ones. A file that fails to load keeps its previously loaded version.
+func (s *schemaServer) reload() error {
+	files, err := s.schemaFiles()
+	if err != nil {
+		return err
+	}
+	ids := schemaIds(files)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seen := make(map[string]bool)
+	for _, file := range files {
+		id := ids[file]
+		seen[id] = true
+		served, ok := s.schemas[id]
+		if ok && served.Location == file && !served.changed() {
+			continue
+		}
+		if !ok || served.Location != file {
+			served = &servedSchema{ID: id, Location: file}
+			s.schemas[id] = served
+		}
+
+		// the documents are recorded as they are loaded, so that a change to any of them reloads the schema
+		documents := make(map[string]time.Time)
+		loader := egcl.SchemaLoaderFunc(func(location string) ([]byte, error) {
+			documents[location] = fileModTime(location)
+			return egcl.DefaultSchemaLoader.Load(location)
+		})
+		schema, err := egcl.LoadSchema(file, loader)
+		served.documents = documents
+		if err != nil {
+			served.Error = err.Error()
+			fmt.Fprintf(s.log, "error loading schema %s: %v\n", file, err)
+			continue
+		}
+		served.schema = schema
+		served.Title, served.Version, served.BaseURI = schema.Title, schema.Version, schema.BaseURI
+		served.Loaded = time.Now().UTC().Format(time.RFC3339)
+		served.Error = ""
+	}
+	for id := range s.schemas {
+		if !seen[id] {
+			delete(s.schemas, id)
+		}
+	}
+	return nil
+}
+
+// list returns the served schemas ordered by id, including files that have not loaded yet
+func (s *schemaServer) list() []*servedSchema {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	schemas := make([]*servedSchema, 0, len(s.schemas))
+	for _, served := range s.schemas {
+		copied := *served
+		schemas = append(schemas, &copied)
+	}
+	sort.Slice(schemas, func(i, j int) bool {
+		return schemas[i].ID < schemas[j].ID
+	})
+	return schemas
+}
+
+// lookup returns the schema with the id, or the only schema if the id is empty
+func (s *schemaServer) lookup(id string) (*egcl.Schema, string, error) {
+	schemas := make([]*servedSchema, 0)
+	for _, served := range s.list() {
+		if served.schema != nil {
+			schemas = append(schemas, served)
+		}
+	}
+	if id == "" {
+		if len(schemas) != 1 {
+			return nil, "", fmt.Errorf("%d schemas are loaded, select one with the schema parameter", len(schemas))
+		}
+		return schemas[0].schema, schemas[0].ID, nil
+	}
+	for _, served := range schemas {
+		if served.ID == id {
+			return served.schema, id, nil
+		}
+	}
+	return nil, "", fmt.Errorf("unknown schema %s", id)
+}
+
+type servedClass struct {
+	ID           string   `json:"id"`
+	Label        string   `json:"label"`
+	Description  string   `json:"description,omitempty"`
+	Superclasses []string `json:"superclasses,omitempty"`
+	Abstract     bool     `json:"abstract,omitempty"`
+	Deprecated   bool     `json:"deprecated,omitempty"`
+}
+
+type validationReport struct {
+	Schema     string                      `json:"schema"`
+	Valid      bool                        `json:"valid"`
+	Entities   int                         `json:"entities"`
+	Violations []*egcl.ConstraintViolation `json:"violations"`
+}
+
+// ServeHTTP routes the API:
+//
+//	GET  /schemas                  lists the loaded schemas
+//	GET  /schemas/{id}/classes     lists the entity classes of a schema, slashes in the id are escaped
+//	POST /validate?schema={id}     validates an EGDM JSON entity collection, the schema may be left out if only one is loaded
+func (s *schemaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.EscapedPath(), "/")
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "schemas":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, http.StatusOK, s.list())
+	case len(parts) == 3 && parts[0] == "schemas" && parts[2] == "classes":
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		id, err := url.PathUnescape(parts[1])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		schema, _, err := s.lookup(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, classesOf(schema))
+	case path == "validate":
+		if !allowMethod(w, r, http.MethodPost) {
+			return
+		}
+		s.validate(w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such resource %s", r.URL.Path))
+	}
+}
+
+func (s *schemaServer) validate(w http.ResponseWriter, r *http.Request) {
+	schema, id, err := s.lookup(r.URL.Query().Get("schema"))
+	if err != nil {
+		status := http.StatusNotFound
+		if r.URL.Query().Get("schema") == "" {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, s.maxBodySize)
+	entities, err := egdm.NewEntityParser(egdm.NewNamespaceContext()).WithExpandURIs().LoadEntityCollection(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("entity collection is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid entity collection: %v", err))
+		return
+	}
+
+	valid, violations, err := egcl.NewValidator().ValidateEntityCollection(schema, entities)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if violations == nil {
+		violations = make([]*egcl.ConstraintViolation, 0)
+	}
+	writeJSON(w, http.StatusOK, &validationReport{Schema: id, Valid: valid, Entities: len(entities.Entities), Violations: violations})
+}
+
+func classesOf(schema *egcl.Schema) []*servedClass {
+	classes := make([]*servedClass, 0, len(schema.EntityClasses))
+	for _, entityClass := range schema.EntityClasses {
+		id := entityClass.Entity.ID
+		label := entityClass.GetLabel()
+		if label == "" {
+			label, _ = schema.EntityCollection.NamespaceManager.GetPrefixedIdentifier(id)
+		}
+		if label == "" {
+			label = id
+		}
+		classes = append(classes, &servedClass{
+			ID:           id,
+			Label:        label,
+			Description:  entityClass.GetDescription(),
+			Superclasses: entityClass.GetSuperclasses(),
+			Abstract:     schema.IsAbstract(entityClass),
+			Deprecated:   entityClass.IsDeprecated(),
+		})
+	}
+	return classes
+}
+
+func allowMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method == method {
+		return true
+	}
+	w.Header().Set("Allow", method)
+	writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
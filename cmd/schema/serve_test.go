@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const servePersonSchema = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+  title: People
+
+- id: model:Person
+  label: Person
+  propertyConstraints:
+    - propertyClass: model:name
+      minCard: 1
+`
+
+const servePeople = `[
+  {"id": "@context", "namespaces": {"model": "http://data.mimiro.io/amodel/", "rdf": "http://www.w3.org/1999/02/22-rdf-syntax-ns#"}},
+  {"id": "model:alice", "refs": {"rdf:type": "model:Person"}, "props": {"model:name": "alice"}},
+  {"id": "model:bob", "refs": {"rdf:type": "model:Person"}, "props": {"model:email": "bob@example.com"}}
+]`
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	schemaFile := filepath.Join(dir, "people.yaml")
+	if err := os.WriteFile(schemaFile, []byte(servePersonSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newSchemaServer([]string{dir}, io.Discard)
+	if err := server.reload(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var schemas []map[string]any
+	getJSON(t, ts.URL+"/schemas", http.StatusOK, &schemas)
+	if len(schemas) != 1 || schemas[0]["id"] != "people" || schemas[0]["title"] != "People" {
+		t.Fatalf("unexpected schemas %v", schemas)
+	}
+
+	var classes []map[string]any
+	getJSON(t, ts.URL+"/schemas/people/classes", http.StatusOK, &classes)
+	if len(classes) != 1 || classes[0]["label"] != "Person" {
+		t.Fatalf("unexpected classes %v", classes)
+	}
+
+	var report validationReportResponse
+	postJSON(t, ts.URL+"/validate", servePeople, http.StatusOK, &report)
+	if report.Valid || report.Entities != 2 || len(report.Violations) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Violations[0]["entity"] != "http://data.mimiro.io/amodel/bob" || report.Violations[0]["violationType"] != "MinPropertyOccurrenceNotMet" {
+		t.Errorf("unexpected violation %v", report.Violations[0])
+	}
+
+	// the name is made optional and the file reloaded
+	relaxed := strings.Replace(servePersonSchema, "minCard: 1", "minCard: 0", 1)
+	if err := os.WriteFile(schemaFile, []byte(relaxed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(schemaFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.reload(); err != nil {
+		t.Fatal(err)
+	}
+	postJSON(t, ts.URL+"/validate?schema=people", servePeople, http.StatusOK, &report)
+	if !report.Valid || len(report.Violations) != 0 {
+		t.Errorf("expected valid report after reload, got %+v", report)
+	}
+
+	var failure map[string]string
+	postJSON(t, ts.URL+"/validate?schema=other", servePeople, http.StatusNotFound, &failure)
+	postJSON(t, ts.URL+"/validate", "not json", http.StatusBadRequest, &failure)
+	getJSON(t, ts.URL+"/validate", http.StatusMethodNotAllowed, &failure)
+
+	server.maxBodySize = 16
+	postJSON(t, ts.URL+"/validate", servePeople, http.StatusRequestEntityTooLarge, &failure)
+}
+
+func TestServeReloadsImports(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "shared"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	coreFile := filepath.Join(dir, "shared", "core.yaml")
+	if err := os.WriteFile(coreFile, []byte(servePersonSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+	root := `
+- id: "@context"
+  namespaces:
+    egcl: http://data.mimiro.io/egcl/
+  imports: [shared/core.yaml]
+`
+	if err := os.WriteFile(filepath.Join(dir, "people.yaml"), []byte(root), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := newSchemaServer([]string{dir}, io.Discard)
+	if err := server.reload(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var report validationReportResponse
+	postJSON(t, ts.URL+"/validate", servePeople, http.StatusOK, &report)
+	if report.Valid {
+		t.Fatalf("expected the imported constraint to apply, got %+v", report)
+	}
+
+	// only the imported file changes
+	relaxed := strings.Replace(servePersonSchema, "minCard: 1", "minCard: 0", 1)
+	if err := os.WriteFile(coreFile, []byte(relaxed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(coreFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.reload(); err != nil {
+		t.Fatal(err)
+	}
+	postJSON(t, ts.URL+"/validate", servePeople, http.StatusOK, &report)
+	if !report.Valid {
+		t.Errorf("expected the changed import to be reloaded, got %+v", report)
+	}
+}
+
+func TestServeSchemasWithTheSameName(t *testing.T) {
+	dir := t.TempDir()
+	locations := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")}
+	for _, location := range locations {
+		if err := os.Mkdir(location, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{filepath.Join(dir, "a", "people.yaml"), filepath.Join(dir, "b", "people.yaml"), filepath.Join(dir, "c", "other.yaml")} {
+		if err := os.WriteFile(file, []byte(servePersonSchema), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := newSchemaServer(locations, io.Discard)
+	if err := server.reload(); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	var schemas []map[string]any
+	getJSON(t, ts.URL+"/schemas", http.StatusOK, &schemas)
+	ids := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		ids = append(ids, schema["id"].(string))
+	}
+	expected := []string{filepath.ToSlash(filepath.Join(dir, "a", "people")), filepath.ToSlash(filepath.Join(dir, "b", "people")), "other"}
+	if len(ids) != 3 || ids[0] != expected[0] || ids[1] != expected[1] || ids[2] != expected[2] {
+		t.Fatalf("expected schemas %v, got %v", expected, ids)
+	}
+
+	var classes []map[string]any
+	getJSON(t, ts.URL+"/schemas/"+url.PathEscape(ids[1])+"/classes", http.StatusOK, &classes)
+	if len(classes) != 1 {
+		t.Errorf("expected the classes of %s, got %v", ids[1], classes)
+	}
+}
+
+type validationReportResponse struct {
+	Schema     string           `json:"schema"`
+	Valid      bool             `json:"valid"`
+	Entities   int              `json:"entities"`
+	Violations []map[string]any `json:"violations"`
+}
+
+func getJSON(t *testing.T, url string, status int, value any) {
+	t.Helper()
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeResponse(t, response, status, value)
+}
+
+func postJSON(t *testing.T, url string, body string, status int, value any) {
+	t.Helper()
+	response, err := http.Post(url, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodeResponse(t, response, status, value)
+}
+
+func decodeResponse(t *testing.T, response *http.Response, status int, value any) {
+	t.Helper()
+	defer response.Body.Close()
+	if response.StatusCode != status {
+		body, _ := io.ReadAll(response.Body)
+		t.Fatalf("expected status %d, got %d: %s", status, response.StatusCode, body)
+	}
+	if err := json.NewDecoder(response.Body).Decode(value); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,158 @@
+package egcl
+
+import (
+	"sort"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// CollectionDataProvider is a DataProvider over entity collections held in memory, like files exported from a
+// datahub. Each collection is a named dataset.
+type CollectionDataProvider struct {
+	datasets map[string]*egdm.EntityCollection
+}
+
+func NewCollectionDataProvider() *CollectionDataProvider {
+	return &CollectionDataProvider{datasets: make(map[string]*egdm.EntityCollection)}
+}
+
+// WithDataset adds the entities of the collection as the named dataset
+func (p *CollectionDataProvider) WithDataset(name string, entities *egdm.EntityCollection) *CollectionDataProvider {
+	p.datasets[name] = entities
+	return p
+}
+
+// datasetNames returns the given datasets that exist, or all datasets in name order if none are given
+func (p *CollectionDataProvider) datasetNames(datasets []string) []string {
+	if len(datasets) == 0 {
+		for name := range p.datasets {
+			datasets = append(datasets, name)
+		}
+		sort.Strings(datasets)
+	}
+	names := make([]string, 0, len(datasets))
+	for _, name := range datasets {
+		if _, ok := p.datasets[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// collections returns the given datasets, or all datasets in name order if none are given
+func (p *CollectionDataProvider) collections(datasets []string) []*egdm.EntityCollection {
+	collections := make([]*egdm.EntityCollection, 0, len(datasets))
+	for _, name := range p.datasetNames(datasets) {
+		collections = append(collections, p.datasets[name])
+	}
+	return collections
+}
+
+// GetEntity returns the entity like a datahub does without partial merging: the entity of each dataset is a partial
+// tagged with the dataset name. The properties and references of the entity are those of the first partial.
+func (p *CollectionDataProvider) GetEntity(entityId string, datasets []string) (*egdm.Entity, error) {
+	entities, _ := p.GetEntities([]string{entityId}, datasets)
+	return entities[entityId], nil
+}
+
+// GetEntities implements BatchDataProvider
+func (p *CollectionDataProvider) GetEntities(entityIds []string, datasets []string) (map[string]*egdm.Entity, error) {
+	wanted := toSet(entityIds)
+	result := make(map[string]*egdm.Entity)
+	for _, name := range p.datasetNames(datasets) {
+		for _, entity := range p.datasets[name].Entities {
+			if !wanted[entity.ID] {
+				continue
+			}
+			partial := copyEntity(entity)
+			partial.Properties[CoreDatasetURI] = name
+
+			merged, found := result[entity.ID]
+			if !found {
+				merged = copyEntity(entity)
+				merged.IsDeleted = true
+				merged.Properties[CorePartialsURI] = make([]*egdm.Entity, 0, 1)
+				result[entity.ID] = merged
+			}
+			merged.Properties[CorePartialsURI] = append(merged.Properties[CorePartialsURI].([]*egdm.Entity), partial)
+			merged.IsDeleted = merged.IsDeleted && entity.IsDeleted
+		}
+	}
+	return result, nil
+}
+
+// copyEntity copies the entity with its own property and reference maps
+func copyEntity(entity *egdm.Entity) *egdm.Entity {
+	copied := egdm.NewEntity().SetID(entity.ID)
+	copied.IsDeleted = entity.IsDeleted
+	for key, value := range entity.Properties {
+		copied.Properties[key] = value
+	}
+	for key, value := range entity.References {
+		copied.References[key] = value
+	}
+	return copied
+}
+
+func (p *CollectionDataProvider) GetDatasetEntities(dataset string) (datahub.EntityIterator, error) {
+	ec, ok := p.datasets[dataset]
+	if !ok {
+		return &collectionIterator{}, nil
+	}
+	return &collectionIterator{entities: ec.Entities, context: ec.NamespaceManager.AsContext()}, nil
+}
+
+func (p *CollectionDataProvider) Hop(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (datahub.EntityIterator, error) {
+	result := make([]*egdm.Entity, 0)
+	if inverse {
+		for _, ec := range p.collections(datasets) {
+			for _, entity := range ec.Entities {
+				for _, ref := range makeStringArray(entity.References[reference]) {
+					if ref == sourceEntityId {
+						result = append(result, entity)
+						break
+					}
+				}
+			}
+		}
+	} else {
+		source, _ := p.GetEntity(sourceEntityId, datasets)
+		if source != nil {
+			targets, _ := p.GetEntities(makeStringArray(source.References[reference]), datasets)
+			for _, ref := range makeStringArray(source.References[reference]) {
+				if target, ok := targets[ref]; ok {
+					result = append(result, target)
+				}
+			}
+		}
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return &collectionIterator{entities: result}, nil
+}
+
+// collectionIterator iterates over a slice of entities
+type collectionIterator struct {
+	entities []*egdm.Entity
+	context  *egdm.Context
+	token    *egdm.Continuation
+}
+
+func (it *collectionIterator) Context() *egdm.Context {
+	return it.context
+}
+
+func (it *collectionIterator) Next() (*egdm.Entity, error) {
+	if len(it.entities) == 0 {
+		return nil, nil
+	}
+	entity := it.entities[0]
+	it.entities = it.entities[1:]
+	return entity, nil
+}
+
+func (it *collectionIterator) Token() *egdm.Continuation {
+	return it.token
+}
@@ -0,0 +1,52 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestCollectionProviderWithDatasetsContext(t *testing.T) {
+	schema, err := parseYaml([]byte(impactSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newEntity := func(id string, class string) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/"+class)
+		return e
+	}
+	collections := egdm.NewEntityCollection(nil)
+	_ = collections.AddEntity(newEntity("c1", "EntityCollection"))
+	other := egdm.NewEntityCollection(nil)
+	_ = other.AddEntity(newEntity("c2", "EntityCollection"))
+	provider := NewCollectionDataProvider().WithDataset("collections", collections).WithDataset("other", other)
+
+	c1, err := provider.GetEntity("http://data.mimiro.io/things/c1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	partials, err := getPartials(c1)
+	if err != nil || len(partials) != 1 || partials[0].Properties[CoreDatasetURI] != "collections" {
+		t.Fatalf("expected a partial of the collections dataset, got %v %v", partials, err)
+	}
+	if _, ok := collections.Entities[0].Properties[CoreDatasetURI]; ok {
+		t.Error("expected the entity in the collection to be left unchanged")
+	}
+
+	validator := NewValidator().
+		WithSettings(&ValidatorSettings{ValidateRelated: true, DatasetsContext: []string{"collections"}}).
+		WithDataProvider(provider)
+	for target, expected := range map[string]bool{"c1": true, "c2": false} {
+		e := newEntity("e1", "Entity")
+		e.SetReference("http://data.mimiro.io/amodel/partOf", "http://data.mimiro.io/things/"+target)
+		valid, violations, err := validator.ValidateEntity(schema, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if valid != expected {
+			t.Errorf("reference to %s: expected valid to be %v, got %v", target, expected, violations)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package egcl
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const EGCLPropertyComparisonConstraint = EGCLUriExpansion + "PropertyComparisonConstraint"
+
+const (
+	EGCLotherPropertyClass = EGCLUriExpansion + "otherPropertyClass"
+	EGCLoperator           = EGCLUriExpansion + "operator"
+)
+
+// comparison operators of egcl:operator
+const (
+	OperatorEquals              = "="
+	OperatorNotEquals           = "!="
+	OperatorLessThan            = "<"
+	OperatorLessThanOrEquals    = "<="
+	OperatorGreaterThan         = ">"
+	OperatorGreaterThanOrEquals = ">="
+)
+
+// date formats recognised when comparing string values
+var comparisonDateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+func newPropertyComparisonConstraint(entity *egdm.Entity) *PropertyComparisonConstraint {
+	c := &PropertyComparisonConstraint{}
+	c.Constraint.Entity = entity
+	c.Constraint.ConstraintTypeIdentifier = EGCLPropertyComparisonConstraint
+	return c
+}
+
+// PropertyComparisonConstraint compares the values of egcl:propertyClass with the values of egcl:otherPropertyClass on
+// the same entity. With = both properties must have the same values and with != they must not share any value, the
+// ordering operators must hold for every pair of values. Numbers are compared by value, dates given as time values or
+// as RFC 3339 strings by time and other strings lexically. Booleans can only be compared with = and !=. The constraint
+// holds when either property has no values.
+type PropertyComparisonConstraint struct {
+	Constraint
+}
+
+func (c *PropertyComparisonConstraint) GetConstrainedPropertyClass() (string, error) {
+	return c.Entity.GetFirstReferenceValue(EGCLpropertyClass)
+}
+
+func (c *PropertyComparisonConstraint) GetOtherPropertyClass() (string, error) {
+	return c.Entity.GetFirstReferenceValue(EGCLotherPropertyClass)
+}
+
+// GetOperator returns one of =, !=, <, <=, > and >=
+func (c *PropertyComparisonConstraint) GetOperator() string {
+	operator, err := c.Entity.GetFirstStringPropertyValue(EGCLoperator)
+	if err != nil {
+		return ""
+	}
+	return operator
+}
+
+func (c *PropertyComparisonConstraint) checkDefinition() error {
+	if !isComparisonOperator(c.GetOperator()) {
+		return errors.Errorf("comparison constraint %s has unknown operator '%s'", c.GetID(), c.GetOperator())
+	}
+	return nil
+}
+
+func (c *PropertyComparisonConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return validator.CheckPropertyComparisonConstraint(entity, c)
+}
+
+// CheckPropertyComparisonConstraint compares the two property classes of the constraint on the entity
+func (v *Validator) CheckPropertyComparisonConstraint(entity *egdm.Entity, constraint *PropertyComparisonConstraint) (bool, *ConstraintViolation, error) {
+	propertyClass, err := constraint.GetConstrainedPropertyClass()
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "comparison constraint %s has no property class", constraint.GetID())
+	}
+	otherPropertyClass, err := constraint.GetOtherPropertyClass()
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "comparison constraint %s has no other property class", constraint.GetID())
+	}
+	operator := constraint.GetOperator()
+
+	values := toValueArray(entity.Properties[propertyClass])
+	otherValues := toValueArray(entity.Properties[otherPropertyClass])
+	if len(values) == 0 || len(otherValues) == 0 {
+		return true, nil, nil
+	}
+
+	holds, message, err := compareValueSets(operator, propertyClass, values, otherPropertyClass, otherValues)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "comparison constraint %s", constraint.GetID())
+	}
+	if !holds {
+		return false, NewConstraintViolation(constraint, entity, PropertyComparisonFailed, message).
+			WithDetails(propertyClass, otherValues, values), nil
+	}
+	return true, nil, nil
+}
+
+// compareValueSets applies the operator to two sets of values, the names are used to describe why it does not hold
+func compareValueSets(operator string, name string, values []any, otherName string, otherValues []any) (bool, string, error) {
+	switch operator {
+	case OperatorEquals:
+		for _, pair := range [][2][]any{{values, otherValues}, {otherValues, values}} {
+			for _, value := range pair[0] {
+				if !containsComparableValue(pair[1], value) {
+					return false, fmt.Sprintf("%s and %s must have the same values but %v is only in one of them", name, otherName, value), nil
+				}
+			}
+		}
+	case OperatorNotEquals:
+		for _, value := range values {
+			if containsComparableValue(otherValues, value) {
+				return false, fmt.Sprintf("%s and %s must differ but both have the value %v", name, otherName, value), nil
+			}
+		}
+	case OperatorLessThan, OperatorLessThanOrEquals, OperatorGreaterThan, OperatorGreaterThanOrEquals:
+		for _, value := range values {
+			for _, otherValue := range otherValues {
+				result, comparable := compareValues(value, otherValue)
+				if !comparable {
+					return false, fmt.Sprintf("%s value %v cannot be compared with %s value %v", name, value, otherName, otherValue), nil
+				}
+				if !operatorHolds(operator, result) {
+					return false, fmt.Sprintf("%s value %v must be %s %s value %v", name, value, operator, otherName, otherValue), nil
+				}
+			}
+		}
+	default:
+		return false, "", errors.Errorf("unknown operator '%s'", operator)
+	}
+	return true, "", nil
+}
+
+func isComparisonOperator(operator string) bool {
+	switch operator {
+	case OperatorEquals, OperatorNotEquals, OperatorLessThan, OperatorLessThanOrEquals, OperatorGreaterThan, OperatorGreaterThanOrEquals:
+		return true
+	}
+	return false
+}
+
+func operatorHolds(operator string, result int) bool {
+	switch operator {
+	case OperatorLessThan:
+		return result < 0
+	case OperatorLessThanOrEquals:
+		return result <= 0
+	case OperatorGreaterThan:
+		return result > 0
+	case OperatorGreaterThanOrEquals:
+		return result >= 0
+	}
+	return false
+}
+
+func containsComparableValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if a, aIsBool := value.(bool); aIsBool {
+			if b, bIsBool := candidate.(bool); bIsBool && a == b {
+				return true
+			}
+			continue
+		}
+		if result, comparable := compareValues(value, candidate); comparable && result == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// compareValues returns -1, 0 or 1, and false if the values are not of comparable kinds
+func compareValues(a any, b any) (int, bool) {
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	at, aIsTime := toTime(a)
+	bt, bIsTime := toTime(b)
+	if aIsTime && bIsTime {
+		return at.Compare(bt), true
+	}
+
+	as, aIsString := a.(string)
+	bs, bIsString := b.(string)
+	if aIsString && bIsString && !aIsTime && !bIsTime {
+		return strings.Compare(as, bs), true
+	}
+	return 0, false
+}
+
+// toTime converts time values and strings in one of the comparisonDateLayouts
+func toTime(val any) (time.Time, bool) {
+	switch v := val.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range comparisonDateLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,144 @@
+package egcl
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestPropertyComparisonConstraints(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Project
+  comparisonConstraints:
+    - propertyClass: model:startDate
+      operator: "<="
+      otherPropertyClass: model:endDate
+    - propertyClass: model:displayName
+      operator: "!="
+      otherPropertyClass: model:name
+    - propertyClass: model:budget
+      operator: ">"
+      otherPropertyClass: model:spent
+    - propertyClass: model:approved
+      operator: "="
+      otherPropertyClass: model:funded
+    - propertyClass: model:archived
+      operator: "!="
+      otherPropertyClass: model:active
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schema.GetConstraintsForProperty("http://data.mimiro.io/amodel/startDate")) != 1 {
+		t.Error("expected comparison constraint to be indexed by its property class")
+	}
+
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, shape := range shapes.GetEntities() {
+		if lessThan, err := shape.GetFirstReferenceValue(SHACLlessThan); err == nil {
+			if path, _ := shape.GetFirstReferenceValue(SHACLpath); path != "http://data.mimiro.io/amodel/spent" || lessThan != "http://data.mimiro.io/amodel/budget" {
+				t.Errorf("expected greater than to be exported as spent less than budget, got %s less than %s", path, lessThan)
+			}
+		}
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{})
+	project := func(props map[string]any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/project")
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Project")
+		for k, val := range props {
+			e.SetProperty("http://data.mimiro.io/amodel/"+k, val)
+		}
+		return e
+	}
+
+	cases := []struct {
+		name       string
+		props      map[string]any
+		violations int
+	}{
+		{"no values", map[string]any{}, 0},
+		{"ordered dates", map[string]any{"startDate": "2023-01-01", "endDate": "2023-06-30T12:00:00Z"}, 0},
+		{"same date", map[string]any{"startDate": "2023-01-01", "endDate": "2023-01-01"}, 0},
+		{"dates out of order", map[string]any{"startDate": "2023-07-01", "endDate": "2023-06-30"}, 1},
+		{"time values", map[string]any{"startDate": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "endDate": "2023-12-31"}, 1},
+		{"date and number", map[string]any{"startDate": "2023-01-01", "endDate": 2023}, 1},
+		{"different names", map[string]any{"displayName": "Apollo", "name": "apollo-11"}, 0},
+		{"same names", map[string]any{"displayName": "apollo-11", "name": []any{"apollo", "apollo-11"}}, 1},
+		{"numbers", map[string]any{"budget": 100, "spent": 99.5}, 0},
+		{"overspent", map[string]any{"budget": 100, "spent": []any{50.0, 100}}, 1},
+		{"equal booleans", map[string]any{"approved": true, "funded": true}, 0},
+		{"different booleans", map[string]any{"approved": true, "funded": false}, 1},
+		{"boolean and string", map[string]any{"approved": true, "funded": "true"}, 1},
+		{"booleans that differ", map[string]any{"archived": false, "active": true}, 0},
+		{"booleans that are the same", map[string]any{"archived": false, "active": false}, 1},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, violations, err := v.ValidateEntity(schema, project(tc.props))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != tc.violations {
+				t.Fatalf("expected %d violations, got %d", tc.violations, len(violations))
+			}
+			for _, violation := range violations {
+				if violation.ViolationType != PropertyComparisonFailed {
+					t.Errorf("expected property comparison violation, got %v: %s", violation.ViolationType, violation.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	cases := []struct {
+		a, b       any
+		result     int
+		comparable bool
+	}{
+		{1, 2.5, -1, true},
+		{"b", "a", 1, true},
+		{"2023-01-01", "2023-01-01T00:00:00Z", 0, true},
+		{"2023-01-01", "abc", 0, false},
+		{"1", 1, 0, false},
+	}
+	for _, tc := range cases {
+		result, comparable := compareValues(tc.a, tc.b)
+		if result != tc.result || comparable != tc.comparable {
+			t.Errorf("compare %v with %v: expected %d %v, got %d %v", tc.a, tc.b, tc.result, tc.comparable, result, comparable)
+		}
+	}
+}
+
+func TestComparisonWithUnknownOperatorFailsToLoad(t *testing.T) {
+	_, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Project
+  comparisonConstraints:
+    - propertyClass: model:startDate
+      operator: "=<"
+      otherPropertyClass: model:endDate
+`))
+	if err == nil || !strings.Contains(err.Error(), "unknown operator '=<'") {
+		t.Errorf("expected the unknown operator to be reported when loading, got %v", err)
+	}
+}
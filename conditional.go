@@ -0,0 +1,116 @@
+package egcl
+
+import (
+	"fmt"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const EGCLConditionalConstraint = EGCLUriExpansion + "ConditionalConstraint"
+
+const (
+	EGCLifPropertyClass  = EGCLUriExpansion + "ifPropertyClass"
+	EGCLifReferenceClass = EGCLUriExpansion + "ifReferenceClass"
+	EGCLifValue          = EGCLUriExpansion + "ifValue"
+	EGCLthen             = EGCLUriExpansion + "then"
+)
+
+func newConditionalConstraint(entity *egdm.Entity) *ConditionalConstraint {
+	c := &ConditionalConstraint{}
+	c.Constraint.Entity = entity
+	c.Constraint.ConstraintTypeIdentifier = EGCLConditionalConstraint
+	return c
+}
+
+// ConditionalConstraint applies a set of nested constraints to an entity only when its condition holds. The condition
+// is on a single property or reference class, it holds when any value equals one of the egcl:ifValue values, or when
+// there is at least one value if no egcl:ifValue is given. The nested constraints are listed with egcl:then and have no
+// entity class of their own.
+type ConditionalConstraint struct {
+	Constraint
+}
+
+func (c *ConditionalConstraint) GetConditionPropertyClass() (string, error) {
+	return c.Entity.GetFirstReferenceValue(EGCLifPropertyClass)
+}
+
+func (c *ConditionalConstraint) GetConditionReferenceClass() (string, error) {
+	return c.Entity.GetFirstReferenceValue(EGCLifReferenceClass)
+}
+
+// GetThenConstraintIds returns the ids of the constraints that apply when the condition holds
+func (c *ConditionalConstraint) GetThenConstraintIds() []string {
+	ids, err := c.Entity.GetReferenceValues(EGCLthen)
+	if err != nil {
+		return []string{}
+	}
+	return ids
+}
+
+// ConditionHolds evaluates the condition against the entity
+func (c *ConditionalConstraint) ConditionHolds(entity *egdm.Entity) (bool, error) {
+	if propertyClass, err := c.GetConditionPropertyClass(); err == nil {
+		values := toValueArray(entity.Properties[propertyClass])
+		expected, hasExpected := c.Entity.Properties[EGCLifValue]
+		if !hasExpected {
+			return len(values) > 0, nil
+		}
+		expectedValues := toValueArray(expected)
+		for _, value := range values {
+			if containsValue(expectedValues, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if referenceClass, err := c.GetConditionReferenceClass(); err == nil {
+		refs := makeStringArray(entity.References[referenceClass])
+		expected, err := c.Entity.GetReferenceValues(EGCLifValue)
+		if err != nil {
+			return len(refs) > 0, nil
+		}
+		for _, ref := range refs {
+			for _, e := range expected {
+				if ref == e {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	return false, errors.Errorf("conditional constraint %s has no condition", c.GetID())
+}
+
+// Check checks the nested constraints when the condition holds and returns the first violation
+func (c *ConditionalConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	holds, err := c.ConditionHolds(entity)
+	if err != nil {
+		return false, nil, err
+	}
+	if !holds {
+		return true, nil, nil
+	}
+
+	for _, id := range c.GetThenConstraintIds() {
+		nested := schema.GetConstraintById(id)
+		if nested == nil {
+			return false, nil, errors.Errorf("constraint %s used in conditional constraint %s is not defined in the schema", id, c.GetID())
+		}
+
+		valid, violation, err := validator.CheckConstraint(schema, nested, entity)
+		if err != nil {
+			return false, nil, err
+		}
+		if !valid {
+			if violation != nil {
+				violation.Message = fmt.Sprintf("%s, as condition of %s holds", violation.Message, c.GetID())
+			}
+			return false, violation, nil
+		}
+	}
+
+	return true, nil, nil
+}
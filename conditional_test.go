@@ -0,0 +1,87 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestConditionalConstraints(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    things: http://data.mimiro.io/things/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Asset
+  conditionalConstraints:
+    - if:
+        propertyClass: model:status
+        equals: retired
+      then:
+        propertyConstraints:
+          - propertyClass: model:retiredDate
+            minCard: 1
+    - if:
+        referenceClass: model:partOf
+      then:
+        propertyConstraints:
+          - propertyClass: model:name
+            maxCard: 1
+    - if:
+        referenceClass: model:owner
+        in: [things:archive]
+      then:
+        referenceConstraints:
+          - referenceClass: model:partOf
+            minCard: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the conditional constraints apply directly to the class
+	constraints := schema.GetConstraintsForEntityClass("http://data.mimiro.io/amodel/Asset", true)
+	if len(constraints) != 3 {
+		t.Fatalf("expected 3 conditional constraints, got %d", len(constraints))
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{})
+	asset := func() *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/asset")
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Asset")
+		e.SetProperty("http://data.mimiro.io/amodel/name", []any{"a", "b"})
+		return e
+	}
+
+	cases := []struct {
+		name      string
+		entity    *egdm.Entity
+		violation ViolationType
+	}{
+		{"no condition holds", asset(), -1},
+		{"active needs no retired date", asset().SetProperty("http://data.mimiro.io/amodel/status", "active"), -1},
+		{"retired needs retired date", asset().SetProperty("http://data.mimiro.io/amodel/status", "retired"), MinPropertyOccurrenceNotMet},
+		{"retired with retired date", asset().SetProperty("http://data.mimiro.io/amodel/status", []any{"retired"}).
+			SetProperty("http://data.mimiro.io/amodel/retiredDate", "2023-01-01"), -1},
+		{"part of limits names", asset().SetReference("http://data.mimiro.io/amodel/partOf", "http://data.mimiro.io/things/c1"), MaxPropertyOccurrenceExceeded},
+		{"archived needs part of", asset().SetReference("http://data.mimiro.io/amodel/owner", []string{"http://data.mimiro.io/things/archive"}), MinReferenceOccurrenceNotMet},
+		{"other owner", asset().SetReference("http://data.mimiro.io/amodel/owner", []string{"http://data.mimiro.io/things/other"}), -1},
+	}
+
+	for _, c := range cases {
+		ok, violations, err := v.ValidateEntity(schema, c.entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.violation == -1 {
+			if !ok {
+				t.Errorf("%s: expected to be valid, got %s", c.name, violations[0].Message)
+			}
+		} else if ok || len(violations) != 1 || violations[0].ViolationType != c.violation {
+			t.Errorf("%s: expected violation %v, got %v", c.name, c.violation, violations)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package egcl
+
+import (
+	"sync"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// ConstraintType is implemented by every kind of constraint. New kinds embed Constraint, override Check and are made
+// known to the schema loader with RegisterConstraintType.
+type ConstraintType interface {
+	// GetID returns the id of the constraint entity
+	GetID() string
+	// GetTypeIdentifier returns the rdf type of the constraint entity
+	GetTypeIdentifier() string
+	// GetEntity returns the entity the constraint was loaded from
+	GetEntity() *egdm.Entity
+	// GetAppliesToEntityClass returns the entity class the constraint applies to, or an empty string if it is not class specific
+	GetAppliesToEntityClass() string
+	// IsInherited is true if the constraint also applies to subclasses of its entity class
+	IsInherited() bool
+	// GetSeverity returns how serious a violation of the constraint is
+	GetSeverity() Severity
+	// GetMessage returns the egcl:message to use for violations in the given language, if the constraint has one
+	GetMessage(language string) (string, bool)
+	// IsDeactivated is true if the constraint has egcl:deactivated set and should not be checked
+	IsDeactivated() bool
+	// GetTags returns the egcl:tag values used to select the constraint in validation profiles
+	GetTags() []string
+	// IsDeprecated is true if data should no longer use what the constraint describes
+	IsDeprecated() bool
+	// GetReplacedBy returns what replaces a deprecated constraint, or an empty string
+	GetReplacedBy() string
+	// Check returns false and a violation if the entity does not satisfy the constraint
+	Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error)
+}
+
+// propertyClassConstraint is implemented by constraints on a single property or reference class
+type propertyClassConstraint interface {
+	GetConstrainedPropertyClass() (string, error)
+}
+
+// ConstraintFactory creates a constraint from a schema entity of the type it is registered for
+type ConstraintFactory func(entity *egdm.Entity) ConstraintType
+
+// ConstraintRegistry maps constraint rdf types to the factories used when loading a schema
+type ConstraintRegistry struct {
+	lock      sync.RWMutex
+	factories map[string]ConstraintFactory
+}
+
+// DefaultConstraintRegistry is used by NewSchema
+var DefaultConstraintRegistry = NewConstraintRegistry()
+
+// NewConstraintRegistry returns a registry with the built-in constraint kinds
+func NewConstraintRegistry() *ConstraintRegistry {
+	registry := &ConstraintRegistry{factories: make(map[string]ConstraintFactory)}
+	registry.Register(EGCLPropertyConstraint, func(entity *egdm.Entity) ConstraintType { return newPropertyConstraint(entity) })
+	registry.Register(EGCLReferenceConstraint, func(entity *egdm.Entity) ConstraintType { return newReferenceConstraint(entity) })
+	registry.Register(EGCLIsAbstractConstraint, func(entity *egdm.Entity) ConstraintType { return newIsAbstractConstraint(entity) })
+	registry.Register(EGCLApplicationConstraint, func(entity *egdm.Entity) ConstraintType { return newApplicationConstraint(entity) })
+	registry.Register(EGCLConditionalConstraint, func(entity *egdm.Entity) ConstraintType { return newConditionalConstraint(entity) })
+	registry.Register(EGCLPropertyComparisonConstraint, func(entity *egdm.Entity) ConstraintType { return newPropertyComparisonConstraint(entity) })
+	registry.Register(EGCLPathConstraint, func(entity *egdm.Entity) ConstraintType { return newPathConstraint(entity) })
+	for _, logicalType := range []string{EGCLAndConstraint, EGCLOrConstraint, EGCLXoneConstraint, EGCLNotConstraint} {
+		constraintTypeIdentifier := logicalType
+		registry.Register(constraintTypeIdentifier, func(entity *egdm.Entity) ConstraintType {
+			return newLogicalConstraint(entity, constraintTypeIdentifier)
+		})
+	}
+	return registry
+}
+
+// RegisterConstraintType adds a constraint kind to the default registry
+func RegisterConstraintType(typeURI string, factory ConstraintFactory) {
+	DefaultConstraintRegistry.Register(typeURI, factory)
+}
+
+// Register adds or replaces the factory for constraint entities of the given rdf type
+func (r *ConstraintRegistry) Register(typeURI string, factory ConstraintFactory) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.factories[typeURI] = factory
+}
+
+// NewConstraint creates a constraint for the first rdf type of the entity that has a factory, or returns nil
+func (r *ConstraintRegistry) NewConstraint(entity *egdm.Entity) ConstraintType {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, typeURI := range makeStringArray(entity.References[RDfTypeURI]) {
+		if factory, ok := r.factories[typeURI]; ok {
+			return factory(entity)
+		}
+	}
+	return nil
+}
+
+func (c *PropertyConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return validator.CheckPropertyConstraint(entity, c)
+}
+
+func (c *ReferenceConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return validator.CheckReferenceConstraint(schema, entity, c)
+}
+
+func (c *InverseReferenceConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return validator.CheckInverseReferenceConstraint(entity, c)
+}
+
+func (c *IsAbstractConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	// this checks if this entity is an implementation of a EntityClass that is defined as abstract
+	return validator.CheckEntityIsAbstractConstraint(schema, entity, c)
+}
+
+// Check always succeeds, application constraints name rules that are enforced by the consuming application
+func (c *ApplicationConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return true, nil, nil
+}
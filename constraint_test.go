@@ -0,0 +1,79 @@
+package egcl
+
+import (
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const testNoBlankIdConstraint = "http://data.mimiro.io/test/NoBlankIdConstraint"
+
+// noBlankIdConstraint is an extension constraint kind that rejects entities with an empty id
+type noBlankIdConstraint struct {
+	Constraint
+}
+
+func (c *noBlankIdConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	if entity.ID == "" {
+		return false, NewConstraintViolation(c, entity, MinPropertyOccurrenceNotMet, "entity has no id"), nil
+	}
+	return true, nil, nil
+}
+
+func TestRegisteredConstraintType(t *testing.T) {
+	reader := strings.NewReader(`[
+		{ "id" : "@context",
+			"namespaces" : {
+				"mimiro-schema" : "http://data.mimiro.io/schema/",
+				"test" : "http://data.mimiro.io/test/",
+				"egcl" : "http://data.mimiro.io/egcl/",
+				"rdf" : "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+			}
+		},
+		{ "id" : "mimiro-schema:Thing", "refs" : { "rdf:type" : [ "egcl:EntityClass" ] } },
+		{ "id" : "mimiro-schema:Person", "refs" : { "rdf:type" : [ "egcl:EntityClass" ], "egcl:subClassOf" : "mimiro-schema:Thing" } },
+		{ "id" : "mimiro-schema:constraint-1",
+			"refs" : { "rdf:type" : [ "test:NoBlankIdConstraint" ], "egcl:entityClass" : "mimiro-schema:Thing" } }
+	]`)
+
+	ec, err := newParser().LoadEntityCollection(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown to the default registry
+	if len(NewSchema(ec).Constraints) != 0 {
+		t.Fatal("expected unregistered constraint type to be ignored")
+	}
+
+	registry := NewConstraintRegistry()
+	registry.Register(testNoBlankIdConstraint, func(entity *egdm.Entity) ConstraintType {
+		c := &noBlankIdConstraint{}
+		c.Entity = entity
+		c.ConstraintTypeIdentifier = testNoBlankIdConstraint
+		return c
+	})
+	schema := NewSchemaWithRegistry(ec, registry)
+
+	if len(schema.Constraints) != 1 {
+		t.Fatalf("expected 1 constraint, got %d", len(schema.Constraints))
+	}
+	constraint := schema.Constraints[0]
+	if constraint.GetID() != "http://data.mimiro.io/schema/constraint-1" || constraint.GetTypeIdentifier() != testNoBlankIdConstraint {
+		t.Errorf("unexpected constraint %s of type %s", constraint.GetID(), constraint.GetTypeIdentifier())
+	}
+	if constraint.GetAppliesToEntityClass() != "http://data.mimiro.io/schema/Thing" {
+		t.Errorf("unexpected entity class %s", constraint.GetAppliesToEntityClass())
+	}
+
+	entity := egdm.NewEntity()
+	entity.SetReference(RDfTypeURI, "http://data.mimiro.io/schema/Person")
+	ok, violations, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(schema, entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || len(violations) != 1 || violations[0].Constraint != constraint {
+		t.Errorf("expected inherited extension constraint to be violated, got %v", violations)
+	}
+}
@@ -0,0 +1,280 @@
+package egcl
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ChangeType classifies a difference between two versions of a schema
+type ChangeType int
+
+const (
+	EntityClassAdded ChangeType = iota
+	EntityClassRemoved
+	SuperclassAdded
+	SuperclassRemoved
+	PropertyAdded
+	RequiredPropertyAdded
+	PropertyRemoved
+	CardinalityChanged
+	DatatypeChanged
+	ReferencedClassChanged
+)
+
+var changeTypeNames = map[ChangeType]string{
+	EntityClassAdded:       "EntityClassAdded",
+	EntityClassRemoved:     "EntityClassRemoved",
+	SuperclassAdded:        "SuperclassAdded",
+	SuperclassRemoved:      "SuperclassRemoved",
+	PropertyAdded:          "PropertyAdded",
+	RequiredPropertyAdded:  "RequiredPropertyAdded",
+	PropertyRemoved:        "PropertyRemoved",
+	CardinalityChanged:     "CardinalityChanged",
+	DatatypeChanged:        "DatatypeChanged",
+	ReferencedClassChanged: "ReferencedClassChanged",
+}
+
+func (t ChangeType) String() string {
+	if name, ok := changeTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// MarshalText writes the change type by name in JSON
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// SchemaChange is a single difference between two schemas. Breaking changes can make data that is valid for the old
+// schema invalid for the new one.
+type SchemaChange struct {
+	ChangeType  ChangeType `json:"changeType"`
+	Breaking    bool       `json:"breaking"`
+	EntityClass string     `json:"entityClass"`
+	// Property is the property or reference class the change is about, empty for class level changes
+	Property string `json:"property,omitempty"`
+	// Old and New hold the changed value, like a cardinality or datatype
+	Old         any    `json:"old,omitempty"`
+	New         any    `json:"new,omitempty"`
+	Description string `json:"description"`
+}
+
+// SchemaDiff holds the changes from one schema to another, ordered by entity class and property
+type SchemaDiff struct {
+	Changes []*SchemaChange `json:"changes"`
+}
+
+// IsBreaking is true if any of the changes is breaking
+func (d *SchemaDiff) IsBreaking() bool {
+	for _, change := range d.Changes {
+		if change.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBreakingChanges returns the changes that can make existing data invalid
+func (d *SchemaDiff) GetBreakingChanges() []*SchemaChange {
+	changes := make([]*SchemaChange, 0)
+	for _, change := range d.Changes {
+		if change.Breaking {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// propertySummary is the combined cardinality, datatype and referenced class of the property and reference
+// constraints a class has on one property
+type propertySummary struct {
+	isReference     bool
+	minCard         int
+	maxCard         int
+	datatype        string
+	referencedClass string
+}
+
+// DiffSchemas compares two versions of a schema. It reports added and removed entity classes, changed superclasses, and
+// added, removed and changed property and reference constraints that the classes declare themselves. Each change is
+// classified as breaking when data that is valid for the old schema may not be valid for the new one. Removing a
+// property or class is not breaking, as data with it still validates, unless it is validated with a closed world.
+func DiffSchemas(oldSchema *Schema, newSchema *Schema) *SchemaDiff {
+	diff := &SchemaDiff{Changes: make([]*SchemaChange, 0)}
+	add := func(change *SchemaChange) {
+		diff.Changes = append(diff.Changes, change)
+	}
+
+	for _, oldClass := range oldSchema.EntityClasses {
+		classId := oldClass.Entity.ID
+		if newSchema.GetEntityClassById(classId) == nil {
+			add(&SchemaChange{ChangeType: EntityClassRemoved, EntityClass: classId,
+				Description: fmt.Sprintf("entity class %s was removed", oldSchema.displayName(classId))})
+		}
+	}
+
+	for _, newClass := range newSchema.EntityClasses {
+		classId := newClass.Entity.ID
+		oldClass := oldSchema.GetEntityClassById(classId)
+		if oldClass == nil {
+			add(&SchemaChange{ChangeType: EntityClassAdded, EntityClass: classId,
+				Description: fmt.Sprintf("entity class %s was added", newSchema.displayName(classId))})
+			continue
+		}
+
+		oldSuperclasses := toSet(oldClass.GetSuperclasses())
+		newSuperclasses := toSet(newClass.GetSuperclasses())
+		for superclass := range newSuperclasses {
+			if !oldSuperclasses[superclass] {
+				// the constraints of the new superclass now apply to existing instances
+				breaking := false
+				for _, constraint := range newSchema.GetConstraintsForEntityClass(superclass, true) {
+					breaking = breaking || constraint.IsInherited()
+				}
+				add(&SchemaChange{ChangeType: SuperclassAdded, Breaking: breaking, EntityClass: classId, New: superclass,
+					Description: fmt.Sprintf("%s is now a subclass of %s", newSchema.displayName(classId), newSchema.displayName(superclass))})
+			}
+		}
+		for superclass := range oldSuperclasses {
+			if !newSuperclasses[superclass] {
+				// references that require the superclass no longer accept instances of the class
+				add(&SchemaChange{ChangeType: SuperclassRemoved, Breaking: true, EntityClass: classId, Old: superclass,
+					Description: fmt.Sprintf("%s is no longer a subclass of %s", newSchema.displayName(classId), newSchema.displayName(superclass))})
+			}
+		}
+
+		diffProperties(oldSchema, newSchema, classId, add)
+	}
+
+	sort.SliceStable(diff.Changes, func(i, j int) bool {
+		a, b := diff.Changes[i], diff.Changes[j]
+		if a.EntityClass != b.EntityClass {
+			return a.EntityClass < b.EntityClass
+		}
+		if a.Property != b.Property {
+			return a.Property < b.Property
+		}
+		return a.ChangeType < b.ChangeType
+	})
+	return diff
+}
+
+func diffProperties(oldSchema *Schema, newSchema *Schema, classId string, add func(*SchemaChange)) {
+	oldProperties := summarizeProperties(oldSchema, classId)
+	newProperties := summarizeProperties(newSchema, classId)
+	className := newSchema.displayName(classId)
+
+	for property := range oldProperties {
+		if _, ok := newProperties[property]; !ok {
+			add(&SchemaChange{ChangeType: PropertyRemoved, EntityClass: classId, Property: property,
+				Description: fmt.Sprintf("%s no longer has %s", className, oldSchema.displayName(property))})
+		}
+	}
+
+	for property, newSummary := range newProperties {
+		propertyName := newSchema.displayName(property)
+		oldSummary, ok := oldProperties[property]
+		if !ok {
+			if newSummary.minCard > 0 {
+				add(&SchemaChange{ChangeType: RequiredPropertyAdded, Breaking: true, EntityClass: classId, Property: property,
+					New: newSummary.minCard, Description: fmt.Sprintf("%s requires %s", className, propertyName)})
+			} else {
+				add(&SchemaChange{ChangeType: PropertyAdded, EntityClass: classId, Property: property,
+					Description: fmt.Sprintf("%s has optional %s", className, propertyName)})
+			}
+			continue
+		}
+
+		if oldSummary.minCard != newSummary.minCard || oldSummary.maxCard != newSummary.maxCard {
+			breaking := newSummary.minCard > oldSummary.minCard ||
+				(newSummary.maxCard >= 0 && (oldSummary.maxCard < 0 || newSummary.maxCard < oldSummary.maxCard))
+			add(&SchemaChange{ChangeType: CardinalityChanged, Breaking: breaking, EntityClass: classId, Property: property,
+				Old: formatCardinality(oldSummary), New: formatCardinality(newSummary),
+				Description: fmt.Sprintf("%s of %s changed cardinality from %s to %s", propertyName, className,
+					formatCardinality(oldSummary), formatCardinality(newSummary))})
+		}
+
+		if !newSummary.isReference && oldSummary.datatype != newSummary.datatype {
+			add(&SchemaChange{ChangeType: DatatypeChanged, Breaking: newSummary.datatype != EGCLAny, EntityClass: classId,
+				Property: property, Old: oldSummary.datatype, New: newSummary.datatype,
+				Description: fmt.Sprintf("%s of %s changed datatype from %s to %s", propertyName, className,
+					newSchema.displayName(oldSummary.datatype), newSchema.displayName(newSummary.datatype))})
+		}
+
+		if newSummary.isReference && oldSummary.referencedClass != newSummary.referencedClass {
+			// widening to a superclass of the old class, or to no restriction, keeps existing references valid
+			breaking := newSummary.referencedClass != "" &&
+				(oldSummary.referencedClass == "" || !newSchema.IsSubClassOf(oldSummary.referencedClass, newSummary.referencedClass))
+			add(&SchemaChange{ChangeType: ReferencedClassChanged, Breaking: breaking, EntityClass: classId,
+				Property: property, Old: oldSummary.referencedClass, New: newSummary.referencedClass,
+				Description: fmt.Sprintf("%s of %s changed referenced class from %s to %s", propertyName, className,
+					newSchema.displayName(oldSummary.referencedClass), newSchema.displayName(newSummary.referencedClass))})
+		}
+	}
+}
+
+// summarizeProperties combines the property and reference constraints the class declares itself by property class
+func summarizeProperties(schema *Schema, classId string) map[string]*propertySummary {
+	summaries := make(map[string]*propertySummary)
+	summary := func(property string, isReference bool) *propertySummary {
+		s, ok := summaries[property]
+		if !ok {
+			s = &propertySummary{isReference: isReference, maxCard: -1}
+			if !isReference {
+				s.datatype = EGCLAny
+			}
+			summaries[property] = s
+		}
+		return s
+	}
+	combine := func(s *propertySummary, minCard int, maxCard int) {
+		if minCard > s.minCard {
+			s.minCard = minCard
+		}
+		if maxCard >= 0 && (s.maxCard < 0 || maxCard < s.maxCard) {
+			s.maxCard = maxCard
+		}
+	}
+
+	for _, candidate := range schema.constraintsForEntityClass(classId, false) {
+		switch constraint := candidate.(type) {
+		case *PropertyConstraint:
+			property, err := constraint.GetConstrainedPropertyClass()
+			if err != nil {
+				continue
+			}
+			s := summary(property, false)
+			combine(s, constraint.GetMinAllowedOccurrences(), constraint.GetMaxAllowedOccurrences())
+			if datatype := constraint.GetDataType(); datatype != EGCLAny {
+				s.datatype = datatype
+			}
+		case *ReferenceConstraint:
+			property, err := constraint.GetConstrainedPropertyClass()
+			if err != nil {
+				continue
+			}
+			s := summary(property, true)
+			combine(s, constraint.GetMinAllowedOccurrences(), constraint.GetMaxAllowedOccurrences())
+			if referencedClass, err := constraint.GetAllowedReferencedClass(); err == nil {
+				s.referencedClass = referencedClass
+			}
+		}
+	}
+	return summaries
+}
+
+func formatCardinality(s *propertySummary) string {
+	if s.maxCard < 0 {
+		return fmt.Sprintf("%d..*", s.minCard)
+	}
+	return fmt.Sprintf("%d..%d", s.minCard, s.maxCard)
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
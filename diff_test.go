@@ -0,0 +1,151 @@
+package egcl
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const diffOldSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    xsd: http://www.w3.org/2001/XMLSchema#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Thing
+  propertyConstraints:
+    - propertyClass: model:label
+      minCard: 1
+
+- id: model:Unit
+
+- id: model:Person
+  propertyConstraints:
+    - propertyClass: model:name
+      datatype: xsd:string
+      maxCard: 1
+    - propertyClass: model:age
+      datatype: xsd:int
+    - propertyClass: model:nickname
+      minCard: 1
+      maxCard: 1
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      referencedEntityClass: model:Unit
+
+- id: model:Legacy
+`
+
+const diffNewSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    xsd: http://www.w3.org/2001/XMLSchema#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Thing
+  propertyConstraints:
+    - propertyClass: model:label
+      minCard: 1
+
+- id: model:Unit
+  superclasses: [model:Organisation]
+
+- id: model:Organisation
+
+- id: model:Person
+  superclasses: [model:Thing]
+  propertyConstraints:
+    - propertyClass: model:name
+      datatype: xsd:string
+      minCard: 1
+      maxCard: 1
+    - propertyClass: model:age
+    - propertyClass: model:nickname
+      maxCard: 2
+    - propertyClass: model:email
+    - propertyClass: model:birthDate
+      minCard: 1
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      referencedEntityClass: model:Organisation
+`
+
+func TestDiffSchemas(t *testing.T) {
+	oldSchema, err := NewSchemaFromYaml(diffOldSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSchema, err := NewSchemaFromYaml(diffNewSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := DiffSchemas(oldSchema, newSchema)
+	type key struct {
+		changeType ChangeType
+		subject    string
+	}
+	got := make(map[key]bool)
+	for _, change := range diff.Changes {
+		subject := strings.TrimPrefix(change.EntityClass, "http://data.mimiro.io/amodel/")
+		if change.Property != "" {
+			subject += "." + strings.TrimPrefix(change.Property, "http://data.mimiro.io/amodel/")
+		}
+		got[key{change.ChangeType, subject}] = change.Breaking
+	}
+
+	expected := map[key]bool{
+		{EntityClassRemoved, "Legacy"}:              false,
+		{EntityClassAdded, "Organisation"}:          false,
+		{SuperclassAdded, "Person"}:                 true,
+		{SuperclassAdded, "Unit"}:                   false,
+		{CardinalityChanged, "Person.name"}:         true,
+		{DatatypeChanged, "Person.age"}:             false,
+		{CardinalityChanged, "Person.nickname"}:     false,
+		{PropertyAdded, "Person.email"}:             false,
+		{RequiredPropertyAdded, "Person.birthDate"}: true,
+		{ReferencedClassChanged, "Person.worksFor"}: false,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d changes, got %v", len(expected), got)
+	}
+	for k, breaking := range expected {
+		actual, ok := got[k]
+		if !ok {
+			t.Errorf("expected %v on %s", k.changeType, k.subject)
+		} else if actual != breaking {
+			t.Errorf("expected %v on %s to have breaking %v", k.changeType, k.subject, breaking)
+		}
+	}
+	if !diff.IsBreaking() || len(diff.GetBreakingChanges()) != 3 {
+		t.Errorf("expected 3 breaking changes, got %d", len(diff.GetBreakingChanges()))
+	}
+
+	// the reverse direction narrows the reference and removes properties
+	reverse := DiffSchemas(newSchema, oldSchema)
+	for _, change := range reverse.Changes {
+		if change.ChangeType == ReferencedClassChanged && !change.Breaking {
+			t.Error("expected narrowing the referenced class to be breaking")
+		}
+		// data valid for the old schema still validates when a property or class is no longer described
+		if (change.ChangeType == PropertyRemoved || change.ChangeType == EntityClassRemoved) && change.Breaking {
+			t.Errorf("expected removing %s %s to not be breaking", change.EntityClass, change.Property)
+		}
+	}
+
+	if len(DiffSchemas(oldSchema, oldSchema).Changes) != 0 {
+		t.Error("expected no changes when comparing a schema with itself")
+	}
+
+	data, err := json.Marshal(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"changeType":"RequiredPropertyAdded"`) {
+		t.Errorf("expected change types by name in %s", data)
+	}
+}
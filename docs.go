@@ -0,0 +1,152 @@
+package egcl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// GenerateMarkdown writes browseable documentation of the schema as Markdown. It lists the schema metadata, and for
+// each entity class its description, superclasses and the properties and references constrained by the class itself.
+// Deprecated schemas, classes and properties are marked, together with what replaces them.
+func GenerateMarkdown(schema *Schema, writer io.Writer) error {
+	w := &markdownWriter{writer: writer}
+
+	title := schema.Title
+	if title == "" {
+		title = "Schema"
+	}
+	w.printf("# %s\n\n", title)
+	if schema.Deprecated {
+		w.printf("> **Deprecated**%s\n\n", deprecationDates(schema.DeprecationDate, schema.RemovalDate))
+	}
+	if schema.Description != "" {
+		w.printf("%s\n\n", schema.Description)
+	}
+	for _, field := range [][2]string{
+		{"Version", schema.Version},
+		{"Base URI", schema.BaseURI},
+		{"Owners", strings.Join(schema.Owners, ", ")},
+	} {
+		if field[1] != "" {
+			w.printf("- %s: %s\n", field[0], field[1])
+		}
+	}
+	if schema.Version != "" || schema.BaseURI != "" || len(schema.Owners) > 0 {
+		w.printf("\n")
+	}
+
+	for _, entityClass := range schema.EntityClasses {
+		classId := entityClass.Entity.ID
+		w.printf("## %s\n\n", schema.displayName(classId))
+		w.printf("`%s`\n\n", classId)
+		if entityClass.IsDeprecated() {
+			w.printf("> **Deprecated**%s\n\n", replacement(schema, entityClass.GetReplacedBy()))
+		}
+		if description := entityClass.GetDescription(); description != "" {
+			w.printf("%s\n\n", description)
+		}
+		if superclasses := entityClass.GetSuperclasses(); len(superclasses) > 0 {
+			names := make([]string, len(superclasses))
+			for i, superclass := range superclasses {
+				names[i] = schema.displayName(superclass)
+			}
+			w.printf("Subclass of %s\n\n", strings.Join(names, ", "))
+		}
+		if schema.IsAbstract(entityClass) {
+			w.printf("Abstract class\n\n")
+		}
+
+		rows := make([]string, 0)
+		for _, constraint := range schema.constraintsForEntityClass(classId, false) {
+			if row, ok := markdownConstraintRow(schema, constraint); ok {
+				rows = append(rows, row)
+			}
+		}
+		if len(rows) > 0 {
+			w.printf("| Property | Kind | Cardinality | Type | Notes |\n")
+			w.printf("| --- | --- | --- | --- | --- |\n")
+			for _, row := range rows {
+				w.printf("%s\n", row)
+			}
+			w.printf("\n")
+		}
+	}
+	return w.err
+}
+
+func markdownConstraintRow(schema *Schema, constraint ConstraintType) (string, bool) {
+	var property, kind, valueType string
+	var minCard, maxCard int
+	switch c := constraint.(type) {
+	case *PropertyConstraint:
+		property, _ = c.GetConstrainedPropertyClass()
+		kind = "property"
+		minCard, maxCard = c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences()
+		if datatype := c.GetDataType(); datatype != EGCLAny {
+			valueType = schema.displayName(datatype)
+		}
+	case *ReferenceConstraint:
+		property, _ = c.GetConstrainedPropertyClass()
+		kind = "reference"
+		minCard, maxCard = c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences()
+		if referencedClass, err := c.GetAllowedReferencedClass(); err == nil {
+			valueType = schema.displayName(referencedClass)
+		}
+	default:
+		return "", false
+	}
+	if property == "" {
+		return "", false
+	}
+
+	cardinality := fmt.Sprintf("%d..*", minCard)
+	if maxCard >= 0 {
+		cardinality = fmt.Sprintf("%d..%d", minCard, maxCard)
+	}
+
+	notes := make([]string, 0)
+	if constraint.IsDeprecated() {
+		notes = append(notes, "**Deprecated**"+replacement(schema, constraint.GetReplacedBy()))
+	}
+	if constraint.IsDeactivated() {
+		notes = append(notes, "deactivated")
+	}
+	if severity := constraint.GetSeverity(); severity != DefaultSeverity {
+		notes = append(notes, severity.String())
+	}
+
+	return fmt.Sprintf("| %s | %s | %s | %s | %s |", schema.displayName(property), kind, cardinality, valueType,
+		strings.Join(notes, ", ")), true
+}
+
+func replacement(schema *Schema, replacedBy string) string {
+	if replacedBy == "" {
+		return ""
+	}
+	return fmt.Sprintf(", replaced by %s", schema.displayName(replacedBy))
+}
+
+func deprecationDates(deprecationDate string, removalDate string) string {
+	dates := ""
+	if deprecationDate != "" {
+		dates += " since " + deprecationDate
+	}
+	if removalDate != "" {
+		dates += ", to be removed " + removalDate
+	}
+	return dates
+}
+
+// markdownWriter keeps the first write error so that the documentation can be written without checking every line
+type markdownWriter struct {
+	writer io.Writer
+	err    error
+}
+
+func (w *markdownWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.writer, format, args...)
+}
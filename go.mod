@@ -11,6 +11,7 @@ require github.com/franela/goblin v0.0.0-20211003143422-0a4f594942bf
 require (
 	github.com/mimiro-io/datahub-client-sdk-go v0.1.1
 	github.com/mimiro-io/entity-graph-data-model v0.7.4
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
 
 require (
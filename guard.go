@@ -0,0 +1,188 @@
+package egcl
+
+import (
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const (
+	EGCLConstraintViolation = EGCLUriExpansion + "ConstraintViolation"
+	EGCLviolation           = EGCLUriExpansion + "violation"
+	EGCLviolationType       = EGCLUriExpansion + "violationType"
+	EGCLconstraint          = EGCLUriExpansion + "constraint"
+	EGCLproperty            = EGCLUriExpansion + "property"
+)
+
+var (
+	ErrBatchRejected = errors.New("batch rejected")
+)
+
+// EntityStore stores entity collections in a dataset, it is implemented by *datahub.Client
+type EntityStore interface {
+	StoreEntities(dataset string, entities *egdm.EntityCollection) error
+}
+
+// IngestGuard validates batches of entities before they are stored. Each batch is split into valid and invalid
+// entities, the invalid ones are annotated with their violations and can be written to a quarantine dataset.
+// Thresholds on the number or share of invalid entities reject the whole batch.
+type IngestGuard struct {
+	validator       *Validator
+	schema          *Schema
+	store           EntityStore
+	quarantine      string
+	maxInvalid      int
+	maxInvalidRatio float64
+}
+
+// GuardResult is the outcome of checking a batch. Invalid holds annotated copies of the invalid entities.
+type GuardResult struct {
+	Valid      *egdm.EntityCollection
+	Invalid    *egdm.EntityCollection
+	Violations []*ConstraintViolation
+	// Rejected is true when the batch exceeded a threshold, nothing is stored for a rejected batch
+	Rejected bool
+}
+
+func NewIngestGuard(validator *Validator, schema *Schema) *IngestGuard {
+	return &IngestGuard{validator: validator, schema: schema, maxInvalid: -1}
+}
+
+// WithStore sets where guarded batches and quarantined entities are stored
+func (g *IngestGuard) WithStore(store EntityStore) *IngestGuard {
+	g.store = store
+	return g
+}
+
+// WithQuarantine sets the dataset invalid entities are written to
+func (g *IngestGuard) WithQuarantine(dataset string) *IngestGuard {
+	g.quarantine = dataset
+	return g
+}
+
+// WithMaxInvalid rejects batches with more invalid entities, 0 rejects any batch with an invalid entity
+func (g *IngestGuard) WithMaxInvalid(maxInvalid int) *IngestGuard {
+	g.maxInvalid = maxInvalid
+	return g
+}
+
+// WithMaxInvalidRatio rejects batches where a larger share of the entities is invalid, like 0.1 for ten percent
+func (g *IngestGuard) WithMaxInvalidRatio(ratio float64) *IngestGuard {
+	g.maxInvalidRatio = ratio
+	return g
+}
+
+// Check validates the batch with ValidateEntityCollection and splits it. Entities are invalid when they have a
+// violation at or above the validator's severity threshold. Unless the batch is rejected, the invalid entities are
+// written to the quarantine dataset if one is set. A rejected batch returns ErrBatchRejected together with the result.
+func (g *IngestGuard) Check(entities *egdm.EntityCollection) (*GuardResult, error) {
+	_, violations, err := g.validator.ValidateEntityCollection(g.schema, entities)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make(map[string][]*ConstraintViolation)
+	for _, violation := range violations {
+		if violation.Entity != nil && g.validator.isFailure(violation) {
+			failures[violation.Entity.ID] = append(failures[violation.Entity.ID], violation)
+		}
+	}
+
+	result := &GuardResult{
+		Valid:      egdm.NewEntityCollection(entities.NamespaceManager),
+		Invalid:    egdm.NewEntityCollection(entities.NamespaceManager),
+		Violations: violations,
+	}
+	for _, entity := range entities.Entities {
+		entityFailures, invalid := failures[entity.ID]
+		if !invalid {
+			_ = result.Valid.AddEntity(entity)
+			continue
+		}
+		annotated := *entity
+		annotated.Properties = make(map[string]any, len(entity.Properties)+1)
+		for key, value := range entity.Properties {
+			annotated.Properties[key] = value
+		}
+		annotations := make([]any, 0, len(entityFailures))
+		for _, violation := range entityFailures {
+			annotations = append(annotations, newViolationEntity(violation))
+		}
+		annotated.Properties[EGCLviolation] = annotations
+		_ = result.Invalid.AddEntity(&annotated)
+	}
+
+	invalid := len(result.Invalid.Entities)
+	if (g.maxInvalid >= 0 && invalid > g.maxInvalid) ||
+		(g.maxInvalidRatio > 0 && len(entities.Entities) > 0 && float64(invalid)/float64(len(entities.Entities)) > g.maxInvalidRatio) {
+		result.Rejected = true
+		return result, errors.Wrapf(ErrBatchRejected, "%d of %d entities are invalid", invalid, len(entities.Entities))
+	}
+
+	if g.quarantine != "" && invalid > 0 {
+		if g.store == nil {
+			return nil, errors.New("no store configured for the quarantine dataset")
+		}
+		quarantined, err := compactAnnotatedEntities(result.Invalid.Entities)
+		if err != nil {
+			return nil, errors.Wrapf(err, "quarantine of %d entities", invalid)
+		}
+		if err := g.store.StoreEntities(g.quarantine, quarantined); err != nil {
+			return nil, errors.Wrapf(err, "quarantine of %d entities", invalid)
+		}
+	}
+	return result, nil
+}
+
+// Ingest checks the batch and stores the valid entities in the dataset
+func (g *IngestGuard) Ingest(dataset string, entities *egdm.EntityCollection) (*GuardResult, error) {
+	if g.store == nil {
+		return nil, errors.New("no store configured")
+	}
+	result, err := g.Check(entities)
+	if err != nil {
+		return result, err
+	}
+	if len(result.Valid.Entities) > 0 {
+		if err := g.store.StoreEntities(dataset, result.Valid); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// newViolationEntity describes a violation as an egcl:ConstraintViolation entity
+func newViolationEntity(violation *ConstraintViolation) *egdm.Entity {
+	entity := egdm.NewEntity()
+	entity.SetReference(RDfTypeURI, EGCLConstraintViolation)
+	entity.SetProperty(EGCLviolationType, violation.ViolationType.String())
+	entity.SetProperty(EGCLmessage, violation.Message)
+	entity.SetReference(EGCLseverity, violation.Severity.URI())
+	if violation.Constraint != nil {
+		entity.SetReference(EGCLconstraint, violation.Constraint.GetID())
+	}
+	if violation.EntityClass != "" {
+		entity.SetReference(EGCLentityClass, violation.EntityClass)
+	}
+	if violation.Property != "" {
+		entity.SetReference(EGCLproperty, violation.Property)
+	}
+	return entity
+}
+
+// compactAnnotatedEntities copies entities with egcl annotations into a collection with prefixed identifiers, the way
+// quarantined entities and validation annotations are stored. Nested violation entities are compacted as well.
+func compactAnnotatedEntities(entities []*egdm.Entity) (*egdm.EntityCollection, error) {
+	nsm := egdm.NewNamespaceContext()
+	nsm.StorePrefixExpansionMapping("egcl", EGCLUriExpansion)
+	compacted := egdm.NewEntityCollection(nsm)
+	for _, entity := range entities {
+		c, err := compactEntity(nsm, entity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "compacting %s", entity.ID)
+		}
+		if err := compacted.AddEntity(c); err != nil {
+			return nil, err
+		}
+	}
+	return compacted, nil
+}
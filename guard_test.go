@@ -0,0 +1,93 @@
+package egcl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+var _ EntityStore = (*datahub.Client)(nil)
+
+type memoryStore map[string][]*egdm.Entity
+
+func (s memoryStore) StoreEntities(dataset string, entities *egdm.EntityCollection) error {
+	s[dataset] = append(s[dataset], entities.Entities...)
+	return nil
+}
+
+func TestIngestGuard(t *testing.T) {
+	schema, err := parseYaml([]byte(qualitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := func() *egdm.EntityCollection {
+		ec := egdm.NewEntityCollection(nil)
+		for _, id := range []string{"alice", "bob", "carol", "dave"} {
+			e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+			e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+			if id != "bob" {
+				e.SetProperty("http://data.mimiro.io/amodel/name", id)
+			}
+			_ = ec.AddEntity(e)
+		}
+		return ec
+	}
+
+	// the quarantine is written and read back as entity graph JSON, as a datahub stores it
+	store := &jsonDatasetStore{datasets: make(map[string]*egdm.EntityCollection)}
+	_ = store.AddDataset("people", nil)
+	_ = store.AddDataset("people.quarantine", nil)
+	guard := NewIngestGuard(NewValidator(), schema).WithStore(store).WithQuarantine("people.quarantine").WithMaxInvalid(1)
+	result, err := guard.Ingest("people", batch())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Valid.Entities) != 3 || len(result.Invalid.Entities) != 1 || len(store.datasets["people"].Entities) != 3 {
+		t.Fatalf("expected 3 valid entities stored and 1 invalid, got %d, %d and %d stored",
+			len(result.Valid.Entities), len(result.Invalid.Entities), len(store.datasets["people"].Entities))
+	}
+
+	quarantined := store.datasets["people.quarantine"].Entities
+	if len(quarantined) != 1 || quarantined[0].ID != "http://data.mimiro.io/things/bob" {
+		t.Fatalf("expected bob in quarantine, got %v", quarantined)
+	}
+	annotations, _ := quarantined[0].Properties[EGCLviolation].([]any)
+	if len(annotations) != 1 {
+		t.Fatalf("expected one violation annotation, got %v", quarantined[0].Properties[EGCLviolation])
+	}
+	annotation, _ := annotations[0].(*egdm.Entity)
+	if annotation == nil || annotation.Properties[EGCLviolationType] != "MinPropertyOccurrenceNotMet" ||
+		annotation.References[EGCLseverity] != EGCLViolation || annotation.References[RDfTypeURI] != EGCLConstraintViolation {
+		t.Errorf("unexpected annotation %+v", annotations[0])
+	}
+	if batchEntity := result.Valid.Entities[0]; batchEntity.Properties[EGCLviolation] != nil {
+		t.Errorf("expected valid entities to be left unannotated")
+	}
+
+	// quarantined entities are compacted like validation annotations, nested violations included
+	rawStore := memoryStore{}
+	if _, err := NewIngestGuard(NewValidator(), schema).WithStore(rawStore).WithQuarantine("people.quarantine").Check(batch()); err != nil {
+		t.Fatal(err)
+	}
+	raw := rawStore["people.quarantine"]
+	violations, _ := raw[0].Properties["egcl:violation"].([]any)
+	if len(violations) != 1 {
+		t.Fatalf("expected a compacted violation property, got %v", raw[0].Properties)
+	}
+	if violation := violations[0].(*egdm.Entity); violation.Properties["egcl:violationType"] == nil || violation.References["egcl:severity"] != "egcl:Violation" {
+		t.Errorf("expected a compacted violation entity, got %+v", violation)
+	}
+
+	// a ratio of a quarter invalid entities rejects the batch, nothing is stored
+	rejectedStore := memoryStore{}
+	guard = NewIngestGuard(NewValidator(), schema).WithStore(rejectedStore).WithQuarantine("people.quarantine").WithMaxInvalidRatio(0.2)
+	result, err = guard.Ingest("people", batch())
+	if !errors.Is(err, ErrBatchRejected) || !result.Rejected {
+		t.Fatalf("expected the batch to be rejected, got %v", err)
+	}
+	if len(rejectedStore) != 0 {
+		t.Errorf("expected nothing stored for a rejected batch, got %v", rejectedStore)
+	}
+}
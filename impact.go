@@ -0,0 +1,376 @@
+package egcl
+
+import (
+	"fmt"
+	"sort"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+// MaxDependentHopResults limits the number of dependents found through each reference of a changed entity
+const MaxDependentHopResults = 10000
+
+var (
+	// ErrTooManyDependents is returned when more than MaxDependentHopResults entities depend on a changed entity through
+	// one reference, validating the whole dataset is then the better option
+	ErrTooManyDependents = errors.New("too many dependents")
+)
+
+// dependencyHop is a reference a dependent that is an instance of one of the classes follows, inversely when inverse is
+// set, and then the rest of a path to reach a changed entity. Rest is nil when the changed entity is referenced directly.
+type dependencyHop struct {
+	reference string
+	inverse   bool
+	rest      PropertyPath
+	classes   []string
+}
+
+// dependencyHops lists the references through which a change to an entity can affect the validity of others:
+//   - entities referencing it through a reference constraint that checks the referenced entity, which is when related
+//     entities are validated or when references must be concepts of a scheme
+//   - entities that reach it through the path of a path constraint, at any step of the path
+//
+// Reference and path constraints nested in conditional and logical constraints are followed as well. Inverse
+// cardinalities are not validated, so the entities a changed entity references do not depend on it.
+func (v *Validator) dependencyHops(schema *Schema) []*dependencyHop {
+	validateRelated := v.settings != nil && v.settings.ValidateRelated
+	var namespaceManager egdm.NamespaceManager
+	if schema.EntityCollection != nil {
+		namespaceManager = schema.EntityCollection.NamespaceManager
+	}
+
+	hops := make([]*dependencyHop, 0)
+	byKey := make(map[string]*dependencyHop)
+	add := func(reference string, inverse bool, rest PropertyPath, class string) {
+		key := fmt.Sprintf("%s|%v", reference, inverse)
+		if rest != nil {
+			key += "|" + rest.String()
+		}
+		hop, ok := byKey[key]
+		if !ok {
+			hop = &dependencyHop{reference: reference, inverse: inverse, rest: rest}
+			byKey[key] = hop
+			hops = append(hops, hop)
+		}
+		if !containsString(hop.classes, class) {
+			hop.classes = append(hop.classes, class)
+		}
+	}
+
+	var walk func(constraint ConstraintType, class string, visited map[string]bool)
+	walk = func(constraint ConstraintType, class string, visited map[string]bool) {
+		if constraint == nil || visited[constraint.GetID()] {
+			return
+		}
+		visited[constraint.GetID()] = true
+
+		switch c := constraint.(type) {
+		case *ReferenceConstraint:
+			reference, err := c.GetConstrainedPropertyClass()
+			if err != nil {
+				return
+			}
+			if _, err := c.GetConceptScheme(); validateRelated || err == nil {
+				add(reference, false, nil, class)
+			}
+		case *PathConstraint:
+			path, otherPath, err := c.GetPaths(namespaceManager)
+			if err != nil {
+				return
+			}
+			for _, p := range []PropertyPath{path, otherPath} {
+				if p == nil {
+					continue
+				}
+				for _, step := range firstPathSteps(normalizePath(p, false)) {
+					add(step.reference, step.inverse, nil, class)
+					if step.rest != nil {
+						for _, prefix := range pathPrefixes(step.rest) {
+							add(step.reference, step.inverse, prefix, class)
+						}
+					}
+				}
+			}
+		case *ConditionalConstraint:
+			for _, id := range c.GetThenConstraintIds() {
+				walk(schema.GetConstraintById(id), class, visited)
+			}
+		case *LogicalConstraint:
+			for _, id := range c.GetMemberConstraintIds() {
+				walk(schema.GetConstraintById(id), class, visited)
+			}
+		}
+	}
+
+	for _, constraint := range schema.activeConstraints(schema.Constraints) {
+		if class := constraint.GetAppliesToEntityClass(); class != "" {
+			walk(constraint, class, make(map[string]bool))
+		}
+	}
+	return hops
+}
+
+// normalizePath moves inverses down to the predicates, so that ^(a/b) becomes ^b/^a
+func normalizePath(path PropertyPath, inverted bool) PropertyPath {
+	switch p := path.(type) {
+	case *PredicatePath:
+		if inverted {
+			return &InversePath{Path: p}
+		}
+		return p
+	case *InversePath:
+		return normalizePath(p.Path, !inverted)
+	case *SequencePath:
+		paths := make([]PropertyPath, len(p.Paths))
+		for i, step := range p.Paths {
+			if inverted {
+				paths[len(p.Paths)-1-i] = normalizePath(step, inverted)
+			} else {
+				paths[i] = normalizePath(step, inverted)
+			}
+		}
+		return &SequencePath{Paths: paths}
+	case *AlternativePath:
+		paths := make([]PropertyPath, len(p.Paths))
+		for i, alternative := range p.Paths {
+			paths[i] = normalizePath(alternative, inverted)
+		}
+		return &AlternativePath{Paths: paths}
+	case *ZeroOrMorePath:
+		return &ZeroOrMorePath{Path: normalizePath(p.Path, inverted)}
+	}
+	return path
+}
+
+// pathStep is a first predicate of a normalized path and the rest of the path after it
+type pathStep struct {
+	reference string
+	inverse   bool
+	rest      PropertyPath
+}
+
+// firstPathSteps lists the predicates a normalized path can start with
+func firstPathSteps(path PropertyPath) []pathStep {
+	switch p := path.(type) {
+	case *PredicatePath:
+		return []pathStep{{reference: p.Predicate}}
+	case *InversePath:
+		if predicate, ok := p.Path.(*PredicatePath); ok {
+			return []pathStep{{reference: predicate.Predicate, inverse: true}}
+		}
+	case *SequencePath:
+		if len(p.Paths) == 0 {
+			return nil
+		}
+		steps := make([]pathStep, 0)
+		for _, step := range firstPathSteps(p.Paths[0]) {
+			step.rest = sequencePath(append([]PropertyPath{step.rest}, p.Paths[1:]...)...)
+			steps = append(steps, step)
+		}
+		if canBeEmptyPath(p.Paths[0]) && len(p.Paths) > 1 {
+			steps = append(steps, firstPathSteps(sequencePath(p.Paths[1:]...))...)
+		}
+		return steps
+	case *AlternativePath:
+		steps := make([]pathStep, 0)
+		for _, alternative := range p.Paths {
+			steps = append(steps, firstPathSteps(alternative)...)
+		}
+		return steps
+	case *ZeroOrMorePath:
+		steps := firstPathSteps(p.Path)
+		for i := range steps {
+			steps[i].rest = sequencePath(steps[i].rest, p)
+		}
+		return steps
+	}
+	return nil
+}
+
+// pathPrefixes lists the paths that end at each step of a normalized path
+func pathPrefixes(path PropertyPath) []PropertyPath {
+	switch p := path.(type) {
+	case *SequencePath:
+		if len(p.Paths) == 0 {
+			return nil
+		}
+		prefixes := pathPrefixes(p.Paths[0])
+		if len(p.Paths) > 1 {
+			for _, prefix := range pathPrefixes(sequencePath(p.Paths[1:]...)) {
+				prefixes = append(prefixes, sequencePath(p.Paths[0], prefix))
+			}
+		}
+		return prefixes
+	case *AlternativePath:
+		prefixes := make([]PropertyPath, 0)
+		for _, alternative := range p.Paths {
+			prefixes = append(prefixes, pathPrefixes(alternative)...)
+		}
+		return prefixes
+	case *ZeroOrMorePath:
+		prefixes := make([]PropertyPath, 0)
+		for _, prefix := range pathPrefixes(p.Path) {
+			prefixes = append(prefixes, sequencePath(p, prefix))
+		}
+		return prefixes
+	}
+	return []PropertyPath{path}
+}
+
+// canBeEmptyPath is true when the path can be followed without taking a step
+func canBeEmptyPath(path PropertyPath) bool {
+	switch p := path.(type) {
+	case *ZeroOrMorePath:
+		return true
+	case *SequencePath:
+		for _, step := range p.Paths {
+			if !canBeEmptyPath(step) {
+				return false
+			}
+		}
+		return true
+	case *AlternativePath:
+		for _, alternative := range p.Paths {
+			if canBeEmptyPath(alternative) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sequencePath joins the paths that are not nil, returning nil when there are none
+func sequencePath(paths ...PropertyPath) PropertyPath {
+	steps := make([]PropertyPath, 0, len(paths))
+	for _, path := range paths {
+		if sequence, ok := path.(*SequencePath); ok {
+			steps = append(steps, sequence.Paths...)
+		} else if path != nil {
+			steps = append(steps, path)
+		}
+	}
+	switch len(steps) {
+	case 0:
+		return nil
+	case 1:
+		return steps[0]
+	}
+	return &SequencePath{Paths: steps}
+}
+
+// FindDependents returns the entities whose validity may change when the given entities change or are deleted,
+// ordered by id. They are found by following the references and paths of the schema's constraints back from the changed
+// entities through the data provider. Dependents that are themselves among the changed entities are left out. When more
+// than MaxDependentHopResults entities depend on a changed entity through one reference, ErrTooManyDependents is
+// returned instead of an incomplete list.
+func (v *Validator) FindDependents(schema *Schema, changedEntityIds []string) ([]*egdm.Entity, error) {
+	schema = v.profiledSchema(schema)
+	if v.dataProvider == nil {
+		return nil, errors.New("no data provider configured")
+	}
+	datasets := v.datasetsContext()
+	navigator := &providerNavigator{validator: v, schema: schema, root: egdm.NewEntity()}
+
+	changed := toSet(changedEntityIds)
+	dependents := make(map[string]*egdm.Entity)
+	hops := v.dependencyHops(schema)
+	for _, id := range changedEntityIds {
+		for _, hop := range hops {
+			// walk the rest of the path back from the changed entity to where the dependents follow the reference
+			nodes := []any{id}
+			if hop.rest != nil {
+				var err error
+				nodes, err = hop.rest.evaluate(nodes, navigator, true)
+				if err != nil {
+					return nil, errors.Wrapf(err, "dependents of %s through %s", id, hop.rest)
+				}
+			}
+			for _, node := range nodes {
+				nodeId, isId := node.(string)
+				if !isId {
+					continue
+				}
+				if err := v.addDependents(schema, nodeId, hop, datasets, changed, dependents); err != nil {
+					return nil, errors.Wrapf(err, "dependents of %s through %s", id, hop.reference)
+				}
+			}
+		}
+	}
+
+	result := make([]*egdm.Entity, 0, len(dependents))
+	for _, entity := range dependents {
+		result = append(result, entity)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+// addDependents adds the instances of the hop's classes that follow the hop's reference to the entity
+func (v *Validator) addDependents(schema *Schema, entityId string, hop *dependencyHop, datasets []string, changed map[string]bool, dependents map[string]*egdm.Entity) error {
+	iterator, err := v.dataProvider.Hop(entityId, hop.reference, datasets, !hop.inverse, MaxDependentHopResults+1)
+	if err != nil {
+		return err
+	}
+	if iterator == nil {
+		return nil
+	}
+	count := 0
+	for {
+		entity, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+		if entity == nil {
+			return nil
+		}
+		count++
+		if count > MaxDependentHopResults {
+			return errors.Wrapf(ErrTooManyDependents, "more than %d entities", MaxDependentHopResults)
+		}
+		if entity.IsDeleted || changed[entity.ID] || dependents[entity.ID] != nil {
+			continue
+		}
+		types := makeStringArray(entity.References[RDfTypeURI])
+		for _, class := range hop.classes {
+			if schema.IsInstanceOfClass(types, class) {
+				dependents[entity.ID] = entity
+				break
+			}
+		}
+	}
+}
+
+// ValidateDependents finds the dependents of the changed entities and re-validates exactly those. The result can be
+// applied to a ViolationState next to the result of validating the changes themselves.
+func (v *Validator) ValidateDependents(schema *Schema, changedEntityIds []string) (*IncrementalValidationResult, error) {
+	// the changed entities must be looked up again when the dependents check their references
+	if v.resolver != nil {
+		v.resolver.Invalidate(changedEntityIds)
+	}
+	dependents, err := v.FindDependents(schema, changedEntityIds)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IncrementalValidationResult{
+		Validated:  make([]string, 0),
+		Invalid:    make([]string, 0),
+		Deleted:    make([]string, 0),
+		Violations: make([]*ConstraintViolation, 0),
+	}
+	schema = v.profiledSchema(schema)
+	batchSize := v.batchSize()
+	for start := 0; start < len(dependents); start += batchSize {
+		end := start + batchSize
+		if end > len(dependents) {
+			end = len(dependents)
+		}
+		if err := v.validateChangedEntities(schema, dependents[start:end], result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,194 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const impactSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:EntityCollection
+
+- id: model:Entity
+  referenceConstraints:
+    - referenceClass: model:partOf
+      referencedEntityClass: model:EntityCollection
+      minCard: 1
+
+- id: model:Team
+
+- id: model:Member
+  referenceConstraints:
+    - referenceClass: model:memberOf
+      referencedEntityClass: model:Team
+      inverseReferenceClass: model:hasMember
+      inverseMinCard: 1
+`
+
+func TestValidateDependents(t *testing.T) {
+	schema, err := parseYaml([]byte(impactSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity := func(id string, class string, reference string, target string) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/"+class)
+		if reference != "" {
+			e.SetReference("http://data.mimiro.io/amodel/"+reference, "http://data.mimiro.io/things/"+target)
+		}
+		return e
+	}
+	collection := func(entities ...*egdm.Entity) *egdm.EntityCollection {
+		ec := egdm.NewEntityCollection(nil)
+		for _, e := range entities {
+			_ = ec.AddEntity(e)
+		}
+		return ec
+	}
+
+	items := []*egdm.Entity{
+		entity("e1", "Entity", "partOf", "c1"),
+		entity("e2", "Entity", "partOf", "c1"),
+		entity("e3", "Entity", "partOf", "c2"),
+		entity("t1", "Team", "", ""),
+		entity("m1", "Member", "memberOf", "t1"),
+	}
+	provider := NewCollectionDataProvider().
+		WithDataset("collections", collection(entity("c1", "EntityCollection", "", ""), entity("c2", "EntityCollection", "", ""))).
+		WithDataset("items", collection(items...))
+	validator := NewValidator().WithSettings(&ValidatorSettings{ValidateRelated: true}).WithDataProvider(provider)
+
+	dependents, err := validator.FindDependents(schema, []string{"http://data.mimiro.io/things/c1", "http://data.mimiro.io/things/m1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(dependents))
+	for i, dependent := range dependents {
+		ids[i] = dependent.ID
+	}
+	// t1 is referenced by m1, but its inverse cardinality is not validated so it does not depend on m1
+	expected := []string{"http://data.mimiro.io/things/e1", "http://data.mimiro.io/things/e2"}
+	if len(ids) != len(expected) {
+		t.Fatalf("expected dependents %v, got %v", expected, ids)
+	}
+	for i := range expected {
+		if ids[i] != expected[i] {
+			t.Errorf("expected dependents %v, got %v", expected, ids)
+		}
+	}
+
+	// validate once so that c1 is cached by the resolver, then delete it
+	if ok, _, err := validator.ValidateEntity(schema, items[0]); err != nil || !ok {
+		t.Fatalf("expected e1 to be valid before the delete, got %v %v", ok, err)
+	}
+	provider.WithDataset("collections", collection(entity("c2", "EntityCollection", "", "")))
+
+	result, err := validator.ValidateDependents(schema, []string{"http://data.mimiro.io/things/c1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Validated) != 2 || len(result.Invalid) != 2 || len(result.Violations) != 2 {
+		t.Fatalf("expected e1 and e2 to be re-validated and invalid, got %+v", result)
+	}
+	for _, violation := range result.Violations {
+		if violation.ViolationType != ReferenceNotFound {
+			t.Errorf("expected ReferenceNotFound, got %v", violation.ViolationType)
+		}
+	}
+
+	// without related validation nothing depends on the referenced collections
+	dependents, err = NewValidator().WithDataProvider(provider).FindDependents(schema, []string{"http://data.mimiro.io/things/c2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dependents) != 0 {
+		t.Errorf("expected no dependents, got %d", len(dependents))
+	}
+}
+
+const impactNestedSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Organisation
+
+- id: model:Department
+
+- id: model:Person
+  pathConstraints:
+    - path: model:worksFor/model:partOf
+      referencedEntityClass: model:Organisation
+      minCard: 1
+
+- id: model:Contract
+  conditionalConstraints:
+    - if:
+        propertyClass: model:status
+        equals: signed
+      then:
+        referenceConstraints:
+          - referenceClass: model:signedBy
+            referencedEntityClass: model:Person
+            minCard: 1
+`
+
+func TestFindDependentsThroughPathsAndConditions(t *testing.T) {
+	schema, err := parseYaml([]byte(impactNestedSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity := func(id string, class string, reference string, target string) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/"+class)
+		if reference != "" {
+			e.SetReference("http://data.mimiro.io/amodel/"+reference, "http://data.mimiro.io/things/"+target)
+		}
+		return e
+	}
+	ec := egdm.NewEntityCollection(nil)
+	contract := entity("k1", "Contract", "signedBy", "p1")
+	contract.SetProperty("http://data.mimiro.io/amodel/status", "signed")
+	for _, e := range []*egdm.Entity{
+		entity("o1", "Organisation", "", ""),
+		entity("o2", "Organisation", "", ""),
+		entity("d1", "Department", "partOf", "o1"),
+		entity("d2", "Department", "partOf", "o2"),
+		entity("p1", "Person", "worksFor", "d1"),
+		entity("p2", "Person", "worksFor", "d2"),
+		contract,
+	} {
+		_ = ec.AddEntity(e)
+	}
+	provider := NewCollectionDataProvider().WithDataset("things", ec)
+	validator := NewValidator().WithSettings(&ValidatorSettings{ValidateRelated: true}).WithDataProvider(provider)
+
+	for changed, expected := range map[string][]string{
+		// p1 reaches o1 through d1 at the second step of its path
+		"o1": {"http://data.mimiro.io/things/p1"},
+		// p2 reaches d2 at the first step of its path
+		"d2": {"http://data.mimiro.io/things/p2"},
+		// k1 references p1 through the reference constraint of its conditional constraint
+		"p1": {"http://data.mimiro.io/things/k1"},
+	} {
+		dependents, err := validator.FindDependents(schema, []string{"http://data.mimiro.io/things/" + changed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make([]string, len(dependents))
+		for i, dependent := range dependents {
+			ids[i] = dependent.ID
+		}
+		if len(ids) != len(expected) || (len(ids) > 0 && ids[0] != expected[0]) {
+			t.Errorf("expected dependents of %s to be %v, got %v", changed, expected, ids)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package egcl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const (
+	EGCLSchema  = EGCLUriExpansion + "Schema"
+	EGCLimports = EGCLUriExpansion + "imports"
+)
+
+var (
+	ErrConflictingDefinition = errors.New("entity is defined differently in two schemas")
+)
+
+// SchemaLoader reads the schema document at a location. Locations are file paths or URLs, relative imports are
+// resolved against the location of the importing document before they are passed to the loader.
+type SchemaLoader interface {
+	Load(location string) ([]byte, error)
+}
+
+// SchemaLoaderFunc lets a function be used as SchemaLoader
+type SchemaLoaderFunc func(location string) ([]byte, error)
+
+func (f SchemaLoaderFunc) Load(location string) ([]byte, error) {
+	return f(location)
+}
+
+// DefaultSchemaLoader reads http and https URLs with the default http client, and everything else from the file system
+var DefaultSchemaLoader SchemaLoader = SchemaLoaderFunc(loadSchemaDocument)
+
+func loadSchemaDocument(location string) ([]byte, error) {
+	if !isSchemaURL(location) {
+		return os.ReadFile(location)
+	}
+
+	resp, err := http.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("loading schema %s failed with status %s", location, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// LoadSchema loads the schema at the location together with the schemas it imports, directly or through other imports.
+// Documents ending in .yaml or .yml are read as YAML shorthand, those ending in .json as EGDM JSON, other documents are
+// detected from their content. Imports are listed with egcl:imports on an egcl:Schema entity, or under imports in the
+// YAML context. Each document is loaded once, so shared and circular imports are allowed. An entity class or constraint
+// that is defined differently in two documents gives ErrConflictingDefinition. The location of the document that
+// defines each class is set as its Source. If the loader is nil DefaultSchemaLoader is used.
+func LoadSchema(location string, loader SchemaLoader) (*Schema, error) {
+	return loadMergedSchema(location, loader, nil)
+}
+
+// loadMergedSchema loads the schema at the location with its imports, dataset locations are read from the provider
+func loadMergedSchema(location string, loader SchemaLoader, provider DataProvider) (*Schema, error) {
+	if loader == nil {
+		loader = DefaultSchemaLoader
+	}
+	merger := &schemaMerger{
+		loader:   loader,
+		provider: provider,
+		visited:  make(map[string]bool),
+		entities: make(map[string]*egdm.Entity),
+		sources:  make(map[string]string),
+		merged:   egdm.NewEntityCollection(nil),
+	}
+	if err := merger.load(location, true); err != nil {
+		return nil, err
+	}
+
+	schema, err := newCheckedSchema(merger.merged, DefaultConstraintRegistry)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading %s", location)
+	}
+	for _, entityClass := range schema.EntityClasses {
+		entityClass.Source = merger.sources[entityClass.Entity.ID]
+	}
+	return schema, nil
+}
+
+// schemaMerger collects the entities of a schema document and its imports into one collection
+type schemaMerger struct {
+	loader   SchemaLoader
+	provider DataProvider
+	visited  map[string]bool
+	entities map[string]*egdm.Entity
+	sources  map[string]string
+	merged   *egdm.EntityCollection
+}
+
+func (m *schemaMerger) load(location string, root bool) error {
+	if m.visited[location] {
+		return nil
+	}
+	m.visited[location] = true
+
+	ec, err := m.document(location)
+	if err != nil {
+		return err
+	}
+
+	// prefixes of the importing document win, as it is loaded first
+	for prefix, expansion := range ec.NamespaceManager.GetNamespaceMappings() {
+		if _, err := m.merged.NamespaceManager.GetNamespaceExpansionForPrefix(prefix); err != nil {
+			m.merged.NamespaceManager.StorePrefixExpansionMapping(prefix, expansion)
+		}
+	}
+
+	for _, entity := range ec.Entities {
+		if !isOfType(entity, EGCLSchema) {
+			continue
+		}
+		for _, imported := range toValueArray(entity.Properties[EGCLimports]) {
+			importLocation, ok := imported.(string)
+			if !ok {
+				continue
+			}
+			if err := m.load(resolveSchemaLocation(location, importLocation), false); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, entity := range ec.Entities {
+		// the imports of imported schemas have been resolved, only the schema entity of the root is kept
+		if isOfType(entity, EGCLSchema) && !root {
+			continue
+		}
+		if existing, ok := m.entities[entity.ID]; ok {
+			if !reflect.DeepEqual(existing.Properties, entity.Properties) || !reflect.DeepEqual(existing.References, entity.References) {
+				return errors.Wrapf(ErrConflictingDefinition, "%s is defined in both %s and %s", entity.ID, m.sources[entity.ID], location)
+			}
+			continue
+		}
+		m.entities[entity.ID] = entity
+		m.sources[entity.ID] = location
+		if err := m.merged.AddEntity(entity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// document reads the entities of the schema document at the location
+func (m *schemaMerger) document(location string) (*egdm.EntityCollection, error) {
+	if dataset, ok := datasetSchemaName(location); ok {
+		if m.provider == nil {
+			return nil, errors.Errorf("loading schema %s needs a data provider", location)
+		}
+		ec, err := loadDatasetEntities(m.provider, dataset)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading schema %s", location)
+		}
+		return ec, nil
+	}
+
+	data, err := m.loader.Load(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading schema %s", location)
+	}
+	ec, err := parseSchemaDocument(location, data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing schema %s", location)
+	}
+	return ec, nil
+}
+
+// parseSchemaDocument reads a document as YAML shorthand or EGDM JSON, depending on the extension of the location
+func parseSchemaDocument(location string, data []byte) (*egdm.EntityCollection, error) {
+	extension := strings.ToLower(path.Ext(location))
+	if u, err := url.Parse(location); err == nil && isSchemaURL(location) {
+		extension = strings.ToLower(path.Ext(u.Path))
+	}
+
+	isJSON := extension == ".json"
+	if extension != ".json" && extension != ".yaml" && extension != ".yml" {
+		isJSON = bytes.HasPrefix(bytes.TrimSpace(data), []byte("["))
+	}
+	if !isJSON {
+		return parseYamlEntities(location, data)
+	}
+
+	parser := egdm.NewEntityParser(egdm.NewNamespaceContext()).WithExpandURIs()
+	return parser.LoadEntityCollection(bytes.NewReader(data))
+}
+
+// resolveSchemaLocation resolves an import against the location of the importing document
+func resolveSchemaLocation(base string, location string) string {
+	if isSchemaURL(location) || filepath.IsAbs(location) {
+		return location
+	}
+	// datasets have no path to resolve against
+	if _, ok := datasetSchemaName(location); ok {
+		return location
+	}
+	if _, ok := datasetSchemaName(base); ok {
+		return location
+	}
+	if isSchemaURL(base) {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return location
+		}
+		ref, err := url.Parse(location)
+		if err != nil {
+			return location
+		}
+		return baseURL.ResolveReference(ref).String()
+	}
+	return filepath.Join(filepath.Dir(base), location)
+}
+
+func isSchemaURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+func isOfType(entity *egdm.Entity, typeURI string) bool {
+	for _, t := range makeStringArray(entity.References[RDfTypeURI]) {
+		if t == typeURI {
+			return true
+		}
+	}
+	return false
+}
+
+// GetImports returns the locations of the schemas imported by this schema
+func (aSchema *Schema) GetImports() []string {
+	imports := make([]string, 0)
+	if aSchema.EntityCollection == nil {
+		return imports
+	}
+	for _, entity := range aSchema.EntityCollection.Entities {
+		if !isOfType(entity, EGCLSchema) {
+			continue
+		}
+		for _, value := range toValueArray(entity.Properties[EGCLimports]) {
+			imports = append(imports, fmt.Sprint(value))
+		}
+	}
+	return imports
+}
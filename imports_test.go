@@ -0,0 +1,247 @@
+package egcl
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// mapSchemaLoader serves schema documents from memory
+type mapSchemaLoader map[string]string
+
+func (l mapSchemaLoader) Load(location string) ([]byte, error) {
+	if document, ok := l[location]; ok {
+		return []byte(document), nil
+	}
+	return nil, fmt.Errorf("no schema at %s", location)
+}
+
+const coreSchemaYaml = `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: core:Person
+  label: Person
+  propertyConstraints:
+    - propertyClass: core:name
+      minCard: 1
+`
+
+const domainSchemaYaml = `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    hr: http://data.mimiro.io/hr/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+  imports:
+    - ../core/core.yaml
+    - units.json
+
+- id: hr:Employee
+  superclasses: [core:Person]
+  referenceConstraints:
+    - referenceClass: hr:memberOf
+      referencedEntityClass: hr:Unit
+`
+
+const unitsSchemaJson = `[
+	{ "id" : "@context",
+		"namespaces" : {
+			"hr" : "http://data.mimiro.io/hr/model/",
+			"rdf" : "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+			"egcl" : "http://data.mimiro.io/egcl/"
+		}
+	},
+	{ "id" : "egcl:schema",
+		"refs" : { "rdf:type" : "egcl:Schema" },
+		"props" : { "egcl:imports" : [ "../domain/domain.yaml" ] }
+	},
+	{ "id" : "hr:Unit",
+		"refs" : { "rdf:type" : "egcl:EntityClass" }
+	}
+]`
+
+func TestLoadSchemaWithImports(t *testing.T) {
+	loader := mapSchemaLoader{
+		"schemas/core/core.yaml":     coreSchemaYaml,
+		"schemas/domain/domain.yaml": domainSchemaYaml,
+		"schemas/domain/units.json":  unitsSchemaJson,
+	}
+
+	schema, err := LoadSchema("schemas/domain/domain.yaml", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sources := map[string]string{
+		"http://data.mimiro.io/core/model/Person": "schemas/core/core.yaml",
+		"http://data.mimiro.io/hr/model/Employee": "schemas/domain/domain.yaml",
+		"http://data.mimiro.io/hr/model/Unit":     "schemas/domain/units.json",
+	}
+	if len(schema.EntityClasses) != len(sources) {
+		t.Errorf("expected %d classes, got %d", len(sources), len(schema.EntityClasses))
+	}
+	for classId, source := range sources {
+		entityClass := schema.GetEntityClassById(classId)
+		if entityClass == nil {
+			t.Errorf("expected class %s", classId)
+		} else if entityClass.Source != source {
+			t.Errorf("expected %s to come from %s, got %s", classId, source, entityClass.Source)
+		}
+	}
+	if len(schema.GetImports()) != 2 {
+		t.Errorf("expected the imports of the root schema, got %v", schema.GetImports())
+	}
+
+	// constraints of the imported superclass apply to the domain class
+	employee := egdm.NewEntity().SetID("http://data.mimiro.io/people/bob")
+	employee.SetReference(RDfTypeURI, "http://data.mimiro.io/hr/model/Employee")
+	ok, violations, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(schema, employee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || len(violations) != 1 || violations[0].ViolationType != MinPropertyOccurrenceNotMet {
+		t.Errorf("expected the missing core name to be reported, got %v", violations)
+	}
+}
+
+func TestLoadSchemaConflicts(t *testing.T) {
+	loader := mapSchemaLoader{
+		"core.yaml": coreSchemaYaml,
+		"other.yaml": `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+- id: core:Person
+  label: Human
+`,
+		"same.yaml": coreSchemaYaml,
+		"conflicting.yaml": `
+- id: "@context"
+  namespaces:
+    egcl: http://data.mimiro.io/egcl/
+  imports: [core.yaml, other.yaml]
+`,
+		"duplicate.yaml": `
+- id: "@context"
+  namespaces:
+    egcl: http://data.mimiro.io/egcl/
+  imports: [core.yaml, same.yaml]
+`,
+	}
+
+	_, err := LoadSchema("conflicting.yaml", loader)
+	if !errors.Is(err, ErrConflictingDefinition) {
+		t.Errorf("expected conflicting definition, got %v", err)
+	}
+
+	// identical definitions in two documents are not a conflict
+	schema, err := LoadSchema("duplicate.yaml", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.EntityClasses) != 1 {
+		t.Errorf("expected one class, got %d", len(schema.EntityClasses))
+	}
+
+	if _, err := LoadSchema("missing.yaml", loader); err == nil {
+		t.Error("expected missing schema to fail")
+	}
+}
+
+func TestLoadSchemaConstraintIdsAreUniquePerDocument(t *testing.T) {
+	loader := mapSchemaLoader{
+		"core.yaml": coreSchemaYaml,
+		"extra.yaml": `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+  imports: [core.yaml]
+- id: core:Person
+  label: Person
+  propertyConstraints:
+    - propertyClass: core:birthDate
+      minCard: 1
+`,
+	}
+
+	// both documents number their first constraint 0, on the same class
+	schema, err := LoadSchema("extra.yaml", loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schema.Constraints) != 2 {
+		t.Fatalf("expected the constraints of both documents, got %d", len(schema.Constraints))
+	}
+	if schema.Constraints[0].GetID() == schema.Constraints[1].GetID() {
+		t.Errorf("expected distinct constraint ids, got %s twice", schema.Constraints[0].GetID())
+	}
+
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/people/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/core/model/Person")
+	_, violations, err := NewValidator().ValidateEntity(schema, person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 2 {
+		t.Errorf("expected the missing name and birth date to be reported, got %v", violations)
+	}
+}
+
+func TestResolveSchemaLocation(t *testing.T) {
+	cases := []struct{ base, location, expected string }{
+		{"schemas/domain.yaml", "core.yaml", "schemas/core.yaml"},
+		{"schemas/domain.yaml", "/models/core.yaml", "/models/core.yaml"},
+		{"https://example.com/models/domain.yaml", "../core/core.yaml", "https://example.com/core/core.yaml"},
+		{"schemas/domain.yaml", "https://example.com/core.yaml", "https://example.com/core.yaml"},
+	}
+	for _, tc := range cases {
+		if resolved := resolveSchemaLocation(tc.base, tc.location); resolved != tc.expected {
+			t.Errorf("resolving %s against %s: expected %s, got %s", tc.location, tc.base, tc.expected, resolved)
+		}
+	}
+}
+
+func TestLoadSchemaWithSubClassOfCycleThroughImport(t *testing.T) {
+	loader := mapSchemaLoader{
+		"schemas/core/core.yaml": `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    hr: http://data.mimiro.io/hr/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: core:Agent
+  superclasses: [hr:Employee]
+`,
+		"schemas/domain/domain.yaml": `
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    hr: http://data.mimiro.io/hr/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+  imports:
+    - ../core/core.yaml
+
+- id: hr:Employee
+  superclasses: [core:Agent]
+`,
+	}
+
+	_, err := LoadSchema("schemas/domain/domain.yaml", loader)
+	if !errors.Is(err, ErrCyclicHierarchy) {
+		t.Fatalf("expected a cyclic hierarchy error, got %v", err)
+	}
+}
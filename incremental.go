@@ -0,0 +1,185 @@
+package egcl
+
+import (
+	"sort"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrChangesNotSupported = errors.New("data provider does not support dataset changes")
+)
+
+// ChangesDataProvider is implemented by data providers that can return the entities of a dataset changed since a
+// continuation token. The latest version of each changed entity is returned, including deleted entities, and the
+// iterator's Token is the continuation token for the next call.
+type ChangesDataProvider interface {
+	GetDatasetChanges(dataset string, since string) (datahub.EntityIterator, error)
+}
+
+// IncrementalValidationResult is the outcome of validating the changes to a dataset
+type IncrementalValidationResult struct {
+	// Token is the continuation token to pass to the next incremental validation
+	Token string
+	// Validated are the ids of the changed entities that were validated
+	Validated []string
+	// Invalid are the ids of the validated entities that failed validation
+	Invalid []string
+	// Deleted are the ids of the entities deleted since the previous token
+	Deleted []string
+	// Violations are the violations of the validated entities
+	Violations []*ConstraintViolation
+}
+
+// IsValid is true when none of the changed entities failed validation
+func (result *IncrementalValidationResult) IsValid() bool {
+	return len(result.Invalid) == 0
+}
+
+// ValidateDatasetChanges validates the entities of the named dataset changed since the continuation token, or all
+// entities when since is empty. Deleted entities are not validated but listed in the result. The returned token picks
+// up where this validation ended, and is since itself when there were no changes.
+func (v *Validator) ValidateDatasetChanges(schema *Schema, datasetName string, since string) (*IncrementalValidationResult, error) {
+	schema = v.profiledSchema(schema)
+	if v.dataProvider == nil {
+		return nil, errors.New("no data provider configured")
+	}
+
+	provider := DataProvider(v.dataProvider)
+	if v.resolver != nil {
+		provider = v.resolver.provider
+	}
+	changesProvider, ok := provider.(ChangesDataProvider)
+	if !ok {
+		return nil, ErrChangesNotSupported
+	}
+
+	changes, err := changesProvider.GetDatasetChanges(datasetName, since)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &IncrementalValidationResult{
+		Token:      since,
+		Validated:  make([]string, 0),
+		Invalid:    make([]string, 0),
+		Deleted:    make([]string, 0),
+		Violations: make([]*ConstraintViolation, 0),
+	}
+
+	batch := make([]*egdm.Entity, 0, v.batchSize())
+	for {
+		entity, err := changes.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil || len(batch) == cap(batch) {
+			if err := v.validateChangedEntities(schema, batch, result); err != nil {
+				return nil, err
+			}
+			batch = batch[:0]
+		}
+		if entity == nil {
+			break
+		}
+		if entity.IsDeleted {
+			result.Deleted = append(result.Deleted, entity.ID)
+			if v.resolver != nil {
+				v.resolver.Invalidate([]string{entity.ID})
+			}
+		} else {
+			batch = append(batch, entity)
+		}
+	}
+
+	if token := changes.Token(); token != nil && token.Token != "" {
+		result.Token = token.Token
+	}
+	return result, nil
+}
+
+func (v *Validator) validateChangedEntities(schema *Schema, entities []*egdm.Entity, result *IncrementalValidationResult) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	// referenced entities may have changed since they were cached by an earlier validation
+	if v.resolver != nil {
+		ids := make([]string, len(entities))
+		for i, entity := range entities {
+			ids[i] = entity.ID
+		}
+		v.resolver.Invalidate(ids)
+	}
+	v.prefetchReferencedEntities(schema, entities)
+
+	for _, entity := range entities {
+		valid, violations, err := v.ValidateEntity(schema, entity)
+		if err != nil {
+			return err
+		}
+		result.Validated = append(result.Validated, entity.ID)
+		if !valid {
+			result.Invalid = append(result.Invalid, entity.ID)
+		}
+		result.Violations = append(result.Violations, violations...)
+	}
+	return nil
+}
+
+// ViolationState keeps the current violations of a dataset across incremental validations. Applying a result replaces
+// the violations of the validated entities and forgets the deleted ones.
+type ViolationState struct {
+	Token      string
+	Violations map[string][]*ConstraintViolation
+	Invalid    map[string]bool
+}
+
+func NewViolationState() *ViolationState {
+	return &ViolationState{
+		Violations: make(map[string][]*ConstraintViolation),
+		Invalid:    make(map[string]bool),
+	}
+}
+
+// Apply updates the state with the result of an incremental validation, results without a token keep the current one
+func (state *ViolationState) Apply(result *IncrementalValidationResult) {
+	for _, ids := range [][]string{result.Validated, result.Deleted} {
+		for _, id := range ids {
+			delete(state.Violations, id)
+			delete(state.Invalid, id)
+		}
+	}
+	for _, violation := range result.Violations {
+		if violation.Entity != nil {
+			state.Violations[violation.Entity.ID] = append(state.Violations[violation.Entity.ID], violation)
+		}
+	}
+	for _, id := range result.Invalid {
+		state.Invalid[id] = true
+	}
+	if result.Token != "" {
+		state.Token = result.Token
+	}
+}
+
+// IsValid is true when no entity in the dataset currently fails validation
+func (state *ViolationState) IsValid() bool {
+	return len(state.Invalid) == 0
+}
+
+// GetViolations returns the current violations ordered by entity id
+func (state *ViolationState) GetViolations() []*ConstraintViolation {
+	ids := make([]string, 0, len(state.Violations))
+	for id := range state.Violations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	violations := make([]*ConstraintViolation, 0)
+	for _, id := range ids {
+		violations = append(violations, state.Violations[id]...)
+	}
+	return violations
+}
@@ -0,0 +1,161 @@
+package egcl
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// changeLogProvider records every stored entity version, the continuation token is the position in the log
+type changeLogProvider struct {
+	*CollectionDataProvider
+	log []*egdm.Entity
+}
+
+func (p *changeLogProvider) store(entity *egdm.Entity) {
+	p.log = append(p.log, entity)
+}
+
+func (p *changeLogProvider) GetDatasetChanges(dataset string, since string) (datahub.EntityIterator, error) {
+	position := 0
+	if since != "" {
+		position, _ = strconv.Atoi(since)
+	}
+	latest := make(map[string]*egdm.Entity)
+	order := make([]string, 0)
+	for _, entity := range p.log[position:] {
+		if _, seen := latest[entity.ID]; !seen {
+			order = append(order, entity.ID)
+		}
+		latest[entity.ID] = entity
+	}
+	changes := make([]*egdm.Entity, 0, len(order))
+	for _, id := range order {
+		changes = append(changes, latest[id])
+	}
+	token := egdm.NewContinuation()
+	token.Token = strconv.Itoa(len(p.log))
+	return &collectionIterator{entities: changes, token: token}, nil
+}
+
+func TestIncrementalValidation(t *testing.T) {
+	schema, err := parseYaml([]byte(qualitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	person := func(id string, name any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+		if name != nil {
+			e.SetProperty("http://data.mimiro.io/amodel/name", name)
+		}
+		return e
+	}
+
+	provider := &changeLogProvider{CollectionDataProvider: NewCollectionDataProvider()}
+	validator := NewValidator().WithDataProvider(provider)
+	state := NewViolationState()
+
+	provider.store(person("alice", "alice"))
+	provider.store(person("bob", nil))
+	provider.store(person("carol", nil))
+	result, err := validator.ValidateDatasetChanges(schema, "people", state.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Token != "3" || len(result.Validated) != 3 || len(result.Invalid) != 2 || result.IsValid() {
+		t.Fatalf("unexpected first result %+v", result)
+	}
+	state.Apply(result)
+	if len(state.GetViolations()) != 2 {
+		t.Fatalf("expected 2 violations, got %d", len(state.GetViolations()))
+	}
+
+	// bob is fixed and carol deleted
+	provider.store(person("bob", "bob"))
+	deleted := person("carol", nil)
+	deleted.IsDeleted = true
+	provider.store(deleted)
+	result, err = validator.ValidateDatasetChanges(schema, "people", state.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Token != "5" || len(result.Validated) != 1 || len(result.Deleted) != 1 || !result.IsValid() {
+		t.Fatalf("unexpected second result %+v", result)
+	}
+	state.Apply(result)
+	if !state.IsValid() || len(state.GetViolations()) != 0 {
+		t.Errorf("expected no remaining violations, got %d", len(state.GetViolations()))
+	}
+
+	// no changes keep the token
+	result, err = validator.ValidateDatasetChanges(schema, "people", state.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Token != "5" || len(result.Validated) != 0 {
+		t.Errorf("unexpected empty result %+v", result)
+	}
+
+	_, err = NewValidator().WithDataProvider(NewCollectionDataProvider()).ValidateDatasetChanges(schema, "people", "")
+	if err != ErrChangesNotSupported {
+		t.Errorf("expected ErrChangesNotSupported, got %v", err)
+	}
+}
+
+func TestChangesIteratorReadsPages(t *testing.T) {
+	total := DatasetChangesPageSize*2 + 10
+	requests := make([]string, 0)
+	fetch := func(since string) (*egdm.EntityCollection, error) {
+		requests = append(requests, since)
+		position := 0
+		if since != "" {
+			position, _ = strconv.Atoi(since)
+		}
+		end := position + DatasetChangesPageSize
+		if end > total {
+			end = total
+		}
+		page := egdm.NewEntityCollection(nil)
+		for i := position; i < end; i++ {
+			_ = page.AddEntity(egdm.NewEntity().SetID("http://data.mimiro.io/things/" + strconv.Itoa(i)))
+		}
+		page.Continuation = egdm.NewContinuation()
+		page.Continuation.Token = strconv.Itoa(end)
+		return page, nil
+	}
+
+	changes := &changesIterator{fetch: fetch}
+	if err := changes.nextPage(); err != nil {
+		t.Fatal(err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected only the first page to be read up front, got %v", requests)
+	}
+	count := 0
+	for {
+		entity, err := changes.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entity == nil {
+			break
+		}
+		if entity.ID != "http://data.mimiro.io/things/"+strconv.Itoa(count) {
+			t.Fatalf("expected change %d, got %s", count, entity.ID)
+		}
+		count++
+	}
+	if count != total {
+		t.Errorf("expected %d changes, got %d", total, count)
+	}
+	expected := []string{"", strconv.Itoa(DatasetChangesPageSize), strconv.Itoa(DatasetChangesPageSize * 2)}
+	if len(requests) != len(expected) || requests[1] != expected[1] || requests[2] != expected[2] {
+		t.Errorf("expected pages from %v, got %v", expected, requests)
+	}
+	if token := changes.Token(); token == nil || token.Token != strconv.Itoa(total) {
+		t.Errorf("expected token %d, got %v", total, token)
+	}
+}
@@ -0,0 +1,428 @@
+package egcl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const XSDUriExpansion = "http://www.w3.org/2001/XMLSchema#"
+
+const (
+	XSDstring   = XSDUriExpansion + "string"
+	XSDboolean  = XSDUriExpansion + "boolean"
+	XSDinteger  = XSDUriExpansion + "integer"
+	XSDdecimal  = XSDUriExpansion + "decimal"
+	XSDdate     = XSDUriExpansion + "date"
+	XSDdateTime = XSDUriExpansion + "dateTime"
+)
+
+// DefaultMaxReferenceSamples is the number of referenced ids per reference that are looked up to find their types
+const DefaultMaxReferenceSamples = 1000
+
+// InferenceSettings controls how a schema is inferred from a dataset
+type InferenceSettings struct {
+	// Namespaces are the prefixes to use in the YAML, prefixes of the dataset context are added and missing ones generated
+	Namespaces map[string]string
+	// ResolveReferences looks up referenced entities that are not in the dataset through the data provider
+	ResolveReferences bool
+	// DatasetsContext are the datasets referenced entities are looked up in
+	DatasetsContext []string
+	// MaxReferenceSamples limits the referenced ids per reference used to find the referenced classes
+	MaxReferenceSamples int
+}
+
+// SchemaInference holds what was observed for each rdf type in a dataset
+type SchemaInference struct {
+	Dataset  string
+	Entities int
+	Classes  map[string]*InferredClass
+	nsm      *egdm.NamespaceContext
+}
+
+// InferredClass is the observed structure of the entities of one rdf type
+type InferredClass struct {
+	ID         string
+	Count      int
+	Properties map[string]*InferredProperty
+	References map[string]*InferredProperty
+}
+
+// InferredProperty is the observed use of a property or reference by the entities of a class. MinCard is the lowest
+// number of values of the entities that have the property, it is 0 when some entities do not have it.
+type InferredProperty struct {
+	ID                string
+	Count             int
+	MinCard           int
+	MaxCard           int
+	Datatypes         map[string]int
+	ReferencedClasses map[string]int
+	sampledIds        map[string]bool
+}
+
+// InferSchema streams the dataset through the data provider and records the properties and references used by the
+// entities of each rdf type, with their cardinalities, datatypes and the types of the referenced entities. Entities
+// without a type are counted but not described. Referenced entities are found in the dataset itself, and through the
+// provider if ResolveReferences is set.
+func InferSchema(provider DataProvider, dataset string, settings *InferenceSettings) (*SchemaInference, error) {
+	if provider == nil {
+		return nil, errors.New("no data provider configured")
+	}
+	if settings == nil {
+		settings = &InferenceSettings{}
+	}
+	maxSamples := settings.MaxReferenceSamples
+	if maxSamples <= 0 {
+		maxSamples = DefaultMaxReferenceSamples
+	}
+
+	entities, err := provider.GetDatasetEntities(dataset)
+	if err != nil {
+		return nil, err
+	}
+
+	inference := &SchemaInference{Dataset: dataset, Classes: make(map[string]*InferredClass), nsm: egdm.NewNamespaceContext()}
+	datasetNamespaces := egdm.NewNamespaceContext()
+	if context := entities.Context(); context != nil {
+		for prefix, expansion := range context.Namespaces {
+			datasetNamespaces.StorePrefixExpansionMapping(prefix, expansion)
+		}
+	}
+	expand := func(id string) string {
+		if uri, err := datasetNamespaces.GetFullURI(id); err == nil {
+			return uri
+		}
+		return id
+	}
+
+	// the types of the entities in the dataset, so that references to them need no lookups
+	types := make(map[string][]string)
+	for {
+		entity, err := entities.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			break
+		}
+		if entity.IsDeleted {
+			continue
+		}
+		inference.Entities++
+
+		entityTypes := make([]string, 0)
+		for reference, value := range entity.References {
+			if expand(reference) == RDfTypeURI {
+				for _, t := range makeStringArray(value) {
+					entityTypes = append(entityTypes, expand(t))
+				}
+			}
+		}
+		types[expand(entity.ID)] = entityTypes
+
+		for _, t := range entityTypes {
+			class, ok := inference.Classes[t]
+			if !ok {
+				class = &InferredClass{ID: t, Properties: make(map[string]*InferredProperty), References: make(map[string]*InferredProperty)}
+				inference.Classes[t] = class
+			}
+			class.Count++
+
+			for property, value := range entity.Properties {
+				values := toValueArray(value)
+				if len(values) == 0 {
+					continue
+				}
+				observed := class.observe(class.Properties, expand(property), len(values))
+				for _, v := range values {
+					if datatype := inferDatatype(v); datatype != "" {
+						observed.Datatypes[datatype]++
+					}
+				}
+			}
+			for reference, value := range entity.References {
+				if expand(reference) == RDfTypeURI {
+					continue
+				}
+				refs := makeStringArray(value)
+				if len(refs) == 0 {
+					continue
+				}
+				observed := class.observe(class.References, expand(reference), len(refs))
+				for _, ref := range refs {
+					if len(observed.sampledIds) < maxSamples {
+						observed.sampledIds[expand(ref)] = true
+					}
+				}
+			}
+		}
+	}
+
+	if err := inference.resolveReferencedClasses(provider, types, settings); err != nil {
+		return nil, err
+	}
+
+	for prefix, expansion := range datasetNamespaces.GetNamespaceMappings() {
+		inference.nsm.StorePrefixExpansionMapping(prefix, expansion)
+	}
+	for prefix, expansion := range settings.Namespaces {
+		inference.nsm.StorePrefixExpansionMapping(prefix, expansion)
+	}
+	inference.nsm.StorePrefixExpansionMapping("rdf", RDFUriExpansion)
+	inference.nsm.StorePrefixExpansionMapping("xsd", XSDUriExpansion)
+	inference.nsm.StorePrefixExpansionMapping("egcl", EGCLUriExpansion)
+	return inference, nil
+}
+
+// observe records that an entity of the class has count values of the property
+func (class *InferredClass) observe(properties map[string]*InferredProperty, id string, count int) *InferredProperty {
+	observed, ok := properties[id]
+	if !ok {
+		observed = &InferredProperty{ID: id, MinCard: math.MaxInt, Datatypes: make(map[string]int),
+			ReferencedClasses: make(map[string]int), sampledIds: make(map[string]bool)}
+		properties[id] = observed
+	}
+	observed.Count++
+	if count < observed.MinCard {
+		observed.MinCard = count
+	}
+	if count > observed.MaxCard {
+		observed.MaxCard = count
+	}
+	return observed
+}
+
+func (inference *SchemaInference) resolveReferencedClasses(provider DataProvider, types map[string][]string, settings *InferenceSettings) error {
+	unresolved := make(map[string]bool)
+	for _, class := range inference.Classes {
+		for _, reference := range class.References {
+			for id := range reference.sampledIds {
+				if _, ok := types[id]; !ok {
+					unresolved[id] = true
+				}
+			}
+		}
+	}
+
+	if settings.ResolveReferences && len(unresolved) > 0 {
+		ids := make([]string, 0, len(unresolved))
+		for id := range unresolved {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		resolver := NewReferenceResolver(provider)
+		resolver.Prefetch(ids, settings.DatasetsContext)
+		v := NewValidator().WithSettings(&ValidatorSettings{DatasetsContext: settings.DatasetsContext})
+		for _, id := range ids {
+			entity, err := resolver.GetEntity(id, settings.DatasetsContext)
+			if err != nil {
+				return err
+			}
+			if entity == nil {
+				continue
+			}
+			if found, entityTypes, err := v.resolveReferencedEntityTypes(entity); err == nil && found {
+				types[id] = entityTypes
+			}
+		}
+	}
+
+	for _, class := range inference.Classes {
+		for _, reference := range class.References {
+			for id := range reference.sampledIds {
+				for _, t := range types[id] {
+					reference.ReferencedClasses[t]++
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// inferDatatype returns the xsd datatype of a property value, or an empty string for values like nested entities
+func inferDatatype(value any) string {
+	switch v := value.(type) {
+	case bool:
+		return XSDboolean
+	case int, int32, int64:
+		return XSDinteger
+	case float32:
+		return inferDatatype(float64(v))
+	case float64:
+		if v == math.Trunc(v) {
+			return XSDinteger
+		}
+		return XSDdecimal
+	case string:
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			return XSDdateTime
+		}
+		if _, err := time.Parse(time.DateOnly, v); err == nil {
+			return XSDdate
+		}
+		return XSDstring
+	}
+	return ""
+}
+
+// datatype returns the single datatype observed for a property, integers are widened to decimals and dates to date
+// times when both are seen. It is empty when the values have different datatypes.
+func (property *InferredProperty) datatype() string {
+	datatypes := make(map[string]bool)
+	for datatype := range property.Datatypes {
+		datatypes[datatype] = true
+	}
+	if datatypes[XSDinteger] && datatypes[XSDdecimal] {
+		delete(datatypes, XSDinteger)
+	}
+	if datatypes[XSDdate] && datatypes[XSDdateTime] {
+		delete(datatypes, XSDdate)
+	}
+	if len(datatypes) != 1 {
+		return ""
+	}
+	for datatype := range datatypes {
+		return datatype
+	}
+	return ""
+}
+
+// referencedClass returns the class of the referenced entities when they all have the same one
+func (property *InferredProperty) referencedClass() string {
+	if len(property.ReferencedClasses) != 1 {
+		return ""
+	}
+	for class := range property.ReferencedClasses {
+		return class
+	}
+	return ""
+}
+
+// cardinality returns the observed min and max cardinality of the property for the class
+func (class *InferredClass) cardinality(property *InferredProperty) (int, int) {
+	if property.Count < class.Count {
+		return 0, property.MaxCard
+	}
+	return property.MinCard, property.MaxCard
+}
+
+// yamlInferredClass and the constraint structs keep the key order of the written YAML
+type yamlInferredClass struct {
+	ID                   string                            `yaml:"id"`
+	Label                string                            `yaml:"label,omitempty"`
+	Description          string                            `yaml:"description,omitempty"`
+	PropertyConstraints  []yamlInferredPropertyConstraint  `yaml:"propertyConstraints,omitempty"`
+	ReferenceConstraints []yamlInferredReferenceConstraint `yaml:"referenceConstraints,omitempty"`
+}
+
+type yamlInferredPropertyConstraint struct {
+	PropertyClass string `yaml:"propertyClass"`
+	Datatype      string `yaml:"datatype,omitempty"`
+	MinCard       int    `yaml:"minCard,omitempty"`
+	MaxCard       int    `yaml:"maxCard,omitempty"`
+}
+
+type yamlInferredReferenceConstraint struct {
+	ReferenceClass        string `yaml:"referenceClass"`
+	ReferencedEntityClass string `yaml:"referencedEntityClass,omitempty"`
+	MinCard               int    `yaml:"minCard,omitempty"`
+	MaxCard               int    `yaml:"maxCard,omitempty"`
+}
+
+// Yaml writes the inferred schema in the YAML shorthand syntax, with classes and properties in identifier order. The
+// cardinalities are those observed, so they are a starting point to be refined.
+func (inference *SchemaInference) Yaml() ([]byte, error) {
+	nsm := egdm.NewNamespaceContext()
+	for prefix, expansion := range inference.nsm.GetNamespaceMappings() {
+		nsm.StorePrefixExpansionMapping(prefix, expansion)
+	}
+	prefixed := func(uri string) string {
+		if id, err := nsm.GetPrefixedIdentifier(uri); err == nil && id != uri {
+			return id
+		}
+		if id, err := nsm.AssertPrefixedIdentifierFromURI(uri); err == nil {
+			return id
+		}
+		return uri
+	}
+
+	classIds := make([]string, 0, len(inference.Classes))
+	for id := range inference.Classes {
+		classIds = append(classIds, id)
+	}
+	sort.Strings(classIds)
+
+	classes := make([]any, 0, len(classIds))
+	for _, id := range classIds {
+		class := inference.Classes[id]
+		yamlClass := yamlInferredClass{ID: prefixed(id), Label: localName(id)}
+		yamlClass.Description = "Inferred from " + pluralize(class.Count, "entity", "entities")
+		if inference.Dataset != "" {
+			yamlClass.Description += " in " + inference.Dataset
+		}
+
+		for _, property := range sortedInferredProperties(class.Properties) {
+			minCard, maxCard := class.cardinality(property)
+			constraint := yamlInferredPropertyConstraint{PropertyClass: prefixed(property.ID), MinCard: minCard, MaxCard: maxCard}
+			if datatype := property.datatype(); datatype != "" {
+				constraint.Datatype = prefixed(datatype)
+			}
+			yamlClass.PropertyConstraints = append(yamlClass.PropertyConstraints, constraint)
+		}
+		for _, reference := range sortedInferredProperties(class.References) {
+			minCard, maxCard := class.cardinality(reference)
+			constraint := yamlInferredReferenceConstraint{ReferenceClass: prefixed(reference.ID), MinCard: minCard, MaxCard: maxCard}
+			if referencedClass := reference.referencedClass(); referencedClass != "" {
+				constraint.ReferencedEntityClass = prefixed(referencedClass)
+			}
+			yamlClass.ReferenceConstraints = append(yamlClass.ReferenceConstraints, constraint)
+		}
+		classes = append(classes, yamlClass)
+	}
+
+	// the namespaces are written last as generated prefixes are added while writing the classes
+	context := map[string]any{"id": "@context", "namespaces": nsm.GetNamespaceMappings()}
+	return yaml.Marshal(append([]any{context}, classes...))
+}
+
+// Schema parses the inferred YAML into a schema
+func (inference *SchemaInference) Schema() (*Schema, error) {
+	data, err := inference.Yaml()
+	if err != nil {
+		return nil, err
+	}
+	return NewSchemaFromYaml(string(data))
+}
+
+func sortedInferredProperties(properties map[string]*InferredProperty) []*InferredProperty {
+	sorted := make([]*InferredProperty, 0, len(properties))
+	for _, property := range properties {
+		sorted = append(sorted, property)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// localName returns the part of a URI after the last hash or slash
+func localName(uri string) string {
+	if i := strings.LastIndexAny(uri, "#/"); i >= 0 && i < len(uri)-1 {
+		return uri[i+1:]
+	}
+	return uri
+}
+
+func pluralize(count int, singular string, plural string) string {
+	if count == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", count, plural)
+}
@@ -0,0 +1,122 @@
+package egcl
+
+import (
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func newInferenceTestProvider() *CollectionDataProvider {
+	entity := func(id string, class string, refs map[string]any, props map[string]any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/"+class)
+		for k, v := range refs {
+			e.SetReference("http://data.mimiro.io/amodel/"+k, v)
+		}
+		for k, v := range props {
+			e.SetProperty("http://data.mimiro.io/amodel/"+k, v)
+		}
+		return e
+	}
+
+	people := egdm.NewEntityCollection(nil)
+	people.NamespaceManager.StorePrefixExpansionMapping("model", "http://data.mimiro.io/amodel/")
+	for _, e := range []*egdm.Entity{
+		entity("alice", "Person", map[string]any{"worksFor": "http://data.mimiro.io/things/sales", "country": "http://data.mimiro.io/things/no"},
+			map[string]any{"name": "alice", "age": 42.0, "nicknames": []any{"al", "ali"}, "born": "1981-02-03"}),
+		entity("bob", "Person", map[string]any{"worksFor": "http://data.mimiro.io/things/sales"},
+			map[string]any{"name": "bob", "age": 37.5, "born": "1986-11-12T08:00:00Z"}),
+		entity("sales", "Unit", nil, map[string]any{"name": "Sales", "active": true}),
+		egdm.NewEntity().SetID("http://data.mimiro.io/things/untyped"),
+	} {
+		_ = people.AddEntity(e)
+	}
+
+	countries := egdm.NewEntityCollection(nil)
+	_ = countries.AddEntity(entity("no", "Country", nil, nil))
+
+	return NewCollectionDataProvider().WithDataset("people", people).WithDataset("countries", countries)
+}
+
+func TestInferSchema(t *testing.T) {
+	provider := newInferenceTestProvider()
+	inference, err := InferSchema(provider, "people", &InferenceSettings{ResolveReferences: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inference.Entities != 4 || len(inference.Classes) != 2 {
+		t.Fatalf("expected 4 entities in 2 classes, got %d and %d", inference.Entities, len(inference.Classes))
+	}
+
+	schema, err := inference.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type summary struct {
+		minCard, maxCard int
+		valueType        string
+	}
+	expected := map[string]summary{
+		"name":      {1, 1, XSDstring},
+		"age":       {1, 1, XSDdecimal},
+		"nicknames": {0, 2, XSDstring},
+		"born":      {1, 1, XSDdateTime},
+		"worksFor":  {1, 1, "http://data.mimiro.io/amodel/Unit"},
+		"country":   {0, 1, "http://data.mimiro.io/amodel/Country"},
+	}
+	constraints := schema.GetConstraintsForEntityClass("http://data.mimiro.io/amodel/Person", false)
+	if len(constraints) != len(expected) {
+		t.Errorf("expected %d constraints on person, got %d", len(expected), len(constraints))
+	}
+	for _, constraint := range constraints {
+		var got summary
+		var property string
+		switch c := constraint.(type) {
+		case *PropertyConstraint:
+			property, _ = c.GetConstrainedPropertyClass()
+			got = summary{c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences(), c.GetDataType()}
+		case *ReferenceConstraint:
+			property, _ = c.GetConstrainedPropertyClass()
+			referencedClass, _ := c.GetAllowedReferencedClass()
+			got = summary{c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences(), referencedClass}
+		}
+		name := strings.TrimPrefix(property, "http://data.mimiro.io/amodel/")
+		if got != expected[name] {
+			t.Errorf("expected %v for %s, got %v", expected[name], name, got)
+		}
+	}
+
+	// the inferred schema accepts the data it was inferred from
+	entities, _ := provider.GetDatasetEntities("people")
+	for entity, _ := entities.Next(); entity != nil; entity, _ = entities.Next() {
+		ok, violations, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(schema, entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Errorf("expected %s to be valid, got %v", entity.ID, violations[0].Message)
+		}
+	}
+
+	data, _ := inference.Yaml()
+	if !strings.Contains(string(data), "id: model:Person") || !strings.Contains(string(data), "model: http://data.mimiro.io/amodel/") {
+		t.Errorf("expected prefixes from the dataset context in\n%s", data)
+	}
+}
+
+func TestInferSchemaWithoutResolvingReferences(t *testing.T) {
+	inference, err := InferSchema(newInferenceTestProvider(), "people", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	country := inference.Classes["http://data.mimiro.io/amodel/Person"].References["http://data.mimiro.io/amodel/country"]
+	if len(country.ReferencedClasses) != 0 {
+		t.Errorf("expected referenced classes outside the dataset to be unknown, got %v", country.ReferencedClasses)
+	}
+	worksFor := inference.Classes["http://data.mimiro.io/amodel/Person"].References["http://data.mimiro.io/amodel/worksFor"]
+	if worksFor.referencedClass() != "http://data.mimiro.io/amodel/Unit" {
+		t.Errorf("expected referenced class in the dataset to be found, got %v", worksFor.ReferencedClasses)
+	}
+}
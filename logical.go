@@ -0,0 +1,133 @@
+package egcl
+
+import (
+	"fmt"
+	"strings"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const (
+	EGCLAndConstraint  = EGCLUriExpansion + "AndConstraint"
+	EGCLOrConstraint   = EGCLUriExpansion + "OrConstraint"
+	EGCLXoneConstraint = EGCLUriExpansion + "XoneConstraint"
+	EGCLNotConstraint  = EGCLUriExpansion + "NotConstraint"
+)
+
+const EGCLconstraints = EGCLUriExpansion + "constraints"
+
+func newLogicalConstraint(entity *egdm.Entity, constraintTypeIdentifier string) *LogicalConstraint {
+	c := &LogicalConstraint{}
+	c.Constraint.Entity = entity
+	c.Constraint.ConstraintTypeIdentifier = constraintTypeIdentifier
+	return c
+}
+
+// LogicalConstraint combines the constraints listed with egcl:constraints. The rdf type decides how: all of them must
+// hold (and), at least one (or), exactly one (xone) or none (not). Like the nested constraints of a conditional
+// constraint, the combined constraints have no entity class of their own.
+type LogicalConstraint struct {
+	Constraint
+}
+
+// GetMemberConstraintIds returns the ids of the combined constraints
+func (c *LogicalConstraint) GetMemberConstraintIds() []string {
+	ids, err := c.Entity.GetReferenceValues(EGCLconstraints)
+	if err != nil {
+		return []string{}
+	}
+	return ids
+}
+
+// GetOperator returns and, or, xone or not
+func (c *LogicalConstraint) GetOperator() string {
+	switch c.ConstraintTypeIdentifier {
+	case EGCLAndConstraint:
+		return "and"
+	case EGCLOrConstraint:
+		return "or"
+	case EGCLXoneConstraint:
+		return "xone"
+	case EGCLNotConstraint:
+		return "not"
+	}
+	return ""
+}
+
+// Check checks all combined constraints and reports the ones that failed, or held for not and xone, as causes
+func (c *LogicalConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	ids := c.GetMemberConstraintIds()
+	passed := make([]string, 0)
+	held := make([]*ConstraintViolation, 0)
+	failed := make([]*ConstraintViolation, 0)
+	for _, id := range ids {
+		member := schema.GetConstraintById(id)
+		if member == nil {
+			return false, nil, errors.Errorf("constraint %s used in %s constraint %s is not defined in the schema", id, c.GetOperator(), c.GetID())
+		}
+
+		valid, violation, err := validator.CheckConstraint(schema, member, entity)
+		if err != nil {
+			return false, nil, err
+		}
+		if valid {
+			passed = append(passed, id)
+			held = append(held, NewConstraintViolation(member, entity, LogicalConstraintNotSatisfied, "constraint holds"))
+		} else {
+			if violation == nil {
+				violation = NewConstraintViolation(member, entity, LogicalConstraintNotSatisfied, "constraint does not hold")
+			}
+			failed = append(failed, violation)
+		}
+	}
+
+	var message string
+	causes := failed
+	switch c.ConstraintTypeIdentifier {
+	case EGCLAndConstraint:
+		if len(failed) == 0 {
+			return true, nil, nil
+		}
+		message = fmt.Sprintf("all of %d constraints must hold but %d failed: %s", len(ids), len(failed), describeViolations(failed))
+	case EGCLOrConstraint:
+		if len(passed) > 0 {
+			return true, nil, nil
+		}
+		message = fmt.Sprintf("at least one of %d constraints must hold but all failed: %s", len(ids), describeViolations(failed))
+	case EGCLXoneConstraint:
+		if len(passed) == 1 {
+			return true, nil, nil
+		}
+		if len(passed) == 0 {
+			message = fmt.Sprintf("exactly one of %d constraints must hold but all failed: %s", len(ids), describeViolations(failed))
+		} else {
+			message = fmt.Sprintf("exactly one of %d constraints must hold but %d held: %s", len(ids), len(passed), strings.Join(passed, ", "))
+			causes = held
+		}
+	case EGCLNotConstraint:
+		if len(passed) == 0 {
+			return true, nil, nil
+		}
+		message = fmt.Sprintf("constraints must not hold but these held: %s", strings.Join(passed, ", "))
+		causes = held
+	default:
+		return false, nil, errors.Errorf("unknown logical constraint type %s", c.ConstraintTypeIdentifier)
+	}
+
+	violation := NewConstraintViolation(c, entity, LogicalConstraintNotSatisfied, message)
+	violation.Causes = causes
+	return false, violation, nil
+}
+
+func describeViolations(violations []*ConstraintViolation) string {
+	descriptions := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		id := ""
+		if violation.Constraint != nil {
+			id = violation.Constraint.GetID()
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", id, violation.Message))
+	}
+	return strings.Join(descriptions, ", ")
+}
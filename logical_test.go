@@ -0,0 +1,117 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const contactSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Contact
+  label: Contact
+  propertyConstraints:
+    - propertyClass: model:name
+      minCard: 1
+      maxLength: 20
+  logicalConstraints:
+    - xone:
+        - propertyClass: model:email
+          minCard: 1
+        - propertyClass: model:phone
+          minCard: 1
+    - not:
+        propertyClass: model:status
+        minCard: 1
+        in: [banned]
+    - or:
+        - propertyClass: model:age
+          minInclusive: 18
+        - and:
+            - propertyClass: model:guardian
+              minCard: 1
+            - propertyClass: model:age
+              minCard: 1
+`
+
+func TestLogicalConstraints(t *testing.T) {
+	schema, err := parseYaml([]byte(contactSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the combined constraints are only reachable through the logical constraints
+	constraints := schema.GetConstraintsForEntityClass("http://data.mimiro.io/amodel/Contact", true)
+	if len(constraints) != 4 {
+		t.Fatalf("expected 4 constraints for class, got %d", len(constraints))
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{})
+	contact := func(props map[string]any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/contact")
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Contact")
+		e.SetProperty("http://data.mimiro.io/amodel/name", "bob")
+		for k, val := range props {
+			e.SetProperty("http://data.mimiro.io/amodel/"+k, val)
+		}
+		return e
+	}
+
+	cases := []struct {
+		name   string
+		entity *egdm.Entity
+		causes []int
+	}{
+		{"email only", contact(map[string]any{"email": "bob@example.com", "age": 30}), nil},
+		{"phone only", contact(map[string]any{"phone": "555", "age": 30}), nil},
+		{"neither email nor phone", contact(map[string]any{"age": 30}), []int{2}},
+		{"both email and phone", contact(map[string]any{"email": "bob@example.com", "phone": "555", "age": 30}), []int{2}},
+		{"banned", contact(map[string]any{"email": "bob@example.com", "age": 30, "status": "banned"}), []int{1}},
+		{"minor with guardian", contact(map[string]any{"email": "bob@example.com", "age": 12, "guardian": "alice"}), nil},
+		{"minor without guardian", contact(map[string]any{"email": "bob@example.com", "age": 12}), []int{2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, violations, err := v.ValidateEntity(schema, tc.entity)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != (len(tc.causes) == 0) || len(violations) != len(tc.causes) {
+				t.Fatalf("expected %d violations, got %v", len(tc.causes), violations)
+			}
+			for i, violation := range violations {
+				if violation.ViolationType != LogicalConstraintNotSatisfied {
+					t.Errorf("expected logical constraint violation, got %v", violation.ViolationType)
+				}
+				if len(violation.Causes) != tc.causes[i] {
+					t.Errorf("expected %d causes, got %d: %s", tc.causes[i], len(violation.Causes), violation.Message)
+				}
+			}
+		})
+	}
+}
+
+func TestLogicalConstraintWithUnknownMember(t *testing.T) {
+	ec := egdm.NewEntityCollection(nil)
+	class := egdm.NewEntity().SetID("http://data.mimiro.io/amodel/Contact")
+	class.SetReference(RDfTypeURI, EGCLEntityClass)
+	or := egdm.NewEntity().SetID("http://data.mimiro.io/amodel/contact-or")
+	or.SetReference(RDfTypeURI, EGCLOrConstraint)
+	or.SetReference(EGCLentityClass, class.ID)
+	or.SetReference(EGCLconstraints, []string{"http://data.mimiro.io/amodel/missing"})
+	_ = ec.AddEntity(class)
+	_ = ec.AddEntity(or)
+
+	entity := egdm.NewEntity().SetID("http://data.mimiro.io/things/contact")
+	entity.SetReference(RDfTypeURI, class.ID)
+	_, _, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(NewSchema(ec), entity)
+	if err == nil {
+		t.Error("expected an error for an undefined member constraint")
+	}
+}
@@ -0,0 +1,204 @@
+package egcl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const (
+	EGCLmessage  = EGCLUriExpansion + "message"
+	EGCLlanguage = EGCLUriExpansion + "language"
+	EGCLtext     = EGCLUriExpansion + "text"
+)
+
+// DefaultMessageLanguage is used when no message matches the language in the settings
+const DefaultMessageLanguage = "en"
+
+// Placeholders that can be used in egcl:message
+const (
+	MessageEntityPlaceholder     = "{entity}"
+	MessageClassPlaceholder      = "{class}"
+	MessagePropertyPlaceholder   = "{property}"
+	MessageExpectedPlaceholder   = "{expected}"
+	MessageActualPlaceholder     = "{actual}"
+	MessageConstraintPlaceholder = "{constraint}"
+)
+
+// GetMessages returns the egcl:message texts of the constraint by language. A plain string value has no language and
+// is returned under the empty string, language variants are nested entities with egcl:language and egcl:text.
+func (c *Constraint) GetMessages() map[string]string {
+	messages := make(map[string]string)
+	if c.Entity == nil {
+		return messages
+	}
+	for _, value := range toValueArray(c.Entity.Properties[EGCLmessage]) {
+		switch m := value.(type) {
+		case string:
+			messages[""] = m
+		case *egdm.Entity:
+			language, _ := m.GetFirstStringPropertyValue(EGCLlanguage)
+			if text, err := m.GetFirstStringPropertyValue(EGCLtext); err == nil {
+				messages[strings.ToLower(language)] = text
+			}
+		}
+	}
+	return messages
+}
+
+// GetMessage returns the message for the language. It falls back from a regional variant like nb-NO to nb, then to the
+// message without a language, then to English and finally to the first language in alphabetical order. False is
+// returned if the constraint has no messages.
+func (c *Constraint) GetMessage(language string) (string, bool) {
+	messages := c.GetMessages()
+	if len(messages) == 0 {
+		return "", false
+	}
+
+	language = strings.ToLower(language)
+	candidates := []string{language}
+	if primary, _, found := strings.Cut(language, "-"); found {
+		candidates = append(candidates, primary)
+	}
+	candidates = append(candidates, "", DefaultMessageLanguage)
+	for _, candidate := range candidates {
+		if message, ok := messages[candidate]; ok {
+			return message, true
+		}
+	}
+
+	languages := make([]string, 0, len(messages))
+	for l := range messages {
+		languages = append(languages, l)
+	}
+	sort.Strings(languages)
+	return messages[languages[0]], true
+}
+
+// WithDetails records the property, or path, that was checked together with the expected and actual values, so that
+// they can be used in messages
+func (violation *ConstraintViolation) WithDetails(property string, expected any, actual any) *ConstraintViolation {
+	violation.Property = property
+	violation.Expected = expected
+	violation.Actual = actual
+	return violation
+}
+
+// renderMessage sets the message of a violation found when validating an entity as instance of the class. The egcl:message
+// of the constraint is used in the language of the settings if there is one, otherwise the message of the check is
+// prefixed with the class, entity and property.
+func (v *Validator) renderMessage(schema *Schema, class string, constraint ConstraintType, violation *ConstraintViolation) {
+	violation.EntityClass = class
+	v.renderCauses(schema, class, violation)
+	if v.renderConstraintMessage(schema, class, constraint, violation) {
+		return
+	}
+
+	entityId := ""
+	if violation.Entity != nil {
+		entityId = violation.Entity.ID
+	}
+
+	subject := fmt.Sprintf("%s %s", schema.displayName(class), entityId)
+	if violation.Property != "" {
+		subject = fmt.Sprintf("%s, %s", subject, schema.displayName(violation.Property))
+	}
+	violation.Message = fmt.Sprintf("%s: %s", subject, violation.Message)
+}
+
+// renderCauses uses the egcl:message of the constraints that caused a logical constraint violation, also where the
+// causes are listed in the message of the violation
+func (v *Validator) renderCauses(schema *Schema, class string, violation *ConstraintViolation) {
+	for _, cause := range violation.Causes {
+		cause.EntityClass = class
+		v.renderCauses(schema, class, cause)
+		if cause.Constraint == nil {
+			continue
+		}
+		described := describeViolations([]*ConstraintViolation{cause})
+		if v.renderConstraintMessage(schema, class, cause.Constraint, cause) {
+			violation.Message = strings.Replace(violation.Message, described, describeViolations([]*ConstraintViolation{cause}), 1)
+		}
+	}
+}
+
+// renderConstraintMessage sets the egcl:message of the constraint, in the language of the settings, as message of the
+// violation. False is returned when the constraint has no message.
+func (v *Validator) renderConstraintMessage(schema *Schema, class string, constraint ConstraintType, violation *ConstraintViolation) bool {
+	language := ""
+	if v.settings != nil {
+		language = v.settings.Language
+	}
+	message, ok := constraint.GetMessage(language)
+	if !ok {
+		return false
+	}
+
+	entityId := ""
+	if violation.Entity != nil {
+		entityId = violation.Entity.ID
+	}
+	violation.Message = strings.NewReplacer(
+		MessageEntityPlaceholder, entityId,
+		MessageClassPlaceholder, schema.displayName(class),
+		MessagePropertyPlaceholder, schema.displayName(violation.Property),
+		MessageExpectedPlaceholder, formatMessageValue(violation.Expected),
+		MessageActualPlaceholder, formatMessageValue(violation.Actual),
+		MessageConstraintPlaceholder, constraint.GetID(),
+	).Replace(message)
+	return true
+}
+
+// displayName returns the label of an entity class, or the prefixed form of other URIs when the schema has a prefix for it
+func (aSchema *Schema) displayName(uri string) string {
+	if uri == "" {
+		return ""
+	}
+	if entityClass := aSchema.GetEntityClassById(uri); entityClass != nil {
+		if label := entityClass.GetLabel(); label != "" {
+			return label
+		}
+	}
+	if aSchema.EntityCollection != nil && aSchema.EntityCollection.NamespaceManager != nil {
+		if prefixed, ok := prefixedName(aSchema.EntityCollection.NamespaceManager, uri); ok {
+			return prefixed
+		}
+	}
+	return uri
+}
+
+// prefixedName uses the prefix with the longest expansion the uri starts with, the first prefix in alphabetical order
+// if several have the same expansion, so that the name does not depend on the order of the namespace mappings
+func prefixedName(nsm egdm.NamespaceManager, uri string) (string, bool) {
+	bestPrefix, bestExpansion := "", ""
+	for prefix, expansion := range nsm.GetNamespaceMappings() {
+		if expansion == "" || len(uri) <= len(expansion) || !strings.HasPrefix(uri, expansion) {
+			continue
+		}
+		if len(expansion) > len(bestExpansion) || (len(expansion) == len(bestExpansion) && prefix < bestPrefix) {
+			bestPrefix, bestExpansion = prefix, expansion
+		}
+	}
+	if bestExpansion == "" {
+		return "", false
+	}
+	return bestPrefix + ":" + strings.TrimPrefix(uri, bestExpansion), true
+}
+
+func formatMessageValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ", ")
+	case []string:
+		return strings.Join(v, ", ")
+	}
+	return fmt.Sprint(value)
+}
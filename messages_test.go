@@ -0,0 +1,188 @@
+package egcl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const messageSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  label: Person
+  propertyConstraints:
+    - propertyClass: model:name
+      minCard: 1
+      message:
+        en: "{class} {entity} must have a {property}"
+        nb: "{class} {entity} mangler {property}"
+    - propertyClass: model:age
+      maxInclusive: 150
+      message: "{property} of {entity} is {actual}, it can be at most {expected}"
+    - propertyClass: model:email
+      pattern: "^[^@]+@[^@]+$"
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      maxCard: 1
+`
+
+func newMessageTestPerson() *egdm.Entity {
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/things/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+	person.SetReference("http://data.mimiro.io/amodel/worksFor", []string{"http://data.mimiro.io/things/a", "http://data.mimiro.io/things/b"})
+	person.SetProperty("http://data.mimiro.io/amodel/age", 200)
+	person.SetProperty("http://data.mimiro.io/amodel/email", "bob")
+	return person
+}
+
+func TestViolationMessages(t *testing.T) {
+	schema, err := parseYaml([]byte(messageSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		language string
+		expected []string
+	}{
+		{"", []string{
+			"Person http://data.mimiro.io/things/bob must have a model:name",
+			"model:age of http://data.mimiro.io/things/bob is 200, it can be at most 150",
+			"Person http://data.mimiro.io/things/bob, model:email: value bob does not match pattern ^[^@]+@[^@]+$",
+			"Person http://data.mimiro.io/things/bob, model:worksFor: max card is 1 but found 2 occurrences",
+		}},
+		{"nb-NO", []string{
+			"Person http://data.mimiro.io/things/bob mangler model:name",
+			"model:age of http://data.mimiro.io/things/bob is 200, it can be at most 150",
+		}},
+		{"sv", []string{
+			"Person http://data.mimiro.io/things/bob must have a model:name",
+		}},
+	}
+
+	for _, tc := range cases {
+		v := NewValidator().WithSettings(&ValidatorSettings{Language: tc.language})
+		_, violations, err := v.ValidateEntity(schema, newMessageTestPerson())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) != 4 {
+			t.Fatalf("expected 4 violations, got %d", len(violations))
+		}
+
+		messages := make(map[string]bool)
+		for _, violation := range violations {
+			messages[violation.Message] = true
+			if violation.EntityClass != "http://data.mimiro.io/amodel/Person" || violation.Property == "" {
+				t.Errorf("expected class and property on violation, got %s and %s", violation.EntityClass, violation.Property)
+			}
+		}
+		for _, expected := range tc.expected {
+			if !messages[expected] {
+				t.Errorf("language %q: expected message %q in %v", tc.language, expected, messages)
+			}
+		}
+	}
+}
+
+func TestConstraintMessageFallback(t *testing.T) {
+	constraint := &Constraint{Entity: egdm.NewEntity()}
+	if _, ok := constraint.GetMessage("en"); ok {
+		t.Error("expected no message")
+	}
+
+	variant := func(language string, text string) *egdm.Entity {
+		return egdm.NewEntity().SetProperty(EGCLlanguage, language).SetProperty(EGCLtext, text)
+	}
+	constraint.Entity.SetProperty(EGCLmessage, []any{variant("nb", "norsk"), variant("se", "davvisámegiella")})
+	for language, expected := range map[string]string{"nb-NO": "norsk", "SE": "davvisámegiella", "": "norsk", "de": "norsk"} {
+		if message, _ := constraint.GetMessage(language); message != expected {
+			t.Errorf("language %q: expected %s, got %s", language, expected, message)
+		}
+	}
+}
+
+func TestMessagesInSHACL(t *testing.T) {
+	schema, err := parseYaml([]byte(messageSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := shapes.WriteJSON_LD(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"@language":"nb"`) {
+		t.Errorf("expected language tagged message in %s", buf.String())
+	}
+}
+
+func TestMessagesOfLogicalConstraintCauses(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  logicalConstraints:
+    - or:
+        - propertyClass: model:email
+          minCard: 1
+          message: "{entity} has no {property}"
+        - propertyClass: model:phone
+          minCard: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/things/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+	_, violations, err := NewValidator().ValidateEntity(schema, person)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(violations) != 1 || len(violations[0].Causes) != 2 {
+		t.Fatalf("expected one violation with two causes, got %v", violations)
+	}
+	rendered := "http://data.mimiro.io/things/bob has no model:email"
+	if cause := violations[0].Causes[0]; cause.Message != rendered || cause.EntityClass != "http://data.mimiro.io/amodel/Person" {
+		t.Errorf("expected rendered cause, got %q for %s", cause.Message, cause.EntityClass)
+	}
+	if !strings.Contains(violations[0].Message, "("+rendered+")") {
+		t.Errorf("expected rendered cause in %q", violations[0].Message)
+	}
+}
+
+func TestDisplayNameUsesLongestNamespace(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		namespaces := egdm.NewNamespaceContext()
+		namespaces.StorePrefixExpansionMapping("mimiro", "http://data.mimiro.io/")
+		namespaces.StorePrefixExpansionMapping("model", "http://data.mimiro.io/amodel/")
+		namespaces.StorePrefixExpansionMapping("amodel", "http://data.mimiro.io/amodel/")
+		schema := &Schema{EntityCollection: egdm.NewEntityCollection(namespaces)}
+
+		if name := schema.displayName("http://data.mimiro.io/amodel/name"); name != "amodel:name" {
+			t.Fatalf("expected amodel:name, got %s", name)
+		}
+		if name := schema.displayName("http://data.mimiro.io/things/bob"); name != "mimiro:things/bob" {
+			t.Fatalf("expected mimiro:things/bob, got %s", name)
+		}
+		if name := schema.displayName("http://data.mimiro.io/amodel/"); name != "mimiro:amodel/" {
+			t.Fatalf("expected mimiro:amodel/, got %s", name)
+		}
+	}
+}
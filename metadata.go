@@ -0,0 +1,127 @@
+package egcl
+
+import (
+	"fmt"
+	"time"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const (
+	EGCLversion         = EGCLUriExpansion + "version"
+	EGCLtitle           = EGCLUriExpansion + "title"
+	EGCLbaseURI         = EGCLUriExpansion + "baseURI"
+	EGCLowner           = EGCLUriExpansion + "owner"
+	EGCLdeprecated      = EGCLUriExpansion + "deprecated"
+	EGCLdeprecationDate = EGCLUriExpansion + "deprecationDate"
+	EGCLremovalDate     = EGCLUriExpansion + "removalDate"
+	EGCLreplacedBy      = EGCLUriExpansion + "replacedBy"
+)
+
+// DefaultSchemaEntityId is the id of the egcl:Schema entity created for YAML schemas without a baseURI
+const DefaultSchemaEntityId = EGCLUriExpansion + "schema"
+
+// initializeMetadata reads the schema level metadata from the egcl:Schema entity
+func (aSchema *Schema) initializeMetadata(entity *egdm.Entity) {
+	aSchema.BaseURI, _ = entity.GetFirstStringPropertyValue(EGCLbaseURI)
+	aSchema.Description, _ = entity.GetFirstStringPropertyValue(EGCLDescription)
+	aSchema.Version, _ = entity.GetFirstStringPropertyValue(EGCLversion)
+	aSchema.Title, _ = entity.GetFirstStringPropertyValue(EGCLtitle)
+	aSchema.Owners = make([]string, 0)
+	for _, owner := range toValueArray(entity.Properties[EGCLowner]) {
+		aSchema.Owners = append(aSchema.Owners, fmt.Sprint(owner))
+	}
+	aSchema.Deprecated = isDeprecated(entity)
+	aSchema.DeprecationDate, _ = entity.GetFirstStringPropertyValue(EGCLdeprecationDate)
+	aSchema.RemovalDate, _ = entity.GetFirstStringPropertyValue(EGCLremovalDate)
+}
+
+func isDeprecated(entity *egdm.Entity) bool {
+	if entity == nil {
+		return false
+	}
+	deprecated, ok := entity.Properties[EGCLdeprecated].(bool)
+	return ok && deprecated
+}
+
+func replacedBy(entity *egdm.Entity) string {
+	if entity == nil {
+		return ""
+	}
+	replacement, _ := entity.GetFirstReferenceValue(EGCLreplacedBy)
+	return replacement
+}
+
+// IsDeprecated returns the egcl:deprecated flag of the entity class
+func (entityClass *EntityClass) IsDeprecated() bool {
+	return isDeprecated(entityClass.Entity)
+}
+
+// GetReplacedBy returns the class that replaces a deprecated class, or an empty string
+func (entityClass *EntityClass) GetReplacedBy() string {
+	return replacedBy(entityClass.Entity)
+}
+
+// IsDeprecated returns the egcl:deprecated flag of the constraint
+func (c *Constraint) IsDeprecated() bool {
+	return isDeprecated(c.Entity)
+}
+
+// GetReplacedBy returns the property or reference class that replaces the one constrained by a deprecated constraint
+func (c *Constraint) GetReplacedBy() string {
+	return replacedBy(c.Entity)
+}
+
+// checkDeprecations reports warnings for an entity that is an instance of a deprecated class, or that uses properties
+// and references with deprecated constraints
+func (v *Validator) checkDeprecations(schema *Schema, class string, entity *egdm.Entity) []*ConstraintViolation {
+	violations := make([]*ConstraintViolation, 0)
+	if v.settings != nil && v.settings.IgnoreDeprecations {
+		return violations
+	}
+
+	if entityClass := schema.GetEntityClassById(class); entityClass != nil && entityClass.IsDeprecated() {
+		violation := NewConstraintViolation(nil, entity, DeprecatedEntityClassUsed,
+			deprecationMessage(schema, fmt.Sprintf("%s %s: entity class is deprecated", schema.displayName(class), entity.ID), entityClass.GetReplacedBy()))
+		violation.Severity = SeverityWarning
+		violation.EntityClass = class
+		violations = append(violations, violation)
+	}
+
+	for _, constraint := range schema.GetConstraintsForEntityClass(class, true) {
+		propertyConstraint, ok := constraint.(propertyClassConstraint)
+		if !ok || !constraint.IsDeprecated() {
+			continue
+		}
+		property, err := propertyConstraint.GetConstrainedPropertyClass()
+		if err != nil {
+			continue
+		}
+		if len(toValueArray(entity.Properties[property])) == 0 && len(makeStringArray(entity.References[property])) == 0 {
+			continue
+		}
+		violation := NewConstraintViolation(constraint, entity, DeprecatedPropertyUsed,
+			deprecationMessage(schema, fmt.Sprintf("%s %s, %s: property is deprecated", schema.displayName(class), entity.ID,
+				schema.displayName(property)), constraint.GetReplacedBy()))
+		violation.Severity = SeverityWarning
+		violation.EntityClass = class
+		violation.Property = property
+		violations = append(violations, violation)
+	}
+	return violations
+}
+
+func deprecationMessage(schema *Schema, message string, replacement string) string {
+	if replacement == "" {
+		return message
+	}
+	return fmt.Sprintf("%s, use %s instead", message, schema.displayName(replacement))
+}
+
+// yamlDate keeps dates as written, YAML decodes unquoted dates as time values
+func yamlDate(value any) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format(time.DateOnly)
+	}
+	return fmt.Sprint(value)
+}
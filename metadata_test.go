@@ -0,0 +1,149 @@
+package egcl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const metadataSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    xsd: http://www.w3.org/2001/XMLSchema#
+    egcl: http://data.mimiro.io/egcl/
+  baseURI: http://data.mimiro.io/amodel
+  title: People
+  version: 2.1.0
+  description: People and the units they work for
+  owners: [data-platform, hr]
+  deprecated: true
+  deprecationDate: 2024-06-01
+  removalDate: "2025-01-01"
+
+- id: model:Person
+  label: Person
+  propertyConstraints:
+    - propertyClass: model:name
+      datatype: xsd:string
+      minCard: 1
+    - propertyClass: model:fax
+      deprecated: true
+    - propertyClass: model:phone
+      deprecated: true
+      replacedBy: model:mobile
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      referencedEntityClass: model:Department
+
+- id: model:Department
+  deprecated: true
+  replacedBy: model:Unit
+`
+
+func TestSchemaMetadata(t *testing.T) {
+	schema, err := NewSchemaFromYaml(metadataSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.BaseURI != "http://data.mimiro.io/amodel" || schema.Title != "People" || schema.Version != "2.1.0" ||
+		schema.Description != "People and the units they work for" {
+		t.Errorf("unexpected schema metadata %s, %s, %s, %s", schema.BaseURI, schema.Title, schema.Version, schema.Description)
+	}
+	if len(schema.Owners) != 2 || schema.Owners[1] != "hr" {
+		t.Errorf("unexpected owners %v", schema.Owners)
+	}
+	if !schema.Deprecated || schema.DeprecationDate != "2024-06-01" || schema.RemovalDate != "2025-01-01" {
+		t.Errorf("unexpected deprecation %v, %s, %s", schema.Deprecated, schema.DeprecationDate, schema.RemovalDate)
+	}
+
+	department := schema.GetEntityClassById("http://data.mimiro.io/amodel/Department")
+	if !department.IsDeprecated() || department.GetReplacedBy() != "http://data.mimiro.io/amodel/Unit" {
+		t.Error("expected department to be deprecated and replaced by unit")
+	}
+
+	invalid := strings.Replace(metadataSchemaYaml, "- id: model:Department\n  deprecated: true", "- id: model:Department\n  deprecated: \"yes\"", 1)
+	if invalid == metadataSchemaYaml {
+		t.Fatal("expected the department deprecation to be replaced")
+	}
+	if _, err := NewSchemaFromYaml(invalid); err == nil {
+		t.Error("expected an error for a deprecation that is not true or false")
+	}
+}
+
+func TestDeprecationWarnings(t *testing.T) {
+	schema, err := NewSchemaFromYaml(metadataSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/things/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+	person.SetProperty("http://data.mimiro.io/amodel/name", "bob")
+	person.SetProperty("http://data.mimiro.io/amodel/phone", "12345678")
+	department := egdm.NewEntity().SetID("http://data.mimiro.io/things/sales")
+	department.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Department")
+
+	ec := egdm.NewEntityCollection(nil)
+	_ = ec.AddEntity(person)
+	_ = ec.AddEntity(department)
+
+	ok, violations, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntityCollection(schema, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("expected deprecation warnings not to fail validation")
+	}
+	expected := map[string]ViolationType{
+		"Person http://data.mimiro.io/things/bob, model:phone: property is deprecated, use model:mobile instead":  DeprecatedPropertyUsed,
+		"model:Department http://data.mimiro.io/things/sales: entity class is deprecated, use model:Unit instead": DeprecatedEntityClassUsed,
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("expected %d warnings, got %d", len(expected), len(violations))
+	}
+	for _, violation := range violations {
+		if violationType, ok := expected[violation.Message]; !ok || violationType != violation.ViolationType {
+			t.Errorf("unexpected warning %s", violation.Message)
+		}
+		if violation.Severity != SeverityWarning {
+			t.Errorf("expected warning severity for %s", violation.Message)
+		}
+	}
+
+	_, violations, _ = NewValidator().WithSettings(&ValidatorSettings{IgnoreDeprecations: true}).ValidateEntityCollection(schema, ec)
+	if len(violations) != 0 {
+		t.Errorf("expected deprecations to be ignored, got %d violations", len(violations))
+	}
+}
+
+func TestGenerateMarkdown(t *testing.T) {
+	schema, err := NewSchemaFromYaml(metadataSchemaYaml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := GenerateMarkdown(schema, &buf); err != nil {
+		t.Fatal(err)
+	}
+	docs := buf.String()
+	for _, expected := range []string{
+		"# People",
+		"> **Deprecated** since 2024-06-01, to be removed 2025-01-01",
+		"- Version: 2.1.0",
+		"- Owners: data-platform, hr",
+		"## model:Department\n\n`http://data.mimiro.io/amodel/Department`\n\n> **Deprecated**, replaced by model:Unit",
+		"| model:name | property | 1..* | xsd:string |  |",
+		"| model:phone | property | 0..* |  | **Deprecated**, replaced by model:mobile |",
+		"| model:worksFor | reference | 0..* | model:Department |  |",
+	} {
+		if !strings.Contains(docs, expected) {
+			t.Errorf("expected %q in\n%s", expected, docs)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package egcl
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const EGCLPathConstraint = EGCLUriExpansion + "PathConstraint"
+
+const (
+	EGCLpath      = EGCLUriExpansion + "path"
+	EGCLotherPath = EGCLUriExpansion + "otherPath"
+)
+
+// MaxPathHopResults limits the number of entities returned by each hop when a path is evaluated through a data provider
+const MaxPathHopResults = 10000
+
+// PropertyPath is a path through the entity graph, written in a subset of the SPARQL property path syntax:
+//
+//	a/b    sequence, follow a and then b
+//	^a     inverse, follow a from the referenced to the referencing entity
+//	a|b    alternative, follow either a or b
+//	a*     zero or more, follow a any number of times, including none
+//	(a)    grouping
+//
+// Predicates are prefixed names, like mimiro-schema:worksFor, or full URIs in angle brackets. A path is evaluated from
+// an entity to the ids of the entities it reaches, the last step yields property values when the entity has no
+// references with that predicate.
+type PropertyPath interface {
+	// String returns the path in the path syntax with full URIs
+	String() string
+	evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error)
+}
+
+type PredicatePath struct {
+	Predicate string
+}
+
+type InversePath struct {
+	Path PropertyPath
+}
+
+type SequencePath struct {
+	Paths []PropertyPath
+}
+
+type AlternativePath struct {
+	Paths []PropertyPath
+}
+
+type ZeroOrMorePath struct {
+	Path PropertyPath
+}
+
+func (p *PredicatePath) String() string {
+	return "<" + p.Predicate + ">"
+}
+
+func (p *InversePath) String() string {
+	return "^" + groupPath(p.Path)
+}
+
+func (p *SequencePath) String() string {
+	return joinPaths(p.Paths, "/")
+}
+
+func (p *AlternativePath) String() string {
+	return joinPaths(p.Paths, "|")
+}
+
+func (p *ZeroOrMorePath) String() string {
+	return groupPath(p.Path) + "*"
+}
+
+func groupPath(path PropertyPath) string {
+	switch path.(type) {
+	case *SequencePath, *AlternativePath:
+		return "(" + path.String() + ")"
+	}
+	return path.String()
+}
+
+func joinPaths(paths []PropertyPath, separator string) string {
+	parts := make([]string, len(paths))
+	for i, path := range paths {
+		parts[i] = groupPath(path)
+	}
+	return strings.Join(parts, separator)
+}
+
+func (p *PredicatePath) evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error) {
+	result := make([]any, 0)
+	seen := make(map[any]bool)
+	for _, node := range nodes {
+		id, isId := node.(string)
+		if !isId {
+			continue
+		}
+		values, err := navigator.follow(id, p.Predicate, inverse)
+		if err != nil {
+			return nil, err
+		}
+		result = appendDistinct(result, seen, values)
+	}
+	return result, nil
+}
+
+func (p *InversePath) evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error) {
+	return p.Path.evaluate(nodes, navigator, !inverse)
+}
+
+func (p *SequencePath) evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error) {
+	var err error
+	for i := range p.Paths {
+		step := p.Paths[i]
+		if inverse {
+			step = p.Paths[len(p.Paths)-1-i]
+		}
+		nodes, err = step.evaluate(nodes, navigator, inverse)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+func (p *AlternativePath) evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error) {
+	result := make([]any, 0)
+	seen := make(map[any]bool)
+	for _, alternative := range p.Paths {
+		values, err := alternative.evaluate(nodes, navigator, inverse)
+		if err != nil {
+			return nil, err
+		}
+		result = appendDistinct(result, seen, values)
+	}
+	return result, nil
+}
+
+func (p *ZeroOrMorePath) evaluate(nodes []any, navigator pathNavigator, inverse bool) ([]any, error) {
+	seen := make(map[any]bool)
+	result := appendDistinct(make([]any, 0), seen, nodes)
+	frontier := result
+	for len(frontier) > 0 {
+		values, err := p.Path.evaluate(frontier, navigator, inverse)
+		if err != nil {
+			return nil, err
+		}
+		before := len(result)
+		result = appendDistinct(result, seen, values)
+		frontier = result[before:]
+	}
+	return result, nil
+}
+
+// appendDistinct appends the values not seen before, values of a kind that cannot be a map key are always appended
+func appendDistinct(result []any, seen map[any]bool, values []any) []any {
+	for _, value := range values {
+		switch value.(type) {
+		case []any, map[string]any:
+			result = append(result, value)
+			continue
+		}
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// ParsePropertyPath parses a path, prefixed names are expanded with the namespace manager
+func ParsePropertyPath(path string, namespaceManager egdm.NamespaceManager) (PropertyPath, error) {
+	p := &pathParser{input: path, namespaceManager: namespaceManager}
+	result, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.input) {
+		return nil, p.errorf("unexpected '%c'", p.input[p.pos])
+	}
+	return result, nil
+}
+
+type pathParser struct {
+	input            string
+	pos              int
+	namespaceManager egdm.NamespaceManager
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return errors.Errorf("invalid path '%s' at position %d: %s", p.input, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *pathParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *pathParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) parseAlternative() (PropertyPath, error) {
+	paths := make([]PropertyPath, 0)
+	for {
+		path, err := p.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.consume('|') {
+			break
+		}
+	}
+	if len(paths) == 1 {
+		return paths[0], nil
+	}
+	return &AlternativePath{Paths: paths}, nil
+}
+
+func (p *pathParser) parseSequence() (PropertyPath, error) {
+	paths := make([]PropertyPath, 0)
+	for {
+		path, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		if !p.consume('/') {
+			break
+		}
+	}
+	if len(paths) == 1 {
+		return paths[0], nil
+	}
+	return &SequencePath{Paths: paths}, nil
+}
+
+func (p *pathParser) parseUnary() (PropertyPath, error) {
+	if p.consume('^') {
+		path, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &InversePath{Path: path}, nil
+	}
+
+	path, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume('*') {
+		path = &ZeroOrMorePath{Path: path}
+	}
+	return path, nil
+}
+
+func (p *pathParser) parsePrimary() (PropertyPath, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("expected a predicate")
+	}
+
+	switch p.input[p.pos] {
+	case '(':
+		p.pos++
+		path, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(')') {
+			return nil, p.errorf("expected ')'")
+		}
+		return path, nil
+	case '<':
+		end := strings.IndexByte(p.input[p.pos:], '>')
+		if end < 0 {
+			return nil, p.errorf("expected '>'")
+		}
+		uri := p.input[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+		return &PredicatePath{Predicate: uri}, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.input) && !strings.ContainsRune("/|^*()<> \t", rune(p.input[p.pos])) {
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("unexpected '%c'", p.input[p.pos])
+	}
+	name := p.input[start:p.pos]
+	if p.namespaceManager == nil {
+		return nil, p.errorf("no namespaces to expand %s", name)
+	}
+	uri, err := p.namespaceManager.GetFullURI(name)
+	if err != nil {
+		return nil, p.errorf("unknown prefix in %s", name)
+	}
+	return &PredicatePath{Predicate: uri}, nil
+}
+
+// pathNavigator follows a single predicate from an entity
+type pathNavigator interface {
+	// follow returns the ids of the entities referenced from the entity, or referencing it when inverse is true. Going
+	// forward, the property values are returned when the entity has no such references.
+	follow(id string, predicate string, inverse bool) ([]any, error)
+	// hasClass checks that the entity exists and is an instance of the class
+	hasClass(id string, class string) (bool, error)
+}
+
+// newPathNavigator navigates through the data provider when there is one and otherwise through the local graph of the
+// entities being validated. The entity the path starts from is always read directly.
+func (v *Validator) newPathNavigator(schema *Schema, root *egdm.Entity) pathNavigator {
+	if v.dataProvider != nil {
+		return &providerNavigator{validator: v, schema: schema, root: root}
+	}
+	graph := v.localGraph
+	if graph == nil {
+		graph = newLocalGraph(nil)
+	}
+	return &localNavigator{graph: graph, schema: schema, root: root}
+}
+
+func followEntity(entity *egdm.Entity, predicate string) []any {
+	if refs := makeStringArray(entity.References[predicate]); len(refs) > 0 {
+		return toValueArray(refs)
+	}
+	return toValueArray(entity.Properties[predicate])
+}
+
+type providerNavigator struct {
+	validator *Validator
+	schema    *Schema
+	root      *egdm.Entity
+}
+
+func (n *providerNavigator) follow(id string, predicate string, inverse bool) ([]any, error) {
+	if !inverse && id == n.root.ID {
+		return followEntity(n.root, predicate), nil
+	}
+
+	datasets := n.validator.datasetsContext()
+	iterator, err := n.validator.dataProvider.Hop(id, predicate, datasets, inverse, MaxPathHopResults)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]any, 0)
+	if iterator != nil {
+		entity, err := iterator.Next()
+		for entity != nil && err == nil {
+			result = append(result, entity.ID)
+			entity, err = iterator.Next()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// property values at the end of the path are read from the entity itself
+	if !inverse && len(result) == 0 {
+		entity, err := n.validator.dataProvider.GetEntity(id, datasets)
+		if err != nil {
+			return nil, err
+		}
+		if entity != nil {
+			result = toValueArray(entity.Properties[predicate])
+		}
+	}
+	return result, nil
+}
+
+func (n *providerNavigator) hasClass(id string, class string) (bool, error) {
+	valid, _, err := n.validator.CheckExistenceAndTypeOfReferencedEntity(n.schema, id, class)
+	return valid, err
+}
+
+// localGraph indexes a set of entities by id and by the entities that reference them
+type localGraph struct {
+	entities map[string]*egdm.Entity
+	inverse  map[string]map[string][]any
+}
+
+func newLocalGraph(entities []*egdm.Entity) *localGraph {
+	g := &localGraph{entities: make(map[string]*egdm.Entity), inverse: make(map[string]map[string][]any)}
+	for _, entity := range entities {
+		g.entities[entity.ID] = entity
+		for predicate, refs := range entity.References {
+			if g.inverse[predicate] == nil {
+				g.inverse[predicate] = make(map[string][]any)
+			}
+			for _, ref := range makeStringArray(refs) {
+				g.inverse[predicate][ref] = append(g.inverse[predicate][ref], entity.ID)
+			}
+		}
+	}
+	return g
+}
+
+type localNavigator struct {
+	graph  *localGraph
+	schema *Schema
+	root   *egdm.Entity
+}
+
+func (n *localNavigator) entity(id string) *egdm.Entity {
+	if id == n.root.ID {
+		return n.root
+	}
+	return n.graph.entities[id]
+}
+
+func (n *localNavigator) follow(id string, predicate string, inverse bool) ([]any, error) {
+	if inverse {
+		return n.graph.inverse[predicate][id], nil
+	}
+	entity := n.entity(id)
+	if entity == nil {
+		return []any{}, nil
+	}
+	return followEntity(entity, predicate), nil
+}
+
+func (n *localNavigator) hasClass(id string, class string) (bool, error) {
+	entity := n.entity(id)
+	if entity == nil || entity.IsDeleted {
+		return false, nil
+	}
+	return n.schema.IsInstanceOfClass(makeStringArray(entity.References[RDfTypeURI]), class), nil
+}
+
+func newPathConstraint(entity *egdm.Entity) *PathConstraint {
+	c := &PathConstraint{}
+	c.Constraint.Entity = entity
+	c.Constraint.ConstraintTypeIdentifier = EGCLPathConstraint
+	return c
+}
+
+// PathConstraint constrains what an entity reaches through the egcl:path property path. egcl:minCard and egcl:maxCard
+// limit the number of distinct entities or values reached, egcl:referencedEntityClass requires every entity reached to
+// be an instance of the class, and egcl:operator compares the values reached with those reached through egcl:otherPath
+// in the same way as a PropertyComparisonConstraint.
+type PathConstraint struct {
+	Constraint
+	pathOnce  sync.Once
+	path      PropertyPath
+	otherPath PropertyPath
+	pathErr   error
+}
+
+func (c *PathConstraint) GetPathExpression() string {
+	path, _ := c.Entity.GetFirstStringPropertyValue(EGCLpath)
+	return path
+}
+
+func (c *PathConstraint) GetOtherPathExpression() string {
+	path, _ := c.Entity.GetFirstStringPropertyValue(EGCLotherPath)
+	return path
+}
+
+// GetPaths parses the path and the other path, which is nil when not given. Prefixed names are expanded with the
+// namespaces of the schema, the paths are parsed once.
+func (c *PathConstraint) GetPaths(namespaceManager egdm.NamespaceManager) (PropertyPath, PropertyPath, error) {
+	c.pathOnce.Do(func() {
+		c.path, c.pathErr = ParsePropertyPath(c.GetPathExpression(), namespaceManager)
+		if c.pathErr != nil {
+			return
+		}
+		if other := c.GetOtherPathExpression(); other != "" {
+			c.otherPath, c.pathErr = ParsePropertyPath(other, namespaceManager)
+		}
+	})
+	return c.path, c.otherPath, c.pathErr
+}
+
+func (c *PathConstraint) GetMinAllowedOccurrences() int {
+	minCard, err := c.Entity.GetFirstIntPropertyValue(EGCLminCardinality)
+	if err != nil {
+		return 0
+	}
+	return minCard
+}
+
+func (c *PathConstraint) GetMaxAllowedOccurrences() int {
+	maxCard, err := c.Entity.GetFirstIntPropertyValue(EGCLmaxCardinality)
+	if err != nil {
+		return -1
+	}
+	return maxCard
+}
+
+func (c *PathConstraint) GetAllowedReferencedClass() (string, error) {
+	return c.Entity.GetFirstReferenceValue(EGCLallowedReferencedClass)
+}
+
+// GetOperator returns the operator used to compare with the other path
+func (c *PathConstraint) GetOperator() string {
+	operator, err := c.Entity.GetFirstStringPropertyValue(EGCLoperator)
+	if err != nil {
+		return ""
+	}
+	return operator
+}
+
+func (c *PathConstraint) checkDefinition() error {
+	if c.GetOtherPathExpression() != "" && !isComparisonOperator(c.GetOperator()) {
+		return errors.Errorf("path constraint %s has unknown operator '%s'", c.GetID(), c.GetOperator())
+	}
+	return nil
+}
+
+func (c *PathConstraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return validator.CheckPathConstraint(schema, entity, c)
+}
+
+// CheckPathConstraint evaluates the path of the constraint from the entity
+func (v *Validator) CheckPathConstraint(schema *Schema, entity *egdm.Entity, constraint *PathConstraint) (bool, *ConstraintViolation, error) {
+	var namespaceManager egdm.NamespaceManager
+	if schema.EntityCollection != nil {
+		namespaceManager = schema.EntityCollection.NamespaceManager
+	}
+	path, otherPath, err := constraint.GetPaths(namespaceManager)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "path constraint %s", constraint.GetID())
+	}
+
+	navigator := v.newPathNavigator(schema, entity)
+	reached, err := path.evaluate([]any{entity.ID}, navigator, false)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if minCard := constraint.GetMinAllowedOccurrences(); len(reached) < minCard {
+		return false, NewConstraintViolation(constraint, entity, MinReferenceOccurrenceNotMet,
+			fmt.Sprintf("path %s reaches %d entities but min card is %d", constraint.GetPathExpression(), len(reached), minCard)).
+			WithDetails(constraint.GetPathExpression(), minCard, len(reached)), nil
+	}
+	if maxCard := constraint.GetMaxAllowedOccurrences(); maxCard >= 0 && len(reached) > maxCard {
+		return false, NewConstraintViolation(constraint, entity, MaxReferenceOccurrenceExceeded,
+			fmt.Sprintf("path %s reaches %d entities but max card is %d", constraint.GetPathExpression(), len(reached), maxCard)).
+			WithDetails(constraint.GetPathExpression(), maxCard, len(reached)), nil
+	}
+
+	if class, err := constraint.GetAllowedReferencedClass(); err == nil {
+		for _, node := range reached {
+			id, isId := node.(string)
+			valid := false
+			if isId {
+				valid, err = navigator.hasClass(id, class)
+				if err != nil {
+					return false, nil, err
+				}
+			}
+			if !valid {
+				return false, NewConstraintViolation(constraint, entity, ReferenceTypeMismatch,
+					fmt.Sprintf("path %s reaches %v which is not a %s", constraint.GetPathExpression(), node, class)).
+					WithDetails(constraint.GetPathExpression(), class, node), nil
+			}
+		}
+	}
+
+	if otherPath != nil {
+		otherReached, err := otherPath.evaluate([]any{entity.ID}, navigator, false)
+		if err != nil {
+			return false, nil, err
+		}
+		holds, message, err := compareValueSets(constraint.GetOperator(), constraint.GetPathExpression(), reached,
+			constraint.GetOtherPathExpression(), otherReached)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "path constraint %s", constraint.GetID())
+		}
+		if !holds {
+			return false, NewConstraintViolation(constraint, entity, PropertyComparisonFailed, message).
+				WithDetails(constraint.GetPathExpression(), otherReached, reached), nil
+		}
+	}
+
+	return true, nil, nil
+}
@@ -0,0 +1,264 @@
+package egcl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// sliceEntityIterator iterates over a fixed list of entities
+type sliceEntityIterator struct {
+	entities []*egdm.Entity
+}
+
+func (it *sliceEntityIterator) Context() *egdm.Context {
+	return nil
+}
+
+func (it *sliceEntityIterator) Next() (*egdm.Entity, error) {
+	if len(it.entities) == 0 {
+		return nil, nil
+	}
+	entity := it.entities[0]
+	it.entities = it.entities[1:]
+	return entity, nil
+}
+
+func (it *sliceEntityIterator) Token() *egdm.Continuation {
+	return nil
+}
+
+// hopDataProvider answers hops from an in memory set of entities
+type hopDataProvider struct {
+	*countingDataProvider
+	hops int
+}
+
+func (p *hopDataProvider) Hop(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (datahub.EntityIterator, error) {
+	p.hops++
+	result := make([]*egdm.Entity, 0)
+	if inverse {
+		for _, e := range p.entities {
+			for _, ref := range makeStringArray(e.References[reference]) {
+				if ref == sourceEntityId {
+					result = append(result, e)
+				}
+			}
+		}
+	} else if source, ok := p.entities[sourceEntityId]; ok {
+		for _, ref := range makeStringArray(source.References[reference]) {
+			if target, ok := p.entities[ref]; ok {
+				result = append(result, target)
+			}
+		}
+	}
+	return &sliceEntityIterator{entities: result}, nil
+}
+
+func TestParsePropertyPath(t *testing.T) {
+	nsm := egdm.NewNamespaceContext()
+	nsm.StorePrefixExpansionMapping("model", "http://data.mimiro.io/amodel/")
+
+	cases := map[string]string{
+		"model:worksFor":                          "<http://data.mimiro.io/amodel/worksFor>",
+		"model:worksFor / model:partOf*":          "<http://data.mimiro.io/amodel/worksFor>/<http://data.mimiro.io/amodel/partOf>*",
+		"^model:owner|(model:a/model:b)":          "^<http://data.mimiro.io/amodel/owner>|(<http://data.mimiro.io/amodel/a>/<http://data.mimiro.io/amodel/b>)",
+		"^(model:a|model:b)*":                     "^(<http://data.mimiro.io/amodel/a>|<http://data.mimiro.io/amodel/b>)*",
+		"<http://data.mimiro.io/other/x>/model:y": "<http://data.mimiro.io/other/x>/<http://data.mimiro.io/amodel/y>",
+	}
+	for input, expected := range cases {
+		path, err := ParsePropertyPath(input, nsm)
+		if err != nil {
+			t.Errorf("parse %s: %v", input, err)
+			continue
+		}
+		if path.String() != expected {
+			t.Errorf("parse %s: expected %s, got %s", input, expected, path.String())
+		}
+	}
+
+	for _, invalid := range []string{"", "model:a/", "(model:a", "model:a)", "<http://x", "unknown:a", "model:a||model:b"} {
+		if _, err := ParsePropertyPath(invalid, nsm); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+const pathSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  pathConstraints:
+    - path: model:worksFor/model:partOf*
+      referencedEntityClass: model:Unit
+    - path: model:worksFor/model:partOf*
+      minCard: 2
+
+- id: model:Unit
+
+- id: model:OrgUnit
+  superclasses: [model:Unit]
+  pathConstraints:
+    - path: ^model:worksFor|^model:partOf
+      minCard: 1
+
+- id: model:Site
+  pathConstraints:
+    - path: model:owner/model:country
+      operator: "="
+      otherPath: model:country
+`
+
+func newPathTestEntities() []*egdm.Entity {
+	entity := func(id string, class string, refs map[string]any, props map[string]any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/"+class)
+		for k, v := range refs {
+			e.SetReference("http://data.mimiro.io/amodel/"+k, v)
+		}
+		for k, v := range props {
+			e.SetProperty("http://data.mimiro.io/amodel/"+k, v)
+		}
+		return e
+	}
+	return []*egdm.Entity{
+		entity("company", "OrgUnit", nil, nil),
+		entity("sales", "OrgUnit", map[string]any{"partOf": "http://data.mimiro.io/things/company"}, nil),
+		entity("empty", "OrgUnit", nil, nil),
+		entity("alice", "Person", map[string]any{"worksFor": "http://data.mimiro.io/things/sales"}, nil),
+		entity("bob", "Person", map[string]any{"worksFor": "http://data.mimiro.io/things/alice"}, nil),
+		entity("owner", "Person", map[string]any{"worksFor": "http://data.mimiro.io/things/company"},
+			map[string]any{"country": "NO"}),
+		entity("oslo", "Site", map[string]any{"owner": "http://data.mimiro.io/things/owner"}, map[string]any{"country": "NO"}),
+		entity("bergen", "Site", map[string]any{"owner": "http://data.mimiro.io/things/owner"}, map[string]any{"country": "SE"}),
+	}
+}
+
+func violationsByEntity(violations []*ConstraintViolation) map[string][]ViolationType {
+	result := make(map[string][]ViolationType)
+	for _, violation := range violations {
+		id := violation.Entity.ID[len("http://data.mimiro.io/things/"):]
+		result[id] = append(result[id], violation.ViolationType)
+	}
+	return result
+}
+
+func checkPathViolations(t *testing.T, violations []*ConstraintViolation) {
+	t.Helper()
+	got := violationsByEntity(violations)
+	expected := map[string][]ViolationType{
+		// works for a person, which is not a unit, and reaches only one entity
+		"bob": {ReferenceTypeMismatch, MinReferenceOccurrenceNotMet},
+		// reaches only the company
+		"owner": {MinReferenceOccurrenceNotMet},
+		// nothing is part of it and nobody works for it
+		"empty":  {MinReferenceOccurrenceNotMet},
+		"bergen": {PropertyComparisonFailed},
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected violations for %d entities, got %v", len(expected), got)
+	}
+	for id, types := range expected {
+		if len(got[id]) != len(types) {
+			t.Errorf("expected %v for %s, got %v", types, id, got[id])
+			continue
+		}
+		for i := range types {
+			if got[id][i] != types[i] {
+				t.Errorf("expected %v for %s, got %v", types, id, got[id])
+			}
+		}
+	}
+}
+
+func TestPathConstraintsOffline(t *testing.T) {
+	schema, err := parseYaml([]byte(pathSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := strings.Replace(pathSchemaYaml, "minCard: 2", "minCard: 2.0", 1)
+	if _, err := parseYaml([]byte(invalid)); err == nil {
+		t.Error("expected an error for a cardinality that is not an integer")
+	}
+
+	ec := egdm.NewEntityCollection(nil)
+	for _, e := range newPathTestEntities() {
+		_ = ec.AddEntity(e)
+	}
+
+	_, violations, err := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntityCollection(schema, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPathViolations(t, violations)
+}
+
+func TestPathConstraintsOnline(t *testing.T) {
+	schema, err := parseYaml([]byte(pathSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// without settings every dataset is in context
+	for name, settings := range map[string]*ValidatorSettings{"with settings": {}, "without settings": nil} {
+		t.Run(name, func(t *testing.T) {
+			entities := newPathTestEntities()
+			provider := &hopDataProvider{countingDataProvider: newCountingDataProvider(entities...)}
+			v := NewValidator().WithDataProvider(provider)
+			if settings != nil {
+				v = v.WithSettings(settings)
+			}
+
+			violations := make([]*ConstraintViolation, 0)
+			for _, e := range entities {
+				_, entityViolations, err := v.ValidateEntity(schema, e)
+				if err != nil {
+					t.Fatal(err)
+				}
+				violations = append(violations, entityViolations...)
+			}
+			checkPathViolations(t, violations)
+			if provider.hops == 0 {
+				t.Error("expected paths to be evaluated with hops")
+			}
+		})
+	}
+}
+
+func TestPathConstraintSHACL(t *testing.T) {
+	schema, err := parseYaml([]byte(pathSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sequences, alternatives, zeroOrMore := 0, 0, 0
+	for _, shape := range shapes.GetEntities() {
+		path, isPath := shape.Properties[SHACLpath].(*egdm.Entity)
+		if !isPath {
+			continue
+		}
+		if list, isList := path.Properties["@list"].([]any); isList && len(list) == 2 {
+			sequences++
+			if list[1].(*egdm.Entity).Properties[SHACLzeroOrMorePath] != nil {
+				zeroOrMore++
+			}
+		} else if path.Properties[SHACLalternativePath] != nil {
+			alternatives++
+		}
+	}
+	if sequences != 3 || alternatives != 1 || zeroOrMore != 2 {
+		t.Errorf("expected 3 sequence paths, 2 ending in zero or more, and 1 alternative path, got %d, %d and %d",
+			sequences, zeroOrMore, alternatives)
+	}
+}
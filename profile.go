@@ -0,0 +1,148 @@
+package egcl
+
+const (
+	EGCLdeactivated = EGCLUriExpansion + "deactivated"
+	EGCLtag         = EGCLUriExpansion + "tag"
+)
+
+// ValidationProfile selects the constraints that are checked, so that constraints can be switched off for a dataset
+// or pipeline without editing the schema. Constraints and tags limit validation to the matching constraints, when both
+// are empty all constraints are included. Excluded constraints and tags are left out in any case. A deactivated
+// constraint is only checked if the profile includes it by id.
+type ValidationProfile struct {
+	// Name identifies the profile, like the dataset or pipeline it is used for
+	Name string
+	// Constraints are the ids of the constraints to include
+	Constraints []string
+	// Tags include the constraints that have any of the tags
+	Tags []string
+	// ExcludeConstraints are the ids of constraints to leave out
+	ExcludeConstraints []string
+	// ExcludeTags leave out the constraints that have any of the tags
+	ExcludeTags []string
+}
+
+// IsActive returns true if the constraint is checked in the profile. A nil profile includes all constraints that are
+// not deactivated.
+func (profile *ValidationProfile) IsActive(constraint ConstraintType) bool {
+	if profile == nil {
+		return !constraint.IsDeactivated()
+	}
+
+	id := constraint.GetID()
+	tags := constraint.GetTags()
+	if containsString(profile.ExcludeConstraints, id) || containsAnyString(profile.ExcludeTags, tags) {
+		return false
+	}
+
+	included := containsString(profile.Constraints, id)
+	if constraint.IsDeactivated() && !included {
+		return false
+	}
+	if len(profile.Constraints) == 0 && len(profile.Tags) == 0 {
+		return true
+	}
+	return included || containsAnyString(profile.Tags, tags)
+}
+
+// IsDeactivated returns the egcl:deactivated flag of the constraint
+func (c *Constraint) IsDeactivated() bool {
+	if c.Entity == nil {
+		return false
+	}
+	deactivated, ok := c.Entity.Properties[EGCLdeactivated].(bool)
+	return ok && deactivated
+}
+
+// GetTags returns the egcl:tag values of the constraint
+func (c *Constraint) GetTags() []string {
+	if c.Entity == nil {
+		return nil
+	}
+	tags := make([]string, 0)
+	for _, value := range toValueArray(c.Entity.Properties[EGCLtag]) {
+		if tag, ok := value.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// WithProfile returns a view of the schema where the constraint lookups only return the constraints that are active
+// in the profile. Constraint ids in the profile can use the prefixes of the schema. The view shares classes,
+// constraints and indexes with the schema.
+func (aSchema *Schema) WithProfile(profile *ValidationProfile) *Schema {
+	view := *aSchema
+	view.profile = profile
+	view.activeProfile = profile
+	if profile != nil && aSchema.EntityCollection != nil && aSchema.EntityCollection.NamespaceManager != nil {
+		expanded := *profile
+		expanded.Constraints = aSchema.expandIdentifiers(profile.Constraints)
+		expanded.ExcludeConstraints = aSchema.expandIdentifiers(profile.ExcludeConstraints)
+		view.activeProfile = &expanded
+	}
+	return &view
+}
+
+// GetProfile returns the profile selected with WithProfile, or nil
+func (aSchema *Schema) GetProfile() *ValidationProfile {
+	return aSchema.profile
+}
+
+// IsActive returns true if the constraint is active in the profile of the schema
+func (aSchema *Schema) IsActive(constraint ConstraintType) bool {
+	return aSchema.activeProfile.IsActive(constraint)
+}
+
+// expandIdentifiers returns the identifiers with prefixed names replaced by full URIs
+func (aSchema *Schema) expandIdentifiers(identifiers []string) []string {
+	expanded := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		expanded[i] = identifier
+		if uri, err := aSchema.EntityCollection.NamespaceManager.GetFullURI(identifier); err == nil {
+			expanded[i] = uri
+		}
+	}
+	return expanded
+}
+
+// activeConstraints leaves out the constraints that are not active, the slice is returned as is when nothing can be
+// left out
+func (aSchema *Schema) activeConstraints(constraints []ConstraintType) []ConstraintType {
+	if aSchema.activeProfile == nil && aSchema.index != nil && !aSchema.index.hasDeactivated {
+		return constraints
+	}
+	active := make([]ConstraintType, 0, len(constraints))
+	for _, constraint := range constraints {
+		if aSchema.IsActive(constraint) {
+			active = append(active, constraint)
+		}
+	}
+	return active
+}
+
+// profiledSchema applies the profile in the settings to the schema, unless the schema already has it
+func (v *Validator) profiledSchema(schema *Schema) *Schema {
+	if v.settings == nil || v.settings.Profile == nil || schema.profile == v.settings.Profile {
+		return schema
+	}
+	return schema.WithProfile(v.settings.Profile)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAnyString(values []string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if containsString(values, candidate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const profileSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  propertyConstraints:
+    - id: model:nameRequired
+      propertyClass: model:name
+      minCard: 1
+      tags: [core]
+    - id: model:emailRequired
+      propertyClass: model:email
+      minCard: 1
+      tags: [contact, strict]
+    - id: model:phoneRequired
+      propertyClass: model:phone
+      minCard: 1
+      deactivated: true
+      tags: contact
+`
+
+func TestValidationProfiles(t *testing.T) {
+	schema, err := parseYaml([]byte(profileSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/things/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+
+	cases := []struct {
+		name     string
+		profile  *ValidationProfile
+		expected []string
+	}{
+		{"no profile", nil, []string{"name", "email"}},
+		{"all", &ValidationProfile{}, []string{"name", "email"}},
+		{"by tag", &ValidationProfile{Tags: []string{"contact"}}, []string{"email"}},
+		{"exclude tag", &ValidationProfile{ExcludeTags: []string{"strict"}}, []string{"name"}},
+		{"by id", &ValidationProfile{Constraints: []string{"model:phoneRequired"}}, []string{"phone"}},
+		{"exclude id", &ValidationProfile{Tags: []string{"core", "contact"}, ExcludeConstraints: []string{"http://data.mimiro.io/amodel/nameRequired"}}, []string{"email"}},
+	}
+	for _, tc := range cases {
+		_, violations, err := NewValidator().WithSettings(&ValidatorSettings{Profile: tc.profile}).ValidateEntity(schema, person)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) != len(tc.expected) {
+			t.Errorf("%s: expected %d violations, got %d", tc.name, len(tc.expected), len(violations))
+			continue
+		}
+		for i, property := range tc.expected {
+			if violations[i].Property != "http://data.mimiro.io/amodel/"+property {
+				t.Errorf("%s: expected violation on %s, got %s", tc.name, property, violations[i].Property)
+			}
+		}
+	}
+
+	// the profile is a view, the schema itself is unchanged
+	profiled := schema.WithProfile(&ValidationProfile{Name: "contact", Tags: []string{"contact"}})
+	if len(profiled.GetConstraintsForEntityClass("http://data.mimiro.io/amodel/Person", true)) != 1 {
+		t.Error("expected one active constraint in the contact profile")
+	}
+	if len(schema.GetConstraintsForEntityClass("http://data.mimiro.io/amodel/Person", true)) != 2 {
+		t.Error("expected the deactivated constraint to be left out without a profile")
+	}
+	if len(profiled.GetConstraintsForProperty("http://data.mimiro.io/amodel/name")) != 0 {
+		t.Error("expected the name constraint to be inactive in the contact profile")
+	}
+}
+
+func TestDeactivatedSHACL(t *testing.T) {
+	schema, err := parseYaml([]byte(profileSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deactivated := 0
+	for _, shape := range shapes.GetEntities() {
+		if shape.Properties[SHACLdeactivated] == true {
+			deactivated++
+			if shape.ID != "http://data.mimiro.io/amodel/phoneRequired" {
+				t.Errorf("unexpected deactivated shape %s", shape.ID)
+			}
+		}
+	}
+	if deactivated != 1 {
+		t.Errorf("expected 1 deactivated shape, got %d", deactivated)
+	}
+}
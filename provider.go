@@ -2,11 +2,21 @@ package egcl
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"sync"
+
 	datahub "github.com/mimiro-io/datahub-client-sdk-go"
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 )
 
+// MaxConcurrentQueries limits the number of entity queries RemoteDataProvider runs at the same time for a batch
+const MaxConcurrentQueries = 8
+
+// DatasetChangesPageSize is the number of changes RemoteDataProvider reads from the datahub in one request
+const DatasetChangesPageSize = 1000
+
 type RemoteDataProvider struct {
 	client *datahub.Client
 }
@@ -28,14 +38,19 @@ func (r *RemoteDataProvider) GetEntity(id string, datasets []string) (*egdm.Enti
 	if err != nil {
 		return nil, err
 	}
+	return parseEntityQueryResult(result)
+}
 
+// parseEntityQueryResult reads the entity of an entity query, which comes after the namespace context of the datahub.
+// Identifiers are expanded, so that the entity and its partials can be read by full URIs.
+func parseEntityQueryResult(result []map[string]any) (*egdm.Entity, error) {
 	jsonResult, err := json.Marshal(result)
 	if err != nil {
 		return nil, err
 	}
 
 	nsm := egdm.NewNamespaceContext()
-	parser := egdm.NewEntityParser(nsm)
+	parser := egdm.NewEntityParser(nsm).WithExpandURIs()
 	reader := bytes.NewReader(jsonResult)
 	egc, err := parser.LoadEntityCollection(reader)
 	if err != nil {
@@ -49,10 +64,181 @@ func (r *RemoteDataProvider) GetEntity(id string, datasets []string) (*egdm.Enti
 	return egc.Entities[0], nil
 }
 
+// GetEntities implements BatchDataProvider. The datahub query API looks up one entity id per query, so the queries of
+// a batch run concurrently, at most MaxConcurrentQueries at a time. Ids that fail are returned in a LookupErrors
+// together with the entities that were found.
+func (r *RemoteDataProvider) GetEntities(entityIds []string, datasets []string) (map[string]*egdm.Entity, error) {
+	found := make(map[string]*egdm.Entity)
+	failed := make(LookupErrors)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, MaxConcurrentQueries)
+	for _, id := range entityIds {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(id string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			entity, err := r.GetEntity(id, datasets)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				failed[id] = err
+			} else if entity != nil {
+				found[id] = entity
+			}
+		}(id)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return found, failed
+	}
+	return found, nil
+}
+
 func (r *RemoteDataProvider) GetDatasetEntities(name string) (datahub.EntityIterator, error) {
 	return r.client.GetEntitiesStream(name, "", -1, false, true)
 }
 
+// GetDatasetChanges implements ChangesDataProvider with the latest version of each entity changed since the token. The
+// changes are read in pages of DatasetChangesPageSize entities as the iterator is consumed.
+func (r *RemoteDataProvider) GetDatasetChanges(name string, since string) (datahub.EntityIterator, error) {
+	changes := &changesIterator{since: since, fetch: func(since string) (*egdm.EntityCollection, error) {
+		return r.client.GetChanges(name, since, DatasetChangesPageSize, true, false, true)
+	}}
+	if err := changes.nextPage(); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// changesIterator reads changes a page at a time, each page continuing from the token of the previous one. A page
+// with fewer entities than were asked for is the last one.
+type changesIterator struct {
+	fetch    func(since string) (*egdm.EntityCollection, error)
+	since    string
+	page     []*egdm.Entity
+	context  *egdm.Context
+	token    *egdm.Continuation
+	lastPage bool
+}
+
+func (it *changesIterator) nextPage() error {
+	changes, err := it.fetch(it.since)
+	if err != nil {
+		return err
+	}
+	it.page = changes.Entities
+	it.lastPage = len(changes.Entities) < DatasetChangesPageSize
+	if it.context == nil && changes.NamespaceManager != nil {
+		it.context = changes.NamespaceManager.AsContext()
+	}
+	if changes.Continuation != nil && changes.Continuation.Token != "" {
+		it.token = changes.Continuation
+		it.since = changes.Continuation.Token
+	} else {
+		// without a token to continue from, another page would repeat this one
+		it.lastPage = true
+	}
+	return nil
+}
+
+func (it *changesIterator) Context() *egdm.Context {
+	return it.context
+}
+
+func (it *changesIterator) Next() (*egdm.Entity, error) {
+	for len(it.page) == 0 {
+		if it.lastPage {
+			return nil, nil
+		}
+		if err := it.nextPage(); err != nil {
+			return nil, err
+		}
+	}
+	entity := it.page[0]
+	it.page = it.page[1:]
+	return entity, nil
+}
+
+func (it *changesIterator) Token() *egdm.Continuation {
+	return it.token
+}
+
+// Hop runs a javascript query, as the datahub query API returns hop results in a shape the client cannot read. The
+// query writes the entities at the end of the hop, which are parsed with the namespace context of the datahub.
 func (r *RemoteDataProvider) Hop(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (datahub.EntityIterator, error) {
-	return r.client.RunHopQuery(sourceEntityId, reference, datasets, inverse, limit)
+	query, err := hopQuery(sourceEntityId, reference, datasets, inverse, limit)
+	if err != nil {
+		return nil, err
+	}
+	results, err := r.client.RunJavascriptQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	document := []any{map[string]any{"id": "@context", "namespaces": map[string]any{}}}
+	for {
+		result, err := results.Next()
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			break
+		}
+		document = append(document, result)
+	}
+	if len(document) == 1 {
+		return &collectionIterator{}, nil
+	}
+
+	// the namespaces are those of the datahub, which come with any entity lookup
+	lookup, err := r.client.RunQuery(datahub.NewQueryBuilder().WithEntityId(sourceEntityId).Build())
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range lookup {
+		if item["id"] == "@context" {
+			document[0] = item
+		}
+	}
+
+	jsonResult, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	parser := egdm.NewEntityParser(egdm.NewNamespaceContext()).WithExpandURIs()
+	ec, err := parser.LoadEntityCollection(bytes.NewReader(jsonResult))
+	if err != nil {
+		return nil, err
+	}
+	return &collectionIterator{entities: ec.Entities, context: ec.NamespaceManager.AsContext()}, nil
+}
+
+// hopQueryScript writes the entities related to the start entity through the predicate, at most limit of them when
+// limit is positive
+const hopQueryScript = `function do_query() {
+	const results = Query([%s], %s, %s, %s);
+	for (let i = 0; i < results.length && (%d <= 0 || i < %d); i++) {
+		WriteQueryResult(results[i][2]);
+	}
+}`
+
+// hopQuery returns the base64 encoded javascript query for a hop, the arguments are written as JSON literals
+func hopQuery(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (string, error) {
+	if datasets == nil {
+		datasets = []string{}
+	}
+	arguments := make([]any, 0, 4)
+	for _, value := range []any{sourceEntityId, reference, inverse, datasets} {
+		literal, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		arguments = append(arguments, string(literal))
+	}
+	script := fmt.Sprintf(hopQueryScript, append(arguments, limit, limit)...)
+	return base64.StdEncoding.EncodeToString([]byte(script)), nil
 }
@@ -0,0 +1,62 @@
+package egcl
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestHopQuery(t *testing.T) {
+	query, err := hopQuery(`http://data.mimiro.io/things/"bob"`, "http://data.mimiro.io/amodel/memberOf", nil, true, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := base64.StdEncoding.DecodeString(query)
+	if err != nil {
+		t.Fatalf("expected a base64 encoded query, got %v", err)
+	}
+	expected := `Query(["http://data.mimiro.io/things/\"bob\""], "http://data.mimiro.io/amodel/memberOf", true, []);`
+	if !strings.Contains(string(script), expected) {
+		t.Errorf("expected %s in %s", expected, script)
+	}
+	if !strings.Contains(string(script), "10 <= 0 || i < 10") {
+		t.Errorf("expected the limit in %s", script)
+	}
+}
+
+func TestParseEntityQueryResult(t *testing.T) {
+	var result []map[string]any
+	err := json.Unmarshal([]byte(`[
+		{"id": "@context", "namespaces": {
+			"ns0": "http://data.mimiro.io/core/",
+			"ns1": "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+			"ns2": "http://data.mimiro.io/people/",
+			"ns3": "http://data.mimiro.io/amodel/"
+		}},
+		{"id": "ns2:homer", "refs": {}, "props": {"ns0:partials": [
+			{"id": "ns2:homer", "refs": {"ns1:type": "ns3:Person"}, "props": {"ns0:dataset": "people"}},
+			{"id": "ns2:homer", "refs": {"ns1:type": "ns3:Customer"}, "props": {"ns0:dataset": "crm"}}
+		]}}
+	]`), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entity, err := parseEntityQueryResult(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.ID != "http://data.mimiro.io/people/homer" {
+		t.Errorf("expected an expanded id, got %s", entity.ID)
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{DatasetsContext: []string{"people"}})
+	found, types, err := v.resolveReferencedEntityTypes(entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || len(types) != 1 || types[0] != "http://data.mimiro.io/amodel/Person" {
+		t.Errorf("expected only the type of the people partial, got %v %v", found, types)
+	}
+}
@@ -0,0 +1,390 @@
+package egcl
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+	"sync"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// ValidationObserver is told about each step of validation, it is used to collect statistics beyond the violations
+type ValidationObserver interface {
+	// ObserveInstance is called for each class an entity is validated as an instance of
+	ObserveInstance(schema *Schema, class string, entity *egdm.Entity)
+	// ObserveCheck is called for each constraint checked for an entity as an instance of the class
+	ObserveCheck(schema *Schema, class string, constraint ConstraintType, entity *egdm.Entity, valid bool, violation *ConstraintViolation)
+	// ObserveEntity is called when an entity has been validated by ValidateEntity
+	ObserveEntity(schema *Schema, entity *egdm.Entity, ok bool, violations []*ConstraintViolation)
+}
+
+// WithObserver sets an observer that is told about each entity and constraint check
+func (v *Validator) WithObserver(observer ValidationObserver) *Validator {
+	v.observer = observer
+	return v
+}
+
+var violationTypeNames = map[ViolationType]string{
+	MinPropertyOccurrenceNotMet:    "MinPropertyOccurrenceNotMet",
+	MaxPropertyOccurrenceExceeded:  "MaxPropertyOccurrenceExceeded",
+	MinReferenceOccurrenceNotMet:   "MinReferenceOccurrenceNotMet",
+	MaxReferenceOccurrenceExceeded: "MaxReferenceOccurrenceExceeded",
+	ReferenceNotFound:              "ReferenceNotFound",
+	ReferenceTypeMismatch:          "ReferenceTypeMismatch",
+	AbstractEntityClassViolation:   "AbstractEntityClassViolation",
+	ValuePatternMismatch:           "ValuePatternMismatch",
+	MinValueNotMet:                 "MinValueNotMet",
+	MaxValueExceeded:               "MaxValueExceeded",
+	MinLengthNotMet:                "MinLengthNotMet",
+	MaxLengthExceeded:              "MaxLengthExceeded",
+	ValueNotAllowed:                "ValueNotAllowed",
+	ReferenceNotAllowed:            "ReferenceNotAllowed",
+	LogicalConstraintNotSatisfied:  "LogicalConstraintNotSatisfied",
+	PropertyComparisonFailed:       "PropertyComparisonFailed",
+	DeprecatedEntityClassUsed:      "DeprecatedEntityClassUsed",
+	DeprecatedPropertyUsed:         "DeprecatedPropertyUsed",
+}
+
+func (t ViolationType) String() string {
+	if name, ok := violationTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// QualityReport holds aggregate statistics of a dataset validated against a schema
+type QualityReport struct {
+	Dataset       string `json:"dataset,omitempty"`
+	Entities      int    `json:"entities"`
+	ValidEntities int    `json:"validEntities"`
+	// Classes are the classes of the validated entities, by number of instances
+	Classes []*ClassQuality `json:"classes"`
+	// ViolationTypes are the most frequent violation types first
+	ViolationTypes []*ViolationTypeCount `json:"violationTypes"`
+}
+
+// ClassQuality holds the statistics for the instances of one class
+type ClassQuality struct {
+	EntityClass string `json:"entityClass"`
+	Label       string `json:"label"`
+	// Defined is false for types of the entities that are not classes in the schema
+	Defined     bool                 `json:"defined"`
+	Instances   int                  `json:"instances"`
+	Constraints []*ConstraintQuality `json:"constraints,omitempty"`
+	Properties  []*PropertyQuality   `json:"properties,omitempty"`
+}
+
+// ConstraintQuality counts how many instances of a class passed and failed a constraint
+type ConstraintQuality struct {
+	Constraint string `json:"constraint"`
+	Type       string `json:"type"`
+	Property   string `json:"property,omitempty"`
+	Severity   string `json:"severity"`
+	Passed     int    `json:"passed"`
+	Failed     int    `json:"failed"`
+}
+
+// PropertyQuality describes how a property or reference constrained for a class is filled. Cardinalities maps the
+// number of values to the number of instances that have that many.
+type PropertyQuality struct {
+	Property      string      `json:"property"`
+	Label         string      `json:"label"`
+	Reference     bool        `json:"reference"`
+	Required      bool        `json:"required"`
+	Filled        int         `json:"filled"`
+	FillRate      float64     `json:"fillRate"`
+	Cardinalities map[int]int `json:"cardinalities"`
+	// counted is the instance count when the property was last counted, several constraints can share a property
+	counted int
+}
+
+// ViolationTypeCount is the number of violations of one type
+type ViolationTypeCount struct {
+	ViolationType string `json:"violationType"`
+	Count         int    `json:"count"`
+}
+
+// QualityProfiler is a ValidationObserver that builds a QualityReport
+type QualityProfiler struct {
+	lock           sync.Mutex
+	report         *QualityReport
+	classes        map[string]*ClassQuality
+	constraints    map[string]map[string]*ConstraintQuality
+	properties     map[string]map[string]*PropertyQuality
+	violationTypes map[ViolationType]int
+}
+
+// NewQualityProfiler creates a profiler for the named dataset, the name is only used in the report
+func NewQualityProfiler(dataset string) *QualityProfiler {
+	return &QualityProfiler{
+		report:         &QualityReport{Dataset: dataset},
+		classes:        make(map[string]*ClassQuality),
+		constraints:    make(map[string]map[string]*ConstraintQuality),
+		properties:     make(map[string]map[string]*PropertyQuality),
+		violationTypes: make(map[ViolationType]int),
+	}
+}
+
+func (p *QualityProfiler) ObserveInstance(schema *Schema, class string, entity *egdm.Entity) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	classQuality, ok := p.classes[class]
+	if !ok {
+		classQuality = &ClassQuality{EntityClass: class, Label: schema.displayName(class), Defined: schema.GetEntityClassById(class) != nil}
+		p.classes[class] = classQuality
+		p.constraints[class] = make(map[string]*ConstraintQuality)
+		p.properties[class] = make(map[string]*PropertyQuality)
+	}
+	classQuality.Instances++
+
+	for _, constraint := range schema.GetConstraintsForEntityClass(class, true) {
+		propertyConstraint, ok := constraint.(propertyClassConstraint)
+		if !ok {
+			continue
+		}
+		property, err := propertyConstraint.GetConstrainedPropertyClass()
+		if err != nil {
+			continue
+		}
+		_, isReference := constraint.(*ReferenceConstraint)
+
+		propertyQuality, ok := p.properties[class][property]
+		if !ok {
+			propertyQuality = &PropertyQuality{Property: property, Label: schema.displayName(property), Reference: isReference,
+				Cardinalities: make(map[int]int)}
+			p.properties[class][property] = propertyQuality
+			// instances seen before the first constraint on the property had no values counted for it
+			propertyQuality.Cardinalities[0] = classQuality.Instances - 1
+		}
+		if minCard, ok := constraint.(interface{ GetMinAllowedOccurrences() int }); ok && minCard.GetMinAllowedOccurrences() > 0 {
+			propertyQuality.Required = true
+		}
+		if propertyQuality.counted == classQuality.Instances {
+			continue
+		}
+
+		count := len(makeStringArray(entity.References[property]))
+		if !isReference {
+			count = len(toValueArray(entity.Properties[property]))
+		}
+		propertyQuality.Cardinalities[count]++
+		if count > 0 {
+			propertyQuality.Filled++
+		}
+		propertyQuality.counted = classQuality.Instances
+	}
+}
+
+func (p *QualityProfiler) ObserveCheck(schema *Schema, class string, constraint ConstraintType, entity *egdm.Entity, valid bool, violation *ConstraintViolation) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	constraints, ok := p.constraints[class]
+	if !ok {
+		constraints = make(map[string]*ConstraintQuality)
+		p.constraints[class] = constraints
+	}
+	constraintQuality, ok := constraints[constraint.GetID()]
+	if !ok {
+		constraintQuality = &ConstraintQuality{Constraint: constraint.GetID(), Type: schema.displayName(constraint.GetTypeIdentifier()),
+			Severity: constraint.GetSeverity().String()}
+		if propertyConstraint, ok := constraint.(propertyClassConstraint); ok {
+			constraintQuality.Property, _ = propertyConstraint.GetConstrainedPropertyClass()
+		}
+		constraints[constraint.GetID()] = constraintQuality
+	}
+	if valid {
+		constraintQuality.Passed++
+	} else {
+		constraintQuality.Failed++
+	}
+}
+
+func (p *QualityProfiler) ObserveEntity(schema *Schema, entity *egdm.Entity, ok bool, violations []*ConstraintViolation) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.report.Entities++
+	if ok {
+		p.report.ValidEntities++
+	}
+	for _, violation := range violations {
+		p.violationTypes[violation.ViolationType]++
+	}
+}
+
+// Report returns the statistics observed so far
+func (p *QualityProfiler) Report() *QualityReport {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	report := *p.report
+	report.Classes = make([]*ClassQuality, 0, len(p.classes))
+	for class, classQuality := range p.classes {
+		result := *classQuality
+		result.Constraints = make([]*ConstraintQuality, 0, len(p.constraints[class]))
+		for _, constraintQuality := range p.constraints[class] {
+			c := *constraintQuality
+			result.Constraints = append(result.Constraints, &c)
+		}
+		sort.Slice(result.Constraints, func(i, j int) bool {
+			return result.Constraints[i].Constraint < result.Constraints[j].Constraint
+		})
+
+		result.Properties = make([]*PropertyQuality, 0, len(p.properties[class]))
+		for _, propertyQuality := range p.properties[class] {
+			property := *propertyQuality
+			property.Cardinalities = make(map[int]int)
+			for count, instances := range propertyQuality.Cardinalities {
+				if instances > 0 {
+					property.Cardinalities[count] = instances
+				}
+			}
+			property.FillRate = float64(property.Filled) / float64(result.Instances)
+			result.Properties = append(result.Properties, &property)
+		}
+		sort.Slice(result.Properties, func(i, j int) bool {
+			return result.Properties[i].Property < result.Properties[j].Property
+		})
+		report.Classes = append(report.Classes, &result)
+	}
+	sort.Slice(report.Classes, func(i, j int) bool {
+		if report.Classes[i].Instances != report.Classes[j].Instances {
+			return report.Classes[i].Instances > report.Classes[j].Instances
+		}
+		return report.Classes[i].EntityClass < report.Classes[j].EntityClass
+	})
+
+	report.ViolationTypes = make([]*ViolationTypeCount, 0, len(p.violationTypes))
+	for violationType, count := range p.violationTypes {
+		report.ViolationTypes = append(report.ViolationTypes, &ViolationTypeCount{ViolationType: violationType.String(), Count: count})
+	}
+	sort.Slice(report.ViolationTypes, func(i, j int) bool {
+		if report.ViolationTypes[i].Count != report.ViolationTypes[j].Count {
+			return report.ViolationTypes[i].Count > report.ViolationTypes[j].Count
+		}
+		return report.ViolationTypes[i].ViolationType < report.ViolationTypes[j].ViolationType
+	})
+	return &report
+}
+
+// ProfileDataset validates the dataset and returns the quality statistics
+func (v *Validator) ProfileDataset(schema *Schema, datasetName string) (*QualityReport, error) {
+	profiler := NewQualityProfiler(datasetName)
+	profiling := *v
+	profiling.observer = profiler
+	if _, _, err := profiling.ValidateDataset(schema, datasetName); err != nil {
+		return nil, err
+	}
+	return profiler.Report(), nil
+}
+
+// ProfileEntityCollection validates the entities and returns the quality statistics
+func (v *Validator) ProfileEntityCollection(schema *Schema, entityCollection *egdm.EntityCollection) (*QualityReport, error) {
+	profiler := NewQualityProfiler("")
+	profiling := *v
+	profiling.observer = profiler
+	if _, _, err := profiling.ValidateEntityCollection(schema, entityCollection); err != nil {
+		return nil, err
+	}
+	return profiler.Report(), nil
+}
+
+// WriteJSON writes the report as indented JSON
+func (report *QualityReport) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteHTML writes the report as a self contained HTML page
+func (report *QualityReport) WriteHTML(writer io.Writer) error {
+	return qualityReportTemplate.Execute(writer, report)
+}
+
+var qualityReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(rate float64) string {
+		return template.HTMLEscapeString(formatPercent(rate))
+	},
+	"rate": func(part int, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return float64(part) / float64(total)
+	},
+	"cardinalities": func(cardinalities map[int]int) []cardinalityCount {
+		counts := make([]cardinalityCount, 0, len(cardinalities))
+		for values, instances := range cardinalities {
+			counts = append(counts, cardinalityCount{Values: values, Instances: instances})
+		}
+		sort.Slice(counts, func(i, j int) bool {
+			return counts[i].Values < counts[j].Values
+		})
+		return counts
+	},
+}).Parse(qualityReportHTML))
+
+type cardinalityCount struct {
+	Values    int
+	Instances int
+}
+
+func formatPercent(rate float64) string {
+	return formatMessageValue(float64(int(rate*1000+0.5))/10) + "%"
+}
+
+const qualityReportHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Data quality{{if .Dataset}} of {{.Dataset}}{{end}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+th { background: #f0f0f0; }
+.failed { color: #b00; }
+.bar { background: #4a8; height: 0.8em; display: inline-block; }
+</style>
+</head>
+<body>
+<h1>Data quality{{if .Dataset}} of {{.Dataset}}{{end}}</h1>
+<p>{{.ValidEntities}} of {{.Entities}} entities are valid ({{percent (rate .ValidEntities .Entities)}}).</p>
+{{if .ViolationTypes}}
+<h2>Most frequent violations</h2>
+<table>
+<tr><th>Violation</th><th>Count</th></tr>
+{{range .ViolationTypes}}<tr><td>{{.ViolationType}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Classes</h2>
+<table>
+<tr><th>Class</th><th>Instances</th></tr>
+{{range .Classes}}<tr><td><a href="#{{.EntityClass}}">{{.Label}}</a>{{if not .Defined}} (not in schema){{end}}</td><td>{{.Instances}}</td></tr>
+{{end}}</table>
+{{range .Classes}}
+<h2 id="{{.EntityClass}}">{{.Label}}</h2>
+<p>{{.Instances}} instances of <code>{{.EntityClass}}</code></p>
+{{if .Properties}}
+<h3>Properties</h3>
+<table>
+<tr><th>Property</th><th>Required</th><th>Fill rate</th><th>Values per instance</th></tr>
+{{range .Properties}}<tr><td>{{.Label}}</td><td>{{if .Required}}yes{{else}}no{{end}}</td>
+<td><span class="bar" style="width: {{percent .FillRate}}"></span> {{percent .FillRate}}</td>
+<td>{{range cardinalities .Cardinalities}}{{.Values}}: {{.Instances}} {{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Constraints}}
+<h3>Constraints</h3>
+<table>
+<tr><th>Constraint</th><th>Type</th><th>Severity</th><th>Passed</th><th>Failed</th></tr>
+{{range .Constraints}}<tr><td>{{.Constraint}}</td><td>{{.Type}}</td><td>{{.Severity}}</td><td>{{.Passed}}</td><td{{if .Failed}} class="failed"{{end}}>{{.Failed}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,117 @@
+package egcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const qualitySchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  propertyConstraints:
+    - id: model:nameRequired
+      propertyClass: model:name
+      minCard: 1
+      maxCard: 1
+    - id: model:nicknames
+      propertyClass: model:nickname
+`
+
+func TestQualityReport(t *testing.T) {
+	schema, err := parseYaml([]byte(qualitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := func(id string, props map[string]any) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + id)
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+		for k, v := range props {
+			e.SetProperty("http://data.mimiro.io/amodel/"+k, v)
+		}
+		return e
+	}
+	ec := egdm.NewEntityCollection(nil)
+	for _, e := range []*egdm.Entity{
+		person("alice", map[string]any{"name": "alice", "nickname": []any{"al", "ali"}}),
+		person("bob", map[string]any{"name": "bob", "nickname": "b"}),
+		person("carol", nil),
+		person("dave", map[string]any{"name": []any{"dave", "david"}}),
+	} {
+		_ = ec.AddEntity(e)
+	}
+
+	report, err := NewValidator().ProfileEntityCollection(schema, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entities != 4 || report.ValidEntities != 2 {
+		t.Fatalf("expected 2 of 4 valid entities, got %d of %d", report.ValidEntities, report.Entities)
+	}
+	if len(report.Classes) != 1 || report.Classes[0].Instances != 4 {
+		t.Fatalf("expected one class with 4 instances, got %+v", report.Classes)
+	}
+
+	class := report.Classes[0]
+	if len(class.Constraints) != 2 {
+		t.Fatalf("expected 2 constraints, got %d", len(class.Constraints))
+	}
+	for _, c := range class.Constraints {
+		if c.Constraint == "http://data.mimiro.io/amodel/nameRequired" && (c.Passed != 2 || c.Failed != 2) {
+			t.Errorf("expected name to pass 2 and fail 2, got %d and %d", c.Passed, c.Failed)
+		}
+		if c.Constraint == "http://data.mimiro.io/amodel/nicknames" && (c.Passed != 4 || c.Failed != 0) {
+			t.Errorf("expected nicknames to pass 4, got %d and %d", c.Passed, c.Failed)
+		}
+	}
+
+	properties := make(map[string]*PropertyQuality)
+	for _, p := range class.Properties {
+		properties[p.Label] = p
+	}
+	name, nickname := properties["model:name"], properties["model:nickname"]
+	if name == nil || nickname == nil {
+		t.Fatalf("expected name and nickname properties, got %+v", class.Properties)
+	}
+	if !name.Required || name.FillRate != 0.75 || name.Cardinalities[0] != 1 || name.Cardinalities[1] != 2 || name.Cardinalities[2] != 1 {
+		t.Errorf("unexpected name statistics %+v", name)
+	}
+	if nickname.Required || nickname.FillRate != 0.5 || nickname.Cardinalities[0] != 2 || nickname.Cardinalities[2] != 1 {
+		t.Errorf("unexpected nickname statistics %+v", nickname)
+	}
+
+	if len(report.ViolationTypes) != 2 || report.ViolationTypes[0].Count != 1 {
+		t.Errorf("unexpected violation types %+v", report.ViolationTypes)
+	}
+
+	var buffer bytes.Buffer
+	if err := report.WriteJSON(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	var decoded QualityReport
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Entities != 4 || len(decoded.Classes) != 1 {
+		t.Errorf("unexpected decoded report %+v", decoded)
+	}
+
+	buffer.Reset()
+	if err := report.WriteHTML(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"2 of 4 entities are valid (50%)", "MinPropertyOccurrenceNotMet", "75%"} {
+		if !strings.Contains(buffer.String(), expected) {
+			t.Errorf("expected HTML report to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package egcl
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const (
+	DefaultResolverBatchSize = 100
+	DefaultResolverCacheSize = 10000
+)
+
+// BatchDataProvider is implemented by data providers that can look up several entities in one request.
+// Entities that do not exist are left out of the returned map. When only some of the ids fail, the
+// entities found are returned together with a LookupErrors.
+type BatchDataProvider interface {
+	GetEntities(entityIds []string, datasets []string) (map[string]*egdm.Entity, error)
+}
+
+// LookupErrors holds the ids that could not be looked up, with the error of each
+type LookupErrors map[string]error
+
+func (e LookupErrors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if len(ids) == 1 {
+		return fmt.Sprintf("lookup of %s failed: %v", ids[0], e[ids[0]])
+	}
+	return fmt.Sprintf("lookup of %d entities failed, first %s: %v", len(ids), ids[0], e[ids[0]])
+}
+
+// ReferenceResolver sits between a Validator and a DataProvider and resolves referenced entities.
+// Lookups are batched when the underlying provider implements BatchDataProvider, found and not found
+// results are kept in a size bounded cache, and concurrent lookups of the same entity share one request.
+type ReferenceResolver struct {
+	provider  DataProvider
+	batchSize int
+	cacheSize int
+
+	lock     sync.Mutex
+	entries  map[resolverKey]*list.Element
+	recent   *list.List
+	inFlight map[resolverKey]*pendingLookup
+}
+
+// resolverKey identifies a lookup of an entity in a set of datasets
+type resolverKey struct {
+	datasets string
+	id       string
+}
+
+type cachedEntity struct {
+	key    resolverKey
+	entity *egdm.Entity
+}
+
+type pendingLookup struct {
+	done   chan struct{}
+	entity *egdm.Entity
+	err    error
+}
+
+func NewReferenceResolver(provider DataProvider) *ReferenceResolver {
+	return &ReferenceResolver{
+		provider:  provider,
+		batchSize: DefaultResolverBatchSize,
+		cacheSize: DefaultResolverCacheSize,
+		entries:   make(map[resolverKey]*list.Element),
+		recent:    list.New(),
+		inFlight:  make(map[resolverKey]*pendingLookup),
+	}
+}
+
+// WithBatchSize sets the maximum number of ids sent to the provider in one lookup
+func (r *ReferenceResolver) WithBatchSize(batchSize int) *ReferenceResolver {
+	if batchSize > 0 {
+		r.batchSize = batchSize
+	}
+	return r
+}
+
+// WithCacheSize sets the maximum number of resolved entities kept in the cache
+func (r *ReferenceResolver) WithCacheSize(cacheSize int) *ReferenceResolver {
+	if cacheSize > 0 {
+		r.cacheSize = cacheSize
+	}
+	return r
+}
+
+func (r *ReferenceResolver) BatchSize() int {
+	return r.batchSize
+}
+
+func (r *ReferenceResolver) Hop(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (datahub.EntityIterator, error) {
+	return r.provider.Hop(sourceEntityId, reference, datasets, inverse, limit)
+}
+
+func (r *ReferenceResolver) GetDatasetEntities(dataset string) (datahub.EntityIterator, error) {
+	return r.provider.GetDatasetEntities(dataset)
+}
+
+// GetEntity returns the entity with the given id, or nil if it does not exist. Results are served from the cache when possible.
+func (r *ReferenceResolver) GetEntity(entityId string, datasets []string) (*egdm.Entity, error) {
+	key := resolverCacheKey(entityId, datasets)
+
+	r.lock.Lock()
+	if entity, found := r.cached(key); found {
+		r.lock.Unlock()
+		return entity, nil
+	}
+	if pending, found := r.inFlight[key]; found {
+		r.lock.Unlock()
+		<-pending.done
+		return pending.entity, pending.err
+	}
+	pending := &pendingLookup{done: make(chan struct{})}
+	r.inFlight[key] = pending
+	r.lock.Unlock()
+
+	found, failed := r.fetch([]string{entityId}, datasets)
+	r.complete(map[string]*pendingLookup{entityId: pending}, datasets, found, failed)
+	return pending.entity, pending.err
+}
+
+// Prefetch resolves the given ids in batches and stores the results in the cache.
+// Ids that are already cached or being looked up are skipped. Ids that fail are not cached, so a later
+// GetEntity looks them up again and reports the error.
+func (r *ReferenceResolver) Prefetch(entityIds []string, datasets []string) {
+	r.lock.Lock()
+	pending := make(map[string]*pendingLookup)
+	ids := make([]string, 0, len(entityIds))
+	for _, id := range entityIds {
+		key := resolverCacheKey(id, datasets)
+		if _, found := pending[id]; found {
+			continue
+		}
+		if _, found := r.cached(key); found {
+			continue
+		}
+		if _, found := r.inFlight[key]; found {
+			continue
+		}
+		p := &pendingLookup{done: make(chan struct{})}
+		r.inFlight[key] = p
+		pending[id] = p
+		ids = append(ids, id)
+	}
+	r.lock.Unlock()
+
+	for start := 0; start < len(ids); start += r.batchSize {
+		end := start + r.batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := make(map[string]*pendingLookup, end-start)
+		for _, id := range ids[start:end] {
+			batch[id] = pending[id]
+		}
+
+		found, failed := r.fetch(ids[start:end], datasets)
+		r.complete(batch, datasets, found, failed)
+	}
+}
+
+// fetch looks up the ids with the underlying provider, using a batch lookup when it is supported. The ids that
+// could not be looked up are returned with their error, a failing id does not fail the others.
+func (r *ReferenceResolver) fetch(entityIds []string, datasets []string) (map[string]*egdm.Entity, LookupErrors) {
+	failed := make(LookupErrors)
+	if batchProvider, ok := r.provider.(BatchDataProvider); ok {
+		found, err := batchProvider.GetEntities(entityIds, datasets)
+		if err == nil {
+			return found, failed
+		}
+		if lookupErrors, ok := err.(LookupErrors); ok {
+			return found, lookupErrors
+		}
+		for _, id := range entityIds {
+			failed[id] = err
+		}
+		return nil, failed
+	}
+
+	found := make(map[string]*egdm.Entity)
+	for _, id := range entityIds {
+		entity, err := r.provider.GetEntity(id, datasets)
+		if err != nil {
+			failed[id] = err
+			continue
+		}
+		if entity != nil {
+			found[id] = entity
+		}
+	}
+	return found, failed
+}
+
+// complete records the outcome of a lookup and releases anyone waiting on it. Errors are not cached.
+func (r *ReferenceResolver) complete(lookups map[string]*pendingLookup, datasets []string, found map[string]*egdm.Entity, failed LookupErrors) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for id, pending := range lookups {
+		key := resolverCacheKey(id, datasets)
+		delete(r.inFlight, key)
+		if err, ok := failed[id]; ok {
+			pending.err = err
+		} else {
+			pending.entity = found[id]
+			r.store(key, pending.entity)
+		}
+		close(pending.done)
+	}
+}
+
+// cached must be called with the lock held
+func (r *ReferenceResolver) cached(key resolverKey) (*egdm.Entity, bool) {
+	element, found := r.entries[key]
+	if !found {
+		return nil, false
+	}
+	r.recent.MoveToFront(element)
+	return element.Value.(*cachedEntity).entity, true
+}
+
+// store must be called with the lock held
+func (r *ReferenceResolver) store(key resolverKey, entity *egdm.Entity) {
+	if element, found := r.entries[key]; found {
+		element.Value.(*cachedEntity).entity = entity
+		r.recent.MoveToFront(element)
+		return
+	}
+
+	r.entries[key] = r.recent.PushFront(&cachedEntity{key: key, entity: entity})
+	for r.recent.Len() > r.cacheSize {
+		oldest := r.recent.Back()
+		r.recent.Remove(oldest)
+		delete(r.entries, oldest.Value.(*cachedEntity).key)
+	}
+}
+
+func resolverCacheKey(entityId string, datasets []string) resolverKey {
+	// quoted so that dataset names with separators in them cannot collide
+	return resolverKey{datasets: fmt.Sprintf("%q", datasets), id: entityId}
+}
+
+// Invalidate drops the cached lookups of the entities, so that changed entities are fetched again
+func (r *ReferenceResolver) Invalidate(entityIds []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	ids := toSet(entityIds)
+	for key, element := range r.entries {
+		if ids[key.id] {
+			r.recent.Remove(element)
+			delete(r.entries, key)
+		}
+	}
+}
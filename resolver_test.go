@@ -0,0 +1,309 @@
+package egcl
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+// countingDataProvider is an in memory DataProvider that records how often it is asked for entities
+type countingDataProvider struct {
+	lock          sync.Mutex
+	entities      map[string]*egdm.Entity
+	getCalls      int
+	batchCalls    int
+	requestedIds  []string
+	supportsBatch bool
+}
+
+func newCountingDataProvider(entities ...*egdm.Entity) *countingDataProvider {
+	p := &countingDataProvider{entities: make(map[string]*egdm.Entity)}
+	for _, e := range entities {
+		p.entities[e.ID] = e
+	}
+	return p
+}
+
+func (p *countingDataProvider) Hop(sourceEntityId string, reference string, datasets []string, inverse bool, limit int) (datahub.EntityIterator, error) {
+	return nil, nil
+}
+
+func (p *countingDataProvider) GetEntity(entityId string, datasets []string) (*egdm.Entity, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.getCalls++
+	p.requestedIds = append(p.requestedIds, entityId)
+	return p.entities[entityId], nil
+}
+
+func (p *countingDataProvider) GetDatasetEntities(dataset string) (datahub.EntityIterator, error) {
+	return nil, nil
+}
+
+// batchingDataProvider adds multi id lookups to the counting provider
+type batchingDataProvider struct {
+	*countingDataProvider
+}
+
+func (p *batchingDataProvider) GetEntities(entityIds []string, datasets []string) (map[string]*egdm.Entity, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.batchCalls++
+	p.requestedIds = append(p.requestedIds, entityIds...)
+	result := make(map[string]*egdm.Entity)
+	for _, id := range entityIds {
+		if e, ok := p.entities[id]; ok {
+			result[id] = e
+		}
+	}
+	return result, nil
+}
+
+func TestReferenceResolverCachesFoundAndMissingEntities(t *testing.T) {
+	provider := newCountingDataProvider(egdm.NewEntity().SetID("http://data.mimiro.io/things/1"))
+	resolver := NewReferenceResolver(provider)
+
+	for i := 0; i < 3; i++ {
+		entity, err := resolver.GetEntity("http://data.mimiro.io/things/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entity == nil {
+			t.Fatal("expected entity to be found")
+		}
+
+		missing, err := resolver.GetEntity("http://data.mimiro.io/things/missing", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if missing != nil {
+			t.Fatal("expected missing entity to be nil")
+		}
+	}
+
+	if provider.getCalls != 2 {
+		t.Errorf("expected 2 provider lookups, got %d", provider.getCalls)
+	}
+}
+
+func TestReferenceResolverEvictsLeastRecentlyUsed(t *testing.T) {
+	provider := newCountingDataProvider()
+	resolver := NewReferenceResolver(provider).WithCacheSize(2)
+
+	for _, id := range []string{"a", "b", "a", "c", "a", "b"} {
+		if _, err := resolver.GetEntity(id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a stays cached as it is used most, b is evicted by c and has to be looked up again
+	if provider.getCalls != 4 {
+		t.Errorf("expected 4 provider lookups, got %d", provider.getCalls)
+	}
+	if len(resolver.entries) != 2 {
+		t.Errorf("expected cache to hold 2 entries, got %d", len(resolver.entries))
+	}
+}
+
+func TestReferenceResolverInvalidatesExactIds(t *testing.T) {
+	provider := newCountingDataProvider()
+	resolver := NewReferenceResolver(provider)
+
+	lookup := func(id string, datasets ...string) {
+		if _, err := resolver.GetEntity(id, datasets); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// one dataset named x,y is not the same as the datasets x and y
+	lookup("b", "x,y")
+	lookup("b", "x", "y")
+	lookup("a|b", "x")
+	if provider.getCalls != 3 {
+		t.Fatalf("expected 3 provider lookups, got %d", provider.getCalls)
+	}
+
+	resolver.Invalidate([]string{"b"})
+	lookup("a|b", "x")
+	if provider.getCalls != 3 {
+		t.Errorf("expected a|b to stay cached when b is invalidated, got %d lookups", provider.getCalls)
+	}
+	lookup("b", "x,y")
+	lookup("b", "x", "y")
+	if provider.getCalls != 5 {
+		t.Errorf("expected b to be looked up again in both dataset sets, got %d lookups", provider.getCalls)
+	}
+}
+
+func TestReferenceResolverPrefetchBatches(t *testing.T) {
+	provider := &batchingDataProvider{newCountingDataProvider()}
+	resolver := NewReferenceResolver(provider).WithBatchSize(2)
+
+	resolver.Prefetch([]string{"a", "b", "a", "c", "d", "e"}, nil)
+
+	if provider.batchCalls != 3 {
+		t.Errorf("expected 3 batch lookups, got %d", provider.batchCalls)
+	}
+	if len(provider.requestedIds) != 5 {
+		t.Errorf("expected 5 distinct ids requested, got %d", len(provider.requestedIds))
+	}
+
+	// everything is now cached, including the ids that were not found
+	if _, err := resolver.GetEntity("e", nil); err != nil {
+		t.Fatal(err)
+	}
+	resolver.Prefetch([]string{"a", "b"}, nil)
+	if provider.batchCalls != 3 || provider.getCalls != 0 {
+		t.Errorf("expected no further lookups, got %d batch and %d single", provider.batchCalls, provider.getCalls)
+	}
+}
+
+func TestReferenceResolverSharesInFlightLookups(t *testing.T) {
+	provider := newCountingDataProvider(egdm.NewEntity().SetID("a"))
+	resolver := NewReferenceResolver(provider)
+
+	// hold the provider lock so that all lookups pile up behind the first one
+	provider.lock.Lock()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entity, err := resolver.GetEntity("a", nil)
+			if err != nil || entity == nil {
+				t.Error("expected entity to be resolved")
+			}
+		}()
+	}
+	for {
+		resolver.lock.Lock()
+		started := len(resolver.inFlight) == 1
+		resolver.lock.Unlock()
+		if started {
+			break
+		}
+	}
+	provider.lock.Unlock()
+	wg.Wait()
+
+	if provider.getCalls != 1 {
+		t.Errorf("expected 1 provider lookup, got %d", provider.getCalls)
+	}
+}
+
+func TestValidateRelatedLooksUpEachReferenceOnce(t *testing.T) {
+	schemaFile, err := os.ReadFile("test_data/egcl-sample.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := parseYaml(schemaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ec := egdm.NewEntityCollection(nil)
+	for i := 0; i < 250; i++ {
+		entity := egdm.NewEntity().SetID("http://data.mimiro.io/things/" + string(rune('a'+i%26)) + string(rune('a'+i/26)))
+		entity.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Entity")
+		entity.SetReference("http://data.mimiro.io/amodel/partOf", []string{"http://data.mimiro.io/things/missing-collection"})
+		entity.SetProperty("http://data.mimiro.io/amodel/name", "thing")
+		_ = ec.AddEntity(entity)
+	}
+
+	provider := &batchingDataProvider{newCountingDataProvider()}
+	v := NewValidator().WithSettings(&ValidatorSettings{ValidateRelated: true}).WithDataProvider(provider)
+
+	ok, violations, err := v.ValidateEntityCollection(schema, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("expected validation to fail")
+	}
+	if len(violations) != 250 {
+		t.Errorf("expected 250 violations, got %d", len(violations))
+	}
+	for _, violation := range violations {
+		if violation.ViolationType != ReferenceNotFound {
+			t.Errorf("expected reference not found, got %v", violation.ViolationType)
+		}
+	}
+	if provider.batchCalls != 1 || provider.getCalls != 0 {
+		t.Errorf("expected a single batch lookup, got %d batch and %d single", provider.batchCalls, provider.getCalls)
+	}
+}
+
+// failingDataProvider fails the lookups of some ids
+type failingDataProvider struct {
+	*countingDataProvider
+	failing map[string]bool
+}
+
+func (p *failingDataProvider) GetEntity(entityId string, datasets []string) (*egdm.Entity, error) {
+	if p.failing[entityId] {
+		return nil, errors.New("lookup failed")
+	}
+	return p.countingDataProvider.GetEntity(entityId, datasets)
+}
+
+func TestReferenceResolverPrefetchRecordsFailuresPerId(t *testing.T) {
+	provider := &failingDataProvider{newCountingDataProvider(egdm.NewEntity().SetID("a"), egdm.NewEntity().SetID("c")), map[string]bool{"b": true}}
+	resolver := NewReferenceResolver(provider)
+
+	resolver.Prefetch([]string{"a", "b", "c"}, nil)
+
+	for _, id := range []string{"a", "c"} {
+		entity, err := resolver.GetEntity(id, nil)
+		if err != nil || entity == nil {
+			t.Errorf("expected %s to be resolved, got %v", id, err)
+		}
+	}
+	if provider.getCalls != 2 {
+		t.Errorf("expected the found ids to be served from the cache, got %d lookups", provider.getCalls)
+	}
+
+	// the failure is not cached, so the id is looked up again and reports the error
+	if _, err := resolver.GetEntity("b", nil); err == nil {
+		t.Error("expected the lookup of b to fail")
+	}
+	delete(provider.failing, "b")
+	if _, err := resolver.GetEntity("b", nil); err != nil {
+		t.Errorf("expected the lookup of b to be retried, got %v", err)
+	}
+}
+
+func TestReferenceResolverKeepsEntitiesFoundWithLookupErrors(t *testing.T) {
+	provider := &partialBatchDataProvider{newCountingDataProvider(egdm.NewEntity().SetID("a"))}
+	resolver := NewReferenceResolver(provider)
+
+	resolver.Prefetch([]string{"a", "b"}, nil)
+
+	if entity, err := resolver.GetEntity("a", nil); err != nil || entity == nil {
+		t.Errorf("expected a to be resolved from the batch, got %v", err)
+	}
+	if _, err := resolver.GetEntity("b", nil); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expected the lookup of b to report its own error, got %v", err)
+	}
+}
+
+// partialBatchDataProvider fails every id it does not hold in batch lookups
+type partialBatchDataProvider struct {
+	*countingDataProvider
+}
+
+func (p *partialBatchDataProvider) GetEntities(entityIds []string, datasets []string) (map[string]*egdm.Entity, error) {
+	found := make(map[string]*egdm.Entity)
+	failed := make(LookupErrors)
+	for _, id := range entityIds {
+		if e, ok := p.entities[id]; ok {
+			found[id] = e
+		} else {
+			failed[id] = errors.New("timeout")
+		}
+	}
+	return found, failed
+}
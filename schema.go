@@ -1,6 +1,9 @@
 package egcl
 
 import (
+	"regexp"
+	"sync"
+
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 	"github.com/pkg/errors"
 )
@@ -42,31 +45,177 @@ const (
 	EGCLinverseMaxCardinality = EGCLUriExpansion + "inverseMaxCard"
 )
 
+const (
+	EGCLpattern      = EGCLUriExpansion + "pattern"
+	EGCLminInclusive = EGCLUriExpansion + "minInclusive"
+	EGCLmaxInclusive = EGCLUriExpansion + "maxInclusive"
+	EGCLminExclusive = EGCLUriExpansion + "minExclusive"
+	EGCLmaxExclusive = EGCLUriExpansion + "maxExclusive"
+	EGCLminLength    = EGCLUriExpansion + "minLength"
+	EGCLmaxLength    = EGCLUriExpansion + "maxLength"
+	EGCLin           = EGCLUriExpansion + "in"
+)
+
+const (
+	EGCLconceptScheme        = EGCLUriExpansion + "conceptScheme"
+	EGCLconceptSchemeDataset = EGCLUriExpansion + "conceptSchemeDataset"
+)
+
+const SKOSUriExpansion = "http://www.w3.org/2004/02/skos/core#"
+const SKOSinScheme = SKOSUriExpansion + "inScheme"
+const SKOStopConceptOf = SKOSUriExpansion + "topConceptOf"
+
 var (
-	ErrMissingParent = errors.New("referenced super class is not defined in the schema")
+	ErrMissingParent   = errors.New("referenced super class is not defined in the schema")
+	ErrCyclicHierarchy = errors.New("entity class is its own super class")
 )
 
 func NewSchema(entities *egdm.EntityCollection) *Schema {
+	return NewSchemaWithRegistry(entities, DefaultConstraintRegistry)
+}
+
+// NewSchemaWithRegistry creates a schema where constraint entities are turned into constraints by the factories in the registry.
+// Errors found while loading, like a subClassOf cycle or an unknown comparison operator, are not returned here but
+// are by NewSchemaFromYaml and LoadSchema.
+func NewSchemaWithRegistry(entities *egdm.EntityCollection, registry *ConstraintRegistry) *Schema {
+	schema, _ := newCheckedSchema(entities, registry)
+	return schema
+}
+
+// newCheckedSchema creates a schema and returns the errors found when compiling it, like a subClassOf cycle
+func newCheckedSchema(entities *egdm.EntityCollection, registry *ConstraintRegistry) (*Schema, error) {
 	schema := &Schema{
 		EntityCollection: entities,
 		EntityClasses:    make([]*EntityClass, 0),
-		Constraints:      make([]any, 0),
+		Constraints:      make([]ConstraintType, 0),
 	}
-	schema.initialize()
-	return schema
+	err := schema.initialize(registry)
+	return schema, err
 }
 
+// NewSchemaFromYaml parses a schema written in the YAML shorthand syntax
 func NewSchemaFromYaml(yaml string) (*Schema, error) {
-
-	return NewSchema(nil), nil
+	return parseYaml([]byte(yaml))
 }
 
 type Schema struct {
 	EntityCollection *egdm.EntityCollection
 	EntityClasses    []*EntityClass
-	Constraints      []any
+	Constraints      []ConstraintType
 	BaseURI          string
 	Description      string
+	// Version, Title, Owners and the deprecation fields are read from the egcl:Schema entity
+	Version         string
+	Title           string
+	Owners          []string
+	Deprecated      bool
+	DeprecationDate string
+	RemovalDate     string
+	classIndex      map[string]*EntityClass
+	index           *constraintIndex
+	// profile selects the active constraints, see WithProfile. activeProfile is the profile with expanded ids.
+	profile       *ValidationProfile
+	activeProfile *ValidationProfile
+}
+
+// constraintIndex holds the constraints compiled into maps so that lookups do not depend on the size of the schema
+type constraintIndex struct {
+	constraints          map[string]ConstraintType
+	ownConstraints       map[string][]ConstraintType
+	inheritedConstraints map[string][]ConstraintType
+	outgoingInverse      map[string][]ConstraintType
+	inheritedInverse     map[string][]ConstraintType
+	propertyConstraints  map[string][]ConstraintType
+	// hasDeactivated is false when no constraint is deactivated, so lookups without a profile need not filter
+	hasDeactivated bool
+}
+
+// Compile builds the lookup indexes used by GetEntityClassById and the constraint lookups. It is called by NewSchema
+// and needs to be called again if EntityClasses or Constraints are modified afterwards. A class that is its own
+// super class returns ErrCyclicHierarchy, the indexes are still built but the class inherits no constraints.
+func (aSchema *Schema) Compile() error {
+	aSchema.index = nil
+	aSchema.classIndex = make(map[string]*EntityClass)
+
+	// add classes in reverse so that the first class with a given id wins, as with a scan
+	for i := len(aSchema.EntityClasses) - 1; i >= 0; i-- {
+		ec := aSchema.EntityClasses[i]
+		aSchema.classIndex[ec.Entity.ID] = ec
+		if aSchema.EntityCollection != nil {
+			if uri, err := aSchema.EntityCollection.NamespaceManager.GetFullURI(ec.Entity.ID); err == nil {
+				aSchema.classIndex[uri] = ec
+			}
+		}
+	}
+
+	index := &constraintIndex{
+		constraints:          make(map[string]ConstraintType),
+		ownConstraints:       make(map[string][]ConstraintType),
+		inheritedConstraints: make(map[string][]ConstraintType),
+		outgoingInverse:      make(map[string][]ConstraintType),
+		inheritedInverse:     make(map[string][]ConstraintType),
+		propertyConstraints:  make(map[string][]ConstraintType),
+	}
+
+	for _, constraint := range aSchema.Constraints {
+		if _, exists := index.constraints[constraint.GetID()]; !exists {
+			index.constraints[constraint.GetID()] = constraint
+		}
+		if constraint.IsDeactivated() {
+			index.hasDeactivated = true
+		}
+		if entityClass := constraint.GetAppliesToEntityClass(); entityClass != "" {
+			index.ownConstraints[entityClass] = append(index.ownConstraints[entityClass], constraint)
+		}
+		if propertyConstraint, ok := constraint.(propertyClassConstraint); ok {
+			if property, err := propertyConstraint.GetConstrainedPropertyClass(); err == nil {
+				index.propertyConstraints[property] = append(index.propertyConstraints[property], constraint)
+			}
+		}
+		if referenceConstraint, ok := constraint.(*ReferenceConstraint); ok {
+			if referencedClass, err := referenceConstraint.GetAllowedReferencedClass(); err == nil {
+				if _, err := referenceConstraint.GetInverseConstrainedPropertyClass(); err == nil {
+					index.outgoingInverse[referencedClass] = append(index.outgoingInverse[referencedClass], constraint)
+				}
+			}
+		}
+	}
+
+	// add the constraints of superclasses, leaving out constraints that only apply to the class itself
+	for classId, own := range index.ownConstraints {
+		index.inheritedConstraints[classId] = own
+	}
+	for classId, own := range index.outgoingInverse {
+		index.inheritedInverse[classId] = own
+	}
+	var cycleClass string
+	var cycleErr error
+	for classId := range aSchema.classIndex {
+		superclasses, err := aSchema.GetEntityClassClassHierarchy(classId)
+		if errors.Is(err, ErrCyclicHierarchy) && (cycleErr == nil || classId < cycleClass) {
+			cycleClass, cycleErr = classId, err
+		}
+		for _, superClass := range superclasses {
+			for _, constraint := range index.ownConstraints[superClass] {
+				if !constraint.IsInherited() {
+					continue
+				}
+				index.inheritedConstraints[classId] = append(indexedConstraints(index.inheritedConstraints[classId]), constraint)
+			}
+			index.inheritedInverse[classId] = append(indexedConstraints(index.inheritedInverse[classId]), index.outgoingInverse[superClass]...)
+		}
+	}
+
+	aSchema.index = index
+	return cycleErr
+}
+
+// indexedConstraints returns a slice that callers can append to without modifying the index
+func indexedConstraints(constraints []ConstraintType) []ConstraintType {
+	if constraints == nil {
+		return make([]ConstraintType, 0)
+	}
+	return constraints[:len(constraints):len(constraints)]
 }
 
 func (aSchema *Schema) IsOfType(entity *egdm.Entity, typeURI string) bool {
@@ -92,6 +241,13 @@ func (aSchema *Schema) IsOfType(entity *egdm.Entity, typeURI string) bool {
 }
 
 func (aSchema *Schema) GetEntityClassById(entityClassIdentifier string) *EntityClass {
+	if aSchema.classIndex != nil {
+		return aSchema.classIndex[entityClassIdentifier]
+	}
+	return aSchema.scanEntityClassById(entityClassIdentifier)
+}
+
+func (aSchema *Schema) scanEntityClassById(entityClassIdentifier string) *EntityClass {
 	for _, ec := range aSchema.EntityClasses {
 		if ec.Entity.ID == entityClassIdentifier {
 			return ec
@@ -113,8 +269,14 @@ func (aSchema *Schema) GetEntityClassClassHierarchy(entityClassIdentifier string
 		return nil, errors.Wrap(ErrMissingParent, entityClassIdentifier)
 	}
 	parentClass, _ := entityClass.Entity.GetFirstReferenceValue(EGCLsubclassOf)
+	visited := map[string]bool{entityClass.Entity.ID: true, entityClassIdentifier: true}
 	var err2 error
 	for parentClass != "" {
+		if visited[parentClass] {
+			err2 = errors.Wrapf(ErrCyclicHierarchy, "%s through %s", entityClassIdentifier, parentClass)
+			break
+		}
+		visited[parentClass] = true
 		ancestors = append(ancestors, parentClass)
 		parentEntityClass := aSchema.GetEntityClassById(parentClass)
 		if parentEntityClass == nil {
@@ -129,9 +291,59 @@ func (aSchema *Schema) GetEntityClassClassHierarchy(entityClassIdentifier string
 	return ancestors, nil
 }
 
+// IsSubClassOf returns true if the entity class is the super class or inherits from it through any of its superclasses
+func (aSchema *Schema) IsSubClassOf(entityClassIdentifier string, superClassIdentifier string) bool {
+	visited := make(map[string]bool)
+	pending := []string{entityClassIdentifier}
+	for len(pending) > 0 {
+		current := pending[0]
+		pending = pending[1:]
+		if current == superClassIdentifier {
+			return true
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		entityClass := aSchema.GetEntityClassById(current)
+		if entityClass == nil {
+			continue
+		}
+		if parents, err := entityClass.Entity.GetReferenceValues(EGCLsubclassOf); err == nil {
+			pending = append(pending, parents...)
+		}
+	}
+	return false
+}
+
+// IsInstanceOfClass returns true if any of the given types is the entity class or one of its subclasses
+func (aSchema *Schema) IsInstanceOfClass(types []string, entityClassIdentifier string) bool {
+	for _, t := range types {
+		if aSchema.IsSubClassOf(t, entityClassIdentifier) {
+			return true
+		}
+	}
+	return false
+}
+
 // Get any reference constraints that are inverse and thus outgoing for the specific entityClassIdentifer
-func (aSchema *Schema) GetOutgoingInverseConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []any {
-	constraints := make([]any, 0)
+func (aSchema *Schema) GetOutgoingInverseConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	return aSchema.activeConstraints(aSchema.outgoingInverseConstraintsForEntityClass(entityClassIdentifier, inherited))
+}
+
+func (aSchema *Schema) outgoingInverseConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	if aSchema.index != nil {
+		if inherited {
+			return indexedConstraints(aSchema.index.inheritedInverse[entityClassIdentifier])
+		}
+		return indexedConstraints(aSchema.index.outgoingInverse[entityClassIdentifier])
+	}
+	return aSchema.scanOutgoingInverseConstraintsForEntityClass(entityClassIdentifier, inherited)
+}
+
+func (aSchema *Schema) scanOutgoingInverseConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	constraints := make([]ConstraintType, 0)
 	for _, candidate := range aSchema.Constraints {
 		switch constraint := candidate.(type) {
 		case *ReferenceConstraint:
@@ -151,7 +363,7 @@ func (aSchema *Schema) GetOutgoingInverseConstraintsForEntityClass(entityClassId
 	if inherited {
 		superclasses, _ := aSchema.GetEntityClassClassHierarchy(entityClassIdentifier)
 		for _, superClass := range superclasses {
-			superConstraints := aSchema.GetOutgoingInverseConstraintsForEntityClass(superClass, false)
+			superConstraints := aSchema.scanOutgoingInverseConstraintsForEntityClass(superClass, false)
 			constraints = append(constraints, superConstraints...)
 		}
 	}
@@ -159,52 +371,70 @@ func (aSchema *Schema) GetOutgoingInverseConstraintsForEntityClass(entityClassId
 	return constraints
 }
 
-func (aSchema *Schema) GetConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []any {
-	constraints := make([]any, 0)
-	for _, candidate := range aSchema.Constraints {
-		switch constraint := candidate.(type) {
-		case *ReferenceConstraint:
-			appliesToEntityClass, err := constraint.Entity.GetFirstReferenceValue(EGCLentityClass)
-			if err == nil {
-				if appliesToEntityClass == entityClassIdentifier {
-					constraints = append(constraints, constraint)
-				}
-			}
-		case *PropertyConstraint:
-			appliesToEntityClass, err := constraint.Entity.GetFirstReferenceValue(EGCLentityClass)
-			if err == nil {
-				if appliesToEntityClass == entityClassIdentifier {
-					constraints = append(constraints, constraint)
-				}
-			}
-		case *IsAbstractConstraint:
-			appliesToEntityClass, err := constraint.Entity.GetFirstReferenceValue(EGCLentityClass)
-			if err == nil && appliesToEntityClass != "" {
-				if appliesToEntityClass == entityClassIdentifier {
-					constraints = append(constraints, constraint)
-				}
-			}
-		case *ApplicationConstraint:
-			appliesToEntityClass, err := constraint.Entity.GetFirstReferenceValue(EGCLentityClass)
-			if err == nil && appliesToEntityClass != "" {
-				if appliesToEntityClass == entityClassIdentifier {
-					constraints = append(constraints, constraint)
-				}
+// GetConstraintsForEntityClass returns the constraints on the entity class that are active in the profile of the schema
+func (aSchema *Schema) GetConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	return aSchema.activeConstraints(aSchema.constraintsForEntityClass(entityClassIdentifier, inherited))
+}
+
+// constraintsForEntityClass returns the constraints on the entity class, including deactivated ones
+func (aSchema *Schema) constraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	if aSchema.index != nil {
+		if inherited {
+			return indexedConstraints(aSchema.index.inheritedConstraints[entityClassIdentifier])
+		}
+		return indexedConstraints(aSchema.index.ownConstraints[entityClassIdentifier])
+	}
+	return aSchema.scanConstraintsForEntityClass(entityClassIdentifier, inherited)
+}
+
+// GetConstraintById returns the constraint loaded from the entity with the given id, or nil
+func (aSchema *Schema) GetConstraintById(constraintIdentifier string) ConstraintType {
+	if aSchema.index != nil {
+		return aSchema.index.constraints[constraintIdentifier]
+	}
+	for _, constraint := range aSchema.Constraints {
+		if constraint.GetID() == constraintIdentifier {
+			return constraint
+		}
+	}
+	return nil
+}
+
+// GetConstraintsForProperty returns the active property and reference constraints on the given property or reference class
+func (aSchema *Schema) GetConstraintsForProperty(propertyClassIdentifier string) []ConstraintType {
+	if aSchema.index != nil {
+		return aSchema.activeConstraints(indexedConstraints(aSchema.index.propertyConstraints[propertyClassIdentifier]))
+	}
+
+	constraints := make([]ConstraintType, 0)
+	for _, constraint := range aSchema.Constraints {
+		if propertyConstraint, ok := constraint.(propertyClassConstraint); ok {
+			if property, err := propertyConstraint.GetConstrainedPropertyClass(); err == nil && property == propertyClassIdentifier {
+				constraints = append(constraints, constraint)
 			}
 		}
+	}
+	return aSchema.activeConstraints(constraints)
+}
 
+func (aSchema *Schema) scanConstraintsForEntityClass(entityClassIdentifier string, inherited bool) []ConstraintType {
+	constraints := make([]ConstraintType, 0)
+	for _, constraint := range aSchema.Constraints {
+		appliesToEntityClass := constraint.GetAppliesToEntityClass()
+		if appliesToEntityClass != "" && appliesToEntityClass == entityClassIdentifier {
+			constraints = append(constraints, constraint)
+		}
 	}
 
 	// go up the hierarchy and get other constraints
 	if inherited {
 		superclasses, _ := aSchema.GetEntityClassClassHierarchy(entityClassIdentifier)
 		for _, superClass := range superclasses {
-			superConstraints := aSchema.GetConstraintsForEntityClass(superClass, false)
+			superConstraints := aSchema.scanConstraintsForEntityClass(superClass, false)
 
-			// filter out abstract constraints from any super classes
+			// filter out constraints such as is abstract that do not apply to subclasses
 			for _, superConstraint := range superConstraints {
-				switch superConstraint.(type) {
-				case *IsAbstractConstraint:
+				if !superConstraint.IsInherited() {
 					continue
 				}
 				constraints = append(constraints, superConstraint)
@@ -226,26 +456,33 @@ func (aSchema *Schema) IsAbstract(entityClass *EntityClass) bool {
 	return false
 }
 
-func (aSchema *Schema) initialize() {
-	entities := aSchema.EntityCollection.Entities
-	for _, entity := range entities {
-		if aSchema.IsOfType(entity, EGCLEntityClass) {
-			ec := NewEntityClass(entity)
-			aSchema.EntityClasses = append(aSchema.EntityClasses, ec)
-		} else if aSchema.IsOfType(entity, EGCLPropertyConstraint) {
-			c := newPropertyConstraint(entity)
-			aSchema.Constraints = append(aSchema.Constraints, c)
-		} else if aSchema.IsOfType(entity, EGCLReferenceConstraint) {
-			c := newReferenceConstraint(entity)
-			aSchema.Constraints = append(aSchema.Constraints, c)
-		} else if aSchema.IsOfType(entity, EGCLIsAbstractConstraint) {
-			c := newIsAbstractConstraint(entity)
-			aSchema.Constraints = append(aSchema.Constraints, c)
-		} else if aSchema.IsOfType(entity, EGCLApplicationConstraint) {
-			c := newApplicationConstraint(entity)
-			aSchema.Constraints = append(aSchema.Constraints, c)
+// definitionChecker is implemented by constraints that can tell when they are loaded that they cannot be checked
+type definitionChecker interface {
+	checkDefinition() error
+}
+
+func (aSchema *Schema) initialize(registry *ConstraintRegistry) error {
+	var definitionErr error
+	if aSchema.EntityCollection != nil {
+		for _, entity := range aSchema.EntityCollection.Entities {
+			if aSchema.IsOfType(entity, EGCLEntityClass) {
+				ec := NewEntityClass(entity)
+				aSchema.EntityClasses = append(aSchema.EntityClasses, ec)
+			} else if aSchema.IsOfType(entity, EGCLSchema) {
+				aSchema.initializeMetadata(entity)
+			} else if c := registry.NewConstraint(entity); c != nil {
+				aSchema.Constraints = append(aSchema.Constraints, c)
+				if checker, ok := c.(definitionChecker); ok && definitionErr == nil {
+					definitionErr = checker.checkDefinition()
+				}
+			}
 		}
 	}
+
+	if err := aSchema.Compile(); err != nil {
+		return err
+	}
+	return definitionErr
 }
 
 func NewEntityClass(entity *egdm.Entity) *EntityClass {
@@ -256,6 +493,8 @@ func NewEntityClass(entity *egdm.Entity) *EntityClass {
 
 type EntityClass struct {
 	Entity *egdm.Entity
+	// Source is the location of the schema document that defines the class, when it was loaded with LoadSchema
+	Source string
 }
 
 func (entityClass *EntityClass) GetLabel() string {
@@ -274,11 +513,55 @@ func (entityClass *EntityClass) GetDescription() string {
 	return val
 }
 
+// GetSuperclasses returns the direct superclasses of the entity class
+func (entityClass *EntityClass) GetSuperclasses() []string {
+	val, err := entityClass.Entity.GetReferenceValues(EGCLsubclassOf)
+	if err != nil {
+		return []string{}
+	}
+	return val
+}
+
 type Constraint struct {
 	Entity                   *egdm.Entity
 	ConstraintTypeIdentifier string
 }
 
+func (c *Constraint) GetID() string {
+	if c.Entity == nil {
+		return ""
+	}
+	return c.Entity.ID
+}
+
+func (c *Constraint) GetEntity() *egdm.Entity {
+	return c.Entity
+}
+
+func (c *Constraint) GetTypeIdentifier() string {
+	return c.ConstraintTypeIdentifier
+}
+
+func (c *Constraint) GetAppliesToEntityClass() string {
+	if c.Entity == nil {
+		return ""
+	}
+	if res, err := c.Entity.GetFirstReferenceValue(EGCLentityClass); err == nil {
+		return res
+	}
+	return ""
+}
+
+// IsInherited is true for constraints that also apply to subclasses of the entity class
+func (c *Constraint) IsInherited() bool {
+	return true
+}
+
+// Check is overridden by each constraint kind, the base constraint can not be checked
+func (c *Constraint) Check(validator *Validator, schema *Schema, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	return false, nil, errors.New("constraint type not supported")
+}
+
 type QueryConstraint struct {
 	Constraint
 }
@@ -292,6 +575,17 @@ func newPropertyConstraint(entity *egdm.Entity) *PropertyConstraint {
 
 type PropertyConstraint struct {
 	Constraint
+	valueConstraintOnce  sync.Once
+	valueConstraint      *PropertyValueConstraint
+	valueConstraintError error
+}
+
+// GetValueConstraint returns the restrictions on the values of the property, these are read from the constraint entity once
+func (c *PropertyConstraint) GetValueConstraint() (*PropertyValueConstraint, error) {
+	c.valueConstraintOnce.Do(func() {
+		c.valueConstraint, c.valueConstraintError = newPropertyValueConstraint(c.Entity)
+	})
+	return c.valueConstraint, c.valueConstraintError
 }
 
 func (c *PropertyConstraint) GetDataType() string {
@@ -390,6 +684,28 @@ func (aReferenceConstraint *ReferenceConstraint) GetInverseConstrainedPropertyCl
 	return aReferenceConstraint.Entity.GetFirstReferenceValue(EGCLInverseReferenceClass)
 }
 
+// GetAllowedReferences returns the explicit list of entity ids that may be referenced, or nil if any id is allowed
+func (aReferenceConstraint *ReferenceConstraint) GetAllowedReferences() []string {
+	values, err := aReferenceConstraint.Entity.GetReferenceValues(EGCLin)
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
+// GetConceptScheme returns the SKOS concept scheme that referenced entities must be members of
+func (aReferenceConstraint *ReferenceConstraint) GetConceptScheme() (string, error) {
+	return aReferenceConstraint.Entity.GetFirstReferenceValue(EGCLconceptScheme)
+}
+
+// GetConceptSchemeDataset returns the dataset holding the concepts of the concept scheme, empty means all datasets
+func (aReferenceConstraint *ReferenceConstraint) GetConceptSchemeDataset() string {
+	if res, err := aReferenceConstraint.Entity.GetFirstStringPropertyValue(EGCLconceptSchemeDataset); err == nil {
+		return res
+	}
+	return ""
+}
+
 func newIsAbstractConstraint(entity *egdm.Entity) *IsAbstractConstraint {
 	iac := &IsAbstractConstraint{}
 	iac.Constraint.Entity = entity
@@ -401,6 +717,11 @@ type IsAbstractConstraint struct {
 	Constraint
 }
 
+// IsInherited is false as a subclass of an abstract class is not abstract itself
+func (c *IsAbstractConstraint) IsInherited() bool {
+	return false
+}
+
 func (c *IsAbstractConstraint) GetEntityClass() string {
 	if res, err := c.Entity.GetFirstReferenceValue(EGCLentityClass); err == nil {
 		return res
@@ -442,5 +763,67 @@ type InverseReferenceConstraint struct {
 	Constraint
 }
 
+// PropertyValueConstraint holds the restrictions a property constraint places on each value of the property.
+// Unset bounds are nil, unset lengths are -1 and an empty AllowedValues allows any value.
 type PropertyValueConstraint struct {
+	Pattern       *regexp.Regexp
+	MinInclusive  *float64
+	MaxInclusive  *float64
+	MinExclusive  *float64
+	MaxExclusive  *float64
+	MinLength     int
+	MaxLength     int
+	AllowedValues []any
+}
+
+func newPropertyValueConstraint(entity *egdm.Entity) (*PropertyValueConstraint, error) {
+	vc := &PropertyValueConstraint{MinLength: -1, MaxLength: -1}
+
+	if pattern, err := entity.GetFirstStringPropertyValue(EGCLpattern); err == nil {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern in constraint %s", entity.ID)
+		}
+		vc.Pattern = compiled
+	}
+
+	var err error
+	bounds := map[string]**float64{
+		EGCLminInclusive: &vc.MinInclusive,
+		EGCLmaxInclusive: &vc.MaxInclusive,
+		EGCLminExclusive: &vc.MinExclusive,
+		EGCLmaxExclusive: &vc.MaxExclusive,
+	}
+	for uri, bound := range bounds {
+		if value, ok := entity.Properties[uri]; ok {
+			number, isNumber := toFloat(value)
+			if !isNumber {
+				return nil, errors.Errorf("%s in constraint %s must be a number but is %v", uri, entity.ID, value)
+			}
+			*bound = &number
+		}
+	}
+
+	if _, ok := entity.Properties[EGCLminLength]; ok {
+		if vc.MinLength, err = entity.GetFirstIntPropertyValue(EGCLminLength); err != nil {
+			return nil, errors.Wrapf(err, "minLength in constraint %s", entity.ID)
+		}
+	}
+	if _, ok := entity.Properties[EGCLmaxLength]; ok {
+		if vc.MaxLength, err = entity.GetFirstIntPropertyValue(EGCLmaxLength); err != nil {
+			return nil, errors.Wrapf(err, "maxLength in constraint %s", entity.ID)
+		}
+	}
+
+	if allowed, ok := entity.Properties[EGCLin]; ok {
+		vc.AllowedValues = toValueArray(allowed)
+	}
+
+	return vc, nil
+}
+
+// IsEmpty is true when no value restrictions are defined
+func (vc *PropertyValueConstraint) IsEmpty() bool {
+	return vc.Pattern == nil && vc.MinInclusive == nil && vc.MaxInclusive == nil && vc.MinExclusive == nil &&
+		vc.MaxExclusive == nil && vc.MinLength < 0 && vc.MaxLength < 0 && len(vc.AllowedValues) == 0
 }
@@ -0,0 +1,183 @@
+package egcl
+
+import (
+	"strings"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+// DatasetSchemaPrefix marks schema locations that are datahub datasets, like dataset:schemas.people
+const DatasetSchemaPrefix = "dataset:"
+
+// SchemaDatasetStore is the part of the datahub client used to publish schemas, it is implemented by *datahub.Client
+type SchemaDatasetStore interface {
+	EntityStore
+	AddDataset(name string, namespaces []string) error
+	GetEntitiesStream(dataset string, from string, take int, reverse bool, expandURIs bool) (datahub.EntityIterator, error)
+}
+
+// LoadSchemaFromDataset loads a schema stored as entities in a dataset, together with the schemas it imports. Imports
+// of the form dataset:<name> are read from the provider as well, other imports are read by DefaultSchemaLoader. The
+// provider must return entities with expanded URIs, as RemoteDataProvider does.
+func LoadSchemaFromDataset(provider DataProvider, datasetName string) (*Schema, error) {
+	if provider == nil {
+		return nil, errors.New("no data provider configured")
+	}
+	return loadMergedSchema(DatasetSchemaPrefix+datasetName, nil, provider)
+}
+
+// PublishSchema stores the entities of the schema in a dataset, creating the dataset if it does not exist. The
+// entities of imported schemas are included, so the stored schema has no imports. Entities in the dataset that are no
+// longer part of the schema are deleted, so that loading the dataset gives back the published schema.
+func PublishSchema(store SchemaDatasetStore, schema *Schema, datasetName string) error {
+	if schema == nil || schema.EntityCollection == nil {
+		return errors.New("schema has no entities to publish")
+	}
+	if err := store.AddDataset(datasetName, nil); err != nil {
+		return errors.Wrapf(err, "creating dataset %s", datasetName)
+	}
+
+	nsm := egdm.NewNamespaceContext()
+	for prefix, expansion := range schema.EntityCollection.NamespaceManager.GetNamespaceMappings() {
+		nsm.StorePrefixExpansionMapping(prefix, expansion)
+	}
+	published := egdm.NewEntityCollection(nsm)
+	ids := make(map[string]bool)
+	for _, entity := range schema.EntityCollection.Entities {
+		compacted, err := compactEntity(nsm, entity)
+		if err != nil {
+			return errors.Wrapf(err, "publishing %s", entity.ID)
+		}
+		if isOfType(entity, EGCLSchema) {
+			delete(compacted.Properties, compactIdentifier(nsm, EGCLimports))
+		}
+		ids[entity.ID] = true
+		if err := published.AddEntity(compacted); err != nil {
+			return err
+		}
+	}
+
+	existing, err := store.GetEntitiesStream(datasetName, "", -1, false, true)
+	if err != nil {
+		return errors.Wrapf(err, "reading dataset %s", datasetName)
+	}
+	for {
+		entity, err := existing.Next()
+		if err != nil {
+			return errors.Wrapf(err, "reading dataset %s", datasetName)
+		}
+		if entity == nil {
+			break
+		}
+		if entity.IsDeleted || ids[entity.ID] {
+			continue
+		}
+		deleted := egdm.NewEntity().SetID(compactIdentifier(nsm, entity.ID))
+		deleted.IsDeleted = true
+		if err := published.AddEntity(deleted); err != nil {
+			return err
+		}
+	}
+
+	return store.StoreEntities(datasetName, published)
+}
+
+// datasetSchemaName returns the dataset of a dataset: location
+func datasetSchemaName(location string) (string, bool) {
+	if !strings.HasPrefix(location, DatasetSchemaPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(location, DatasetSchemaPrefix), true
+}
+
+// loadDatasetEntities reads the entities of a dataset that are not deleted, with the namespaces of the dataset
+func loadDatasetEntities(provider DataProvider, dataset string) (*egdm.EntityCollection, error) {
+	iterator, err := provider.GetDatasetEntities(dataset)
+	if err != nil {
+		return nil, err
+	}
+	ec := egdm.NewEntityCollection(nil)
+	for {
+		entity, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entity == nil {
+			break
+		}
+		if !entity.IsDeleted {
+			if err := ec.AddEntity(entity); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if context := iterator.Context(); context != nil {
+		for prefix, expansion := range context.Namespaces {
+			ec.NamespaceManager.StorePrefixExpansionMapping(prefix, expansion)
+		}
+	}
+	if len(ec.Entities) == 0 {
+		return nil, errors.Errorf("dataset %s has no schema entities", dataset)
+	}
+	return ec, nil
+}
+
+// compactEntity returns a copy of the entity with prefixed identifiers, as datahub stores them
+func compactEntity(nsm egdm.NamespaceManager, entity *egdm.Entity) (*egdm.Entity, error) {
+	compacted := egdm.NewEntity().SetID(compactIdentifier(nsm, entity.ID))
+	compacted.IsDeleted = entity.IsDeleted
+	for key, value := range entity.Properties {
+		// nested entities, like violations, are compacted with the entity
+		switch v := value.(type) {
+		case *egdm.Entity:
+			nested, err := compactEntity(nsm, v)
+			if err != nil {
+				return nil, err
+			}
+			value = nested
+		case []any:
+			values := make([]any, len(v))
+			for i, item := range v {
+				values[i] = item
+				if nestedEntity, ok := item.(*egdm.Entity); ok {
+					nested, err := compactEntity(nsm, nestedEntity)
+					if err != nil {
+						return nil, err
+					}
+					values[i] = nested
+				}
+			}
+			value = values
+		}
+		compacted.Properties[compactIdentifier(nsm, key)] = value
+	}
+	for key, value := range entity.References {
+		if ref, ok := value.(string); ok {
+			compacted.References[compactIdentifier(nsm, key)] = compactIdentifier(nsm, ref)
+			continue
+		}
+		refs, ok := toStringArray(value)
+		if !ok {
+			return nil, errors.Errorf("reference %s is %T, expected a string or list of strings", key, value)
+		}
+		values := make([]string, len(refs))
+		for i, ref := range refs {
+			values[i] = compactIdentifier(nsm, ref)
+		}
+		compacted.References[compactIdentifier(nsm, key)] = values
+	}
+	return compacted, nil
+}
+
+// compactIdentifier turns a URI into a prefixed identifier, adding a prefix for namespaces without one
+func compactIdentifier(nsm egdm.NamespaceManager, uri string) string {
+	if !nsm.IsFullUri(uri) {
+		return uri
+	}
+	if prefixed, err := nsm.AssertPrefixedIdentifierFromURI(uri); err == nil {
+		return prefixed
+	}
+	return uri
+}
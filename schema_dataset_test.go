@@ -0,0 +1,108 @@
+package egcl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mimiro-io/datahub-client-sdk-go"
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+var _ SchemaDatasetStore = (*datahub.Client)(nil)
+
+// jsonDatasetStore keeps datasets as a datahub would, stored entities are written as EGDM JSON and parsed back with
+// expanded URIs, and later versions replace earlier ones
+type jsonDatasetStore struct {
+	datasets map[string]*egdm.EntityCollection
+}
+
+func (s *jsonDatasetStore) AddDataset(name string, namespaces []string) error {
+	if _, ok := s.datasets[name]; !ok {
+		s.datasets[name] = egdm.NewEntityCollection(nil)
+	}
+	return nil
+}
+
+func (s *jsonDatasetStore) StoreEntities(dataset string, entities *egdm.EntityCollection) error {
+	var buffer bytes.Buffer
+	if err := entities.WriteEntityGraphJSON(&buffer); err != nil {
+		return err
+	}
+	parsed, err := egdm.NewEntityParser(egdm.NewNamespaceContext()).WithExpandURIs().LoadEntityCollection(&buffer)
+	if err != nil {
+		return err
+	}
+
+	stored := s.datasets[dataset]
+	for _, entity := range parsed.Entities {
+		replaced := false
+		for i, existing := range stored.Entities {
+			if existing.ID == entity.ID {
+				stored.Entities[i] = entity
+				replaced = true
+			}
+		}
+		if !replaced {
+			_ = stored.AddEntity(entity)
+		}
+	}
+	for prefix, expansion := range parsed.NamespaceManager.GetNamespaceMappings() {
+		stored.NamespaceManager.StorePrefixExpansionMapping(prefix, expansion)
+	}
+	return nil
+}
+
+func (s *jsonDatasetStore) GetEntitiesStream(dataset string, from string, take int, reverse bool, expandURIs bool) (datahub.EntityIterator, error) {
+	return NewCollectionDataProvider().WithDataset(dataset, s.datasets[dataset]).GetDatasetEntities(dataset)
+}
+
+func TestPublishAndLoadSchemaFromDataset(t *testing.T) {
+	schema, err := parseYaml([]byte(impactSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &jsonDatasetStore{datasets: make(map[string]*egdm.EntityCollection)}
+	if err := PublishSchema(store, schema, "schemas.model"); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewCollectionDataProvider().WithDataset("schemas.model", store.datasets["schemas.model"])
+	loaded, err := LoadSchemaFromDataset(provider, "schemas.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := DiffSchemas(schema, loaded); len(diff.Changes) != 0 {
+		t.Fatalf("expected the loaded schema to equal the published one, got %v", diff.Changes)
+	}
+	if len(loaded.EntityClasses) != 4 || len(loaded.Constraints) != len(schema.Constraints) {
+		t.Errorf("expected 4 classes and %d constraints, got %d and %d", len(schema.Constraints), len(loaded.EntityClasses), len(loaded.Constraints))
+	}
+
+	// republishing without the Member class deletes it from the dataset
+	reduced, err := parseYaml([]byte(strings.Split(impactSchemaYaml, "- id: model:Member")[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishSchema(store, reduced, "schemas.model"); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err = LoadSchemaFromDataset(provider, "schemas.model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.GetEntityClassById("http://data.mimiro.io/amodel/Member") != nil || len(loaded.EntityClasses) != 3 {
+		t.Errorf("expected Member to be removed, got %d classes", len(loaded.EntityClasses))
+	}
+
+	if _, err := LoadSchemaFromDataset(provider, "missing"); err == nil {
+		t.Errorf("expected an error for a dataset without schema entities")
+	}
+
+	if err := PublishSchema(store, &Schema{}, "schemas.empty"); err == nil {
+		t.Errorf("expected an error for a schema without entities")
+	}
+	if _, ok := store.datasets["schemas.empty"]; ok {
+		t.Errorf("expected no dataset to be created for a schema without entities")
+	}
+}
@@ -1,6 +1,9 @@
 package egcl
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -360,6 +363,25 @@ func TestEntityClassInheritance(t *testing.T) {
 			personConstraints := schema.GetConstraintsForEntityClass("http://data.mimiro.io/schema/Person", true)
 			g.Assert(len(personConstraints)).Equal(1)
 		})
+		g.It("should know subclasses", func() {
+			reader := strings.NewReader(config)
+
+			parser := newParser()
+			ec, err := parser.LoadEntityCollection(reader)
+
+			g.Assert(err).IsNil()
+
+			schema := NewSchema(ec)
+			g.Assert(schema.IsSubClassOf("http://data.mimiro.io/schema/Person", "http://data.mimiro.io/schema/OrgUnit")).IsTrue()
+			g.Assert(schema.IsSubClassOf("http://data.mimiro.io/schema/Person", "http://data.mimiro.io/schema/Thing")).IsTrue()
+			g.Assert(schema.IsSubClassOf("http://data.mimiro.io/schema/Person", "http://data.mimiro.io/schema/Person")).IsTrue()
+			g.Assert(schema.IsSubClassOf("http://data.mimiro.io/schema/OrgUnit", "http://data.mimiro.io/schema/Person")).IsFalse()
+			g.Assert(schema.IsSubClassOf("http://data.mimiro.io/schema/Person", "http://data.mimiro.io/schema/Company")).IsFalse()
+
+			types := []string{"http://data.mimiro.io/schema/Unknown", "http://data.mimiro.io/schema/Company"}
+			g.Assert(schema.IsInstanceOfClass(types, "http://data.mimiro.io/schema/OrgUnit")).IsTrue()
+			g.Assert(schema.IsInstanceOfClass(types, "http://data.mimiro.io/schema/Person")).IsFalse()
+		})
 	})
 
 }
@@ -560,3 +582,160 @@ func TestHtmlGenerator(t *testing.T) {
 	//	htmlGen := NewHtmlGenerator()
 	// 	htmlGen.GenerateHtml(schema, "testschema")
 }
+
+// newGeneratedSchema builds a schema with a chain of classes, each subclass of the previous one, and a number of
+// property and reference constraints per class
+func newGeneratedSchema(classCount int, constraintsPerClass int) *Schema {
+	nsm := egdm.NewNamespaceContext()
+	nsm.StorePrefixExpansionMapping("model", "http://data.mimiro.io/model/")
+	ec := egdm.NewEntityCollection(nsm)
+
+	for i := 0; i < classCount; i++ {
+		classId := fmt.Sprintf("http://data.mimiro.io/model/Class%d", i)
+		class := egdm.NewEntity().SetID(classId)
+		class.SetReference(RDfTypeURI, EGCLEntityClass)
+		if i > 0 && i%10 != 0 {
+			class.SetReference(EGCLsubclassOf, fmt.Sprintf("http://data.mimiro.io/model/Class%d", i-1))
+		}
+		_ = ec.AddEntity(class)
+
+		for j := 0; j < constraintsPerClass; j++ {
+			constraint := egdm.NewEntity().SetID(fmt.Sprintf("%s-constraint-%d", classId, j))
+			constraint.SetReference(EGCLentityClass, classId)
+			constraint.SetProperty(EGCLminCardinality, 0)
+			if j%2 == 0 {
+				constraint.SetReference(RDfTypeURI, EGCLPropertyConstraint)
+				constraint.SetReference(EGCLpropertyClass, fmt.Sprintf("http://data.mimiro.io/model/prop%d", j))
+			} else {
+				constraint.SetReference(RDfTypeURI, EGCLReferenceConstraint)
+				constraint.SetReference(EGCLreferenceClass, fmt.Sprintf("http://data.mimiro.io/model/ref%d", j))
+				constraint.SetReference(EGCLallowedReferencedClass, fmt.Sprintf("http://data.mimiro.io/model/Class%d", (i+1)%classCount))
+				constraint.SetReference(EGCLInverseReferenceClass, fmt.Sprintf("http://data.mimiro.io/model/inverseRef%d", j))
+			}
+			_ = ec.AddEntity(constraint)
+		}
+
+		if i%7 == 0 {
+			abstract := egdm.NewEntity().SetID(fmt.Sprintf("%s-abstract", classId))
+			abstract.SetReference(RDfTypeURI, EGCLIsAbstractConstraint)
+			abstract.SetReference(EGCLentityClass, classId)
+			_ = ec.AddEntity(abstract)
+		}
+	}
+
+	return NewSchema(ec)
+}
+
+func TestCompiledSchemaMatchesScan(t *testing.T) {
+	schema := newGeneratedSchema(50, 4)
+
+	classIds := []string{"http://data.mimiro.io/model/Unknown"}
+	for _, ec := range schema.EntityClasses {
+		classIds = append(classIds, ec.Entity.ID)
+	}
+
+	for _, classId := range classIds {
+		for _, inherited := range []bool{false, true} {
+			indexed := schema.GetConstraintsForEntityClass(classId, inherited)
+			scanned := schema.scanConstraintsForEntityClass(classId, inherited)
+			if !reflect.DeepEqual(indexed, scanned) {
+				t.Errorf("constraints for %s (inherited %v) differ: %d indexed, %d scanned", classId, inherited, len(indexed), len(scanned))
+			}
+
+			indexed = schema.GetOutgoingInverseConstraintsForEntityClass(classId, inherited)
+			scanned = schema.scanOutgoingInverseConstraintsForEntityClass(classId, inherited)
+			if !reflect.DeepEqual(indexed, scanned) {
+				t.Errorf("inverse constraints for %s (inherited %v) differ: %d indexed, %d scanned", classId, inherited, len(indexed), len(scanned))
+			}
+		}
+
+		if schema.GetEntityClassById(classId) != schema.scanEntityClassById(classId) {
+			t.Errorf("entity class lookup for %s differs", classId)
+		}
+	}
+
+	if len(schema.GetConstraintsForProperty("http://data.mimiro.io/model/prop2")) != 50 {
+		t.Errorf("expected 50 constraints on prop2")
+	}
+
+	// appending to a returned slice must not change the index
+	constraints := schema.GetConstraintsForEntityClass("http://data.mimiro.io/model/Class5", true)
+	_ = append(constraints, &PropertyConstraint{})
+	if len(schema.GetConstraintsForEntityClass("http://data.mimiro.io/model/Class5", true)) != len(constraints) {
+		t.Errorf("index was modified through returned slice")
+	}
+}
+
+func BenchmarkGetConstraintsForEntityClass(b *testing.B) {
+	for _, classCount := range []int{10, 100, 1000} {
+		schema := newGeneratedSchema(classCount, 6)
+		classId := fmt.Sprintf("http://data.mimiro.io/model/Class%d", classCount/2+3)
+
+		b.Run(fmt.Sprintf("indexed/classes=%d", classCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				schema.GetConstraintsForEntityClass(classId, true)
+			}
+		})
+		b.Run(fmt.Sprintf("scan/classes=%d", classCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				schema.scanConstraintsForEntityClass(classId, true)
+			}
+		})
+	}
+}
+
+func BenchmarkGetEntityClassById(b *testing.B) {
+	for _, classCount := range []int{10, 100, 1000} {
+		schema := newGeneratedSchema(classCount, 0)
+		classId := fmt.Sprintf("http://data.mimiro.io/model/Class%d", classCount-1)
+
+		b.Run(fmt.Sprintf("indexed/classes=%d", classCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				schema.GetEntityClassById(classId)
+			}
+		})
+		b.Run(fmt.Sprintf("scan/classes=%d", classCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				schema.scanEntityClassById(classId)
+			}
+		})
+	}
+}
+
+func BenchmarkValidateEntity(b *testing.B) {
+	for _, classCount := range []int{10, 100, 1000} {
+		schema := newGeneratedSchema(classCount, 6)
+		entity := egdm.NewEntity().SetID("http://data.mimiro.io/things/1")
+		entity.SetReference(RDfTypeURI, fmt.Sprintf("http://data.mimiro.io/model/Class%d", classCount/2+3))
+		entity.SetProperty("http://data.mimiro.io/model/prop0", "value")
+		v := NewValidator().WithSettings(&ValidatorSettings{})
+
+		b.Run(fmt.Sprintf("classes=%d", classCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, _ = v.ValidateEntity(schema, entity)
+			}
+		})
+	}
+}
+
+func TestSubClassOfCycleIsAnError(t *testing.T) {
+	_, err := NewSchemaFromYaml(`
+- id: "@context"
+  namespaces:
+    core: http://data.mimiro.io/core/model/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: core:Person
+  superclasses: [core:Agent]
+  propertyConstraints:
+    - propertyClass: core:name
+      minCard: 1
+
+- id: core:Agent
+  superclasses: [core:Person]
+`)
+	if !errors.Is(err, ErrCyclicHierarchy) {
+		t.Fatalf("expected a cyclic hierarchy error, got %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+package egcl
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const EGCLseverity = EGCLUriExpansion + "severity"
+
+const (
+	EGCLInfo      = EGCLUriExpansion + "Info"
+	EGCLWarning   = EGCLUriExpansion + "Warning"
+	EGCLViolation = EGCLUriExpansion + "Violation"
+)
+
+// Severity orders how serious a violation is. The zero value is not a severity, settings leave it to get the default.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota + 1
+	SeverityWarning
+	SeverityViolation
+)
+
+// DefaultSeverity is used for constraints without egcl:severity and as the default threshold
+const DefaultSeverity = SeverityViolation
+
+var severityURIs = map[Severity]string{
+	SeverityInfo:      EGCLInfo,
+	SeverityWarning:   EGCLWarning,
+	SeverityViolation: EGCLViolation,
+}
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityViolation:
+		return "violation"
+	}
+	return "unknown"
+}
+
+// URI returns the egcl resource for the severity
+func (s Severity) URI() string {
+	return severityURIs[s]
+}
+
+// ParseSeverity accepts info, warning and violation in any case
+func ParseSeverity(name string) (Severity, error) {
+	for severity := SeverityInfo; severity <= SeverityViolation; severity++ {
+		if strings.EqualFold(name, severity.String()) {
+			return severity, nil
+		}
+	}
+	return 0, errors.Errorf("unknown severity '%s', expected info, warning or violation", name)
+}
+
+func isSeverityURI(uri string) bool {
+	for _, severityURI := range severityURIs {
+		if uri == severityURI {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSeverity returns the egcl:severity of the constraint, or the default severity if it has none
+func (c *Constraint) GetSeverity() Severity {
+	if c.Entity == nil {
+		return DefaultSeverity
+	}
+	uri, err := c.Entity.GetFirstReferenceValue(EGCLseverity)
+	if err != nil {
+		return DefaultSeverity
+	}
+	for severity, severityURI := range severityURIs {
+		if uri == severityURI {
+			return severity
+		}
+	}
+	return DefaultSeverity
+}
+
+// severityThreshold is the lowest severity that makes validation fail
+func (v *Validator) severityThreshold() Severity {
+	if v.settings == nil || v.settings.SeverityThreshold == 0 {
+		return DefaultSeverity
+	}
+	return v.settings.SeverityThreshold
+}
+
+// isFailure is true if the violation is at or above the severity threshold
+func (v *Validator) isFailure(violation *ConstraintViolation) bool {
+	return violation.Severity >= v.severityThreshold()
+}
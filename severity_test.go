@@ -0,0 +1,139 @@
+package egcl
+
+import (
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+const severitySchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  propertyConstraints:
+    - propertyClass: model:name
+      minCard: 1
+    - propertyClass: model:email
+      minCard: 1
+      severity: warning
+  comparisonConstraints:
+    - propertyClass: model:nickname
+      operator: "!="
+      otherPropertyClass: model:name
+      severity: Info
+  conditionalConstraints:
+    - if:
+        propertyClass: model:status
+        equals: retired
+      then:
+        propertyConstraints:
+          - propertyClass: model:retiredDate
+            minCard: 1
+      severity: warning
+`
+
+func TestSeverity(t *testing.T) {
+	schema, err := parseYaml([]byte(severitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	person := egdm.NewEntity().SetID("http://data.mimiro.io/things/bob")
+	person.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Person")
+	person.SetProperty("http://data.mimiro.io/amodel/name", "bob")
+	person.SetProperty("http://data.mimiro.io/amodel/nickname", "bob")
+	person.SetProperty("http://data.mimiro.io/amodel/status", "retired")
+
+	cases := []struct {
+		threshold Severity
+		ok        bool
+	}{
+		{0, true},
+		{SeverityViolation, true},
+		{SeverityWarning, false},
+		{SeverityInfo, false},
+	}
+	for _, tc := range cases {
+		ok, violations, err := NewValidator().WithSettings(&ValidatorSettings{SeverityThreshold: tc.threshold}).ValidateEntity(schema, person)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tc.ok {
+			t.Errorf("threshold %v: expected ok to be %v", tc.threshold, tc.ok)
+		}
+		if len(violations) != 3 {
+			t.Fatalf("threshold %v: expected all 3 violations to be reported, got %d", tc.threshold, len(violations))
+		}
+	}
+
+	_, violations, _ := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(schema, person)
+	severities := make(map[Severity]int)
+	for _, violation := range violations {
+		severities[violation.Severity]++
+	}
+	// the nested retired date violation has the severity of the conditional constraint
+	if severities[SeverityWarning] != 2 || severities[SeverityInfo] != 1 {
+		t.Errorf("unexpected severities %v", severities)
+	}
+
+	// violations at the default severity still fail validation
+	delete(person.Properties, "http://data.mimiro.io/amodel/name")
+	ok, _, _ := NewValidator().WithSettings(&ValidatorSettings{}).ValidateEntity(schema, person)
+	if ok {
+		t.Error("expected missing name to fail validation")
+	}
+}
+
+func TestSeverityParsing(t *testing.T) {
+	for _, name := range []string{"info", "Warning", "VIOLATION"} {
+		severity, err := ParseSeverity(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isSeverityURI(severity.URI()) {
+			t.Errorf("unexpected uri %s for %s", severity.URI(), name)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Error("expected unknown severity to be rejected")
+	}
+
+	_, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    egcl: http://data.mimiro.io/egcl/
+- id: model:Person
+  propertyConstraints:
+    - propertyClass: model:name
+      severity: fatal
+`))
+	if err == nil {
+		t.Error("expected schema with unknown severity to be rejected")
+	}
+}
+
+func TestSeveritySHACL(t *testing.T) {
+	schema, err := parseYaml([]byte(severitySchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	severities := make(map[string]int)
+	for _, shape := range shapes.GetEntities() {
+		if severity, err := shape.GetFirstReferenceValue(SHACLseverity); err == nil {
+			severities[severity]++
+		}
+	}
+	if severities[SHACLWarning] != 2 || severities[SHACLInfo] != 1 || len(severities) != 2 {
+		t.Errorf("unexpected shape severities %v", severities)
+	}
+}
@@ -0,0 +1,422 @@
+package egcl
+
+import (
+	"sort"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+	"github.com/pkg/errors"
+)
+
+const SHACLUriExpansion = "http://www.w3.org/ns/shacl#"
+
+const (
+	SHACLNodeShape          = SHACLUriExpansion + "NodeShape"
+	SHACLPropertyShape      = SHACLUriExpansion + "PropertyShape"
+	SHACLIRI                = SHACLUriExpansion + "IRI"
+	SHACLtargetClass        = SHACLUriExpansion + "targetClass"
+	SHACLproperty           = SHACLUriExpansion + "property"
+	SHACLnode               = SHACLUriExpansion + "node"
+	SHACLpath               = SHACLUriExpansion + "path"
+	SHACLname               = SHACLUriExpansion + "name"
+	SHACLdescription        = SHACLUriExpansion + "description"
+	SHACLminCount           = SHACLUriExpansion + "minCount"
+	SHACLmaxCount           = SHACLUriExpansion + "maxCount"
+	SHACLdatatype           = SHACLUriExpansion + "datatype"
+	SHACLclass              = SHACLUriExpansion + "class"
+	SHACLnodeKind           = SHACLUriExpansion + "nodeKind"
+	SHACLpattern            = SHACLUriExpansion + "pattern"
+	SHACLminInclusive       = SHACLUriExpansion + "minInclusive"
+	SHACLmaxInclusive       = SHACLUriExpansion + "maxInclusive"
+	SHACLminExclusive       = SHACLUriExpansion + "minExclusive"
+	SHACLmaxExclusive       = SHACLUriExpansion + "maxExclusive"
+	SHACLminLength          = SHACLUriExpansion + "minLength"
+	SHACLmaxLength          = SHACLUriExpansion + "maxLength"
+	SHACLin                 = SHACLUriExpansion + "in"
+	SHACLand                = SHACLUriExpansion + "and"
+	SHACLor                 = SHACLUriExpansion + "or"
+	SHACLxone               = SHACLUriExpansion + "xone"
+	SHACLnot                = SHACLUriExpansion + "not"
+	SHACLseverity           = SHACLUriExpansion + "severity"
+	SHACLmessage            = SHACLUriExpansion + "message"
+	SHACLdeactivated        = SHACLUriExpansion + "deactivated"
+	SHACLInfo               = SHACLUriExpansion + "Info"
+	SHACLWarning            = SHACLUriExpansion + "Warning"
+	SHACLViolation          = SHACLUriExpansion + "Violation"
+	SHACLinversePath        = SHACLUriExpansion + "inversePath"
+	SHACLalternativePath    = SHACLUriExpansion + "alternativePath"
+	SHACLzeroOrMorePath     = SHACLUriExpansion + "zeroOrMorePath"
+	SHACLequals             = SHACLUriExpansion + "equals"
+	SHACLdisjoint           = SHACLUriExpansion + "disjoint"
+	SHACLlessThan           = SHACLUriExpansion + "lessThan"
+	SHACLlessThanOrEquals   = SHACLUriExpansion + "lessThanOrEquals"
+	SHACLqualifiedShape     = SHACLUriExpansion + "qualifiedValueShape"
+	SHACLqualifiedMinCount  = SHACLUriExpansion + "qualifiedMinCount"
+	SHACLshapeSuffix        = "Shape"
+	shaclConditionSuffix    = "-if"
+	shaclConditionValue     = "-if-value"
+	shaclConditionNotSuffix = "-unless"
+	shaclThenSuffix         = "-then"
+)
+
+// GenerateSHACL represents the schema as SHACL shapes. Each entity class becomes a node shape targeting the class, with
+// property shapes for its property, reference, comparison and path constraints and node shapes for its conditional and
+// logical constraints. The result can be written as JSON-LD. Abstract, application and inverse cardinality constraints have no SHACL
+// equivalent and are left out, as are constraint kinds registered by extensions.
+func GenerateSHACL(schema *Schema) (*egdm.EntityCollection, error) {
+	nsm := egdm.NewNamespaceContext()
+	nsm.StorePrefixExpansionMapping("sh", SHACLUriExpansion)
+	nsm.StorePrefixExpansionMapping("rdf", RDFUriExpansion)
+	nsm.StorePrefixExpansionMapping("egcl", EGCLUriExpansion)
+	if schema.EntityCollection != nil {
+		for prefix, expansion := range schema.EntityCollection.NamespaceManager.GetNamespaceMappings() {
+			if _, err := nsm.GetNamespaceExpansionForPrefix(prefix); err != nil {
+				nsm.StorePrefixExpansionMapping(prefix, expansion)
+			}
+		}
+	}
+	ec := egdm.NewEntityCollection(nsm)
+
+	for _, entityClass := range schema.EntityClasses {
+		classId := entityClass.Entity.ID
+		shape := egdm.NewEntity().SetID(classId + SHACLshapeSuffix)
+		shape.SetReference(RDfTypeURI, SHACLNodeShape)
+		shape.SetReference(SHACLtargetClass, classId)
+		if label := entityClass.GetLabel(); label != "" {
+			shape.SetProperty(SHACLname, label)
+		}
+		if description := entityClass.GetDescription(); description != "" {
+			shape.SetProperty(SHACLdescription, description)
+		}
+
+		properties := make([]string, 0)
+		nodes := make([]string, 0)
+		if superClasses, err := entityClass.Entity.GetReferenceValues(EGCLsubclassOf); err == nil {
+			for _, superClass := range superClasses {
+				nodes = append(nodes, superClass+SHACLshapeSuffix)
+			}
+		}
+		for _, constraint := range schema.constraintsForEntityClass(classId, false) {
+			switch constraint.(type) {
+			case *PropertyConstraint, *ReferenceConstraint, *PropertyComparisonConstraint, *PathConstraint:
+				properties = append(properties, constraint.GetID())
+			case *ConditionalConstraint, *LogicalConstraint:
+				nodes = append(nodes, constraint.GetID())
+			}
+		}
+		if len(properties) > 0 {
+			shape.SetReference(SHACLproperty, properties)
+		}
+		if len(nodes) > 0 {
+			shape.SetReference(SHACLnode, nodes)
+		}
+
+		if err := ec.AddEntity(shape); err != nil {
+			return nil, err
+		}
+	}
+
+	// every constraint gets a shape so that nested constraints can be referred to by id
+	for _, constraint := range schema.Constraints {
+		shapes, err := shaclShapes(schema, constraint)
+		if err != nil {
+			return nil, err
+		}
+		if severity := constraint.GetSeverity(); len(shapes) > 0 && severity != DefaultSeverity {
+			shapes[0].SetReference(SHACLseverity, map[Severity]string{SeverityInfo: SHACLInfo, SeverityWarning: SHACLWarning}[severity])
+		}
+		if c, ok := constraint.(interface{ GetMessages() map[string]string }); ok && len(shapes) > 0 && len(c.GetMessages()) > 0 {
+			shapes[0].SetProperty(SHACLmessage, shaclMessages(c.GetMessages()))
+		}
+		if len(shapes) > 0 && constraint.IsDeactivated() {
+			shapes[0].SetProperty(SHACLdeactivated, true)
+		}
+		for _, shape := range shapes {
+			if err := ec.AddEntity(shape); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ec, nil
+}
+
+// shaclShapes returns the shapes for a single constraint, the first one has the id of the constraint
+func shaclShapes(schema *Schema, constraint ConstraintType) ([]*egdm.Entity, error) {
+	switch c := constraint.(type) {
+	case *PropertyConstraint:
+		shape, err := newSHACLPropertyShape(c.GetID(), c.Entity, EGCLpropertyClass, c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences())
+		if err != nil {
+			return nil, err
+		}
+		if datatype := c.GetDataType(); datatype != EGCLAny {
+			shape.SetReference(SHACLdatatype, datatype)
+		}
+		vc, err := c.GetValueConstraint()
+		if err != nil {
+			return nil, err
+		}
+		if vc.Pattern != nil {
+			shape.SetProperty(SHACLpattern, vc.Pattern.String())
+		}
+		for uri, bound := range map[string]*float64{SHACLminInclusive: vc.MinInclusive, SHACLmaxInclusive: vc.MaxInclusive,
+			SHACLminExclusive: vc.MinExclusive, SHACLmaxExclusive: vc.MaxExclusive} {
+			if bound != nil {
+				shape.SetProperty(uri, *bound)
+			}
+		}
+		if vc.MinLength >= 0 {
+			shape.SetProperty(SHACLminLength, vc.MinLength)
+		}
+		if vc.MaxLength >= 0 {
+			shape.SetProperty(SHACLmaxLength, vc.MaxLength)
+		}
+		if len(vc.AllowedValues) > 0 {
+			shape.SetProperty(SHACLin, shaclList(vc.AllowedValues))
+		}
+		return []*egdm.Entity{shape}, nil
+	case *ReferenceConstraint:
+		shape, err := newSHACLPropertyShape(c.GetID(), c.Entity, EGCLreferenceClass, c.GetMinAllowedOccurrences(), c.GetMaxAllowedOccurrences())
+		if err != nil {
+			return nil, err
+		}
+		shape.SetReference(SHACLnodeKind, SHACLIRI)
+		if referencedClass, err := c.GetAllowedReferencedClass(); err == nil {
+			shape.SetReference(SHACLclass, referencedClass)
+		}
+		if allowed := c.GetAllowedReferences(); allowed != nil {
+			shape.SetProperty(SHACLin, shaclIRIList(allowed))
+		}
+		return []*egdm.Entity{shape}, nil
+	case *PropertyComparisonConstraint:
+		return newSHACLComparisonShapes(c)
+	case *PathConstraint:
+		return newSHACLPathShapes(schema, c)
+	case *ConditionalConstraint:
+		return newSHACLConditionalShapes(c)
+	case *LogicalConstraint:
+		shape := egdm.NewEntity().SetID(c.GetID())
+		shape.SetReference(RDfTypeURI, SHACLNodeShape)
+		members := c.GetMemberConstraintIds()
+		switch c.GetOperator() {
+		case "and":
+			shape.SetProperty(SHACLand, shaclIRIList(members))
+		case "or":
+			shape.SetProperty(SHACLor, shaclIRIList(members))
+		case "xone":
+			shape.SetProperty(SHACLxone, shaclIRIList(members))
+		case "not":
+			// sh:not takes a single shape, so several constraints are negated as a group
+			if len(members) == 1 {
+				shape.SetReference(SHACLnot, members[0])
+			} else {
+				group := egdm.NewEntity().SetID(c.GetID() + "-group")
+				group.SetReference(RDfTypeURI, SHACLNodeShape)
+				group.SetProperty(SHACLor, shaclIRIList(members))
+				shape.SetReference(SHACLnot, group.ID)
+				return []*egdm.Entity{shape, group}, nil
+			}
+		}
+		return []*egdm.Entity{shape}, nil
+	}
+
+	return []*egdm.Entity{}, nil
+}
+
+func newSHACLPropertyShape(id string, constraintEntity *egdm.Entity, pathReference string, minCard int, maxCard int) (*egdm.Entity, error) {
+	shape := egdm.NewEntity().SetID(id)
+	shape.SetReference(RDfTypeURI, SHACLPropertyShape)
+	path, err := constraintEntity.GetFirstReferenceValue(pathReference)
+	if err != nil {
+		return nil, err
+	}
+	shape.SetReference(SHACLpath, path)
+	if minCard > 0 {
+		shape.SetProperty(SHACLminCount, minCard)
+	}
+	if maxCard >= 0 {
+		shape.SetProperty(SHACLmaxCount, maxCard)
+	}
+	return shape, nil
+}
+
+// newSHACLConditionalShapes expresses if condition then constraints as: not condition or all constraints
+func newSHACLConditionalShapes(c *ConditionalConstraint) ([]*egdm.Entity, error) {
+	shapes := make([]*egdm.Entity, 0)
+
+	condition := egdm.NewEntity().SetID(c.GetID() + shaclConditionSuffix)
+	condition.SetReference(RDfTypeURI, SHACLPropertyShape)
+	var values any
+	if propertyClass, err := c.GetConditionPropertyClass(); err == nil {
+		condition.SetReference(SHACLpath, propertyClass)
+		if v, ok := c.Entity.Properties[EGCLifValue]; ok {
+			values = toValueArray(v)
+		}
+	} else if referenceClass, err := c.GetConditionReferenceClass(); err == nil {
+		condition.SetReference(SHACLpath, referenceClass)
+		if v, err := c.Entity.GetReferenceValues(EGCLifValue); err == nil {
+			values = v
+		}
+	} else {
+		return nil, err
+	}
+
+	if values == nil {
+		condition.SetProperty(SHACLminCount, 1)
+	} else {
+		valueShape := egdm.NewEntity().SetID(c.GetID() + shaclConditionValue)
+		valueShape.SetReference(RDfTypeURI, SHACLNodeShape)
+		if refs, isRefs := values.([]string); isRefs {
+			valueShape.SetProperty(SHACLin, shaclIRIList(refs))
+		} else {
+			valueShape.SetProperty(SHACLin, shaclList(values.([]any)))
+		}
+		condition.SetReference(SHACLqualifiedShape, valueShape.ID)
+		condition.SetProperty(SHACLqualifiedMinCount, 1)
+		shapes = append(shapes, valueShape)
+	}
+
+	unless := egdm.NewEntity().SetID(c.GetID() + shaclConditionNotSuffix)
+	unless.SetReference(RDfTypeURI, SHACLNodeShape)
+	unless.SetReference(SHACLnot, condition.ID)
+
+	then := egdm.NewEntity().SetID(c.GetID() + shaclThenSuffix)
+	then.SetReference(RDfTypeURI, SHACLNodeShape)
+	then.SetProperty(SHACLand, shaclIRIList(c.GetThenConstraintIds()))
+
+	shape := egdm.NewEntity().SetID(c.GetID())
+	shape.SetReference(RDfTypeURI, SHACLNodeShape)
+	shape.SetProperty(SHACLor, shaclIRIList([]string{unless.ID, then.ID}))
+
+	return append([]*egdm.Entity{shape, condition, unless, then}, shapes...), nil
+}
+
+// newSHACLComparisonShapes uses the SHACL property pair constraints, greater than comparisons are expressed as less than
+// comparisons with the path on the other property
+func newSHACLComparisonShapes(c *PropertyComparisonConstraint) ([]*egdm.Entity, error) {
+	propertyClass, err := c.GetConstrainedPropertyClass()
+	if err != nil {
+		return nil, err
+	}
+	otherPropertyClass, err := c.GetOtherPropertyClass()
+	if err != nil {
+		return nil, err
+	}
+
+	shape := egdm.NewEntity().SetID(c.GetID())
+	shape.SetReference(RDfTypeURI, SHACLPropertyShape)
+	shape.SetReference(SHACLpath, propertyClass)
+	switch c.GetOperator() {
+	case OperatorEquals:
+		shape.SetReference(SHACLequals, otherPropertyClass)
+	case OperatorNotEquals:
+		shape.SetReference(SHACLdisjoint, otherPropertyClass)
+	case OperatorLessThan:
+		shape.SetReference(SHACLlessThan, otherPropertyClass)
+	case OperatorLessThanOrEquals:
+		shape.SetReference(SHACLlessThanOrEquals, otherPropertyClass)
+	case OperatorGreaterThan:
+		shape.SetReference(SHACLpath, otherPropertyClass)
+		shape.SetReference(SHACLlessThan, propertyClass)
+	case OperatorGreaterThanOrEquals:
+		shape.SetReference(SHACLpath, otherPropertyClass)
+		shape.SetReference(SHACLlessThanOrEquals, propertyClass)
+	default:
+		return nil, errors.Errorf("comparison constraint %s has unknown operator '%s'", c.GetID(), c.GetOperator())
+	}
+	return []*egdm.Entity{shape}, nil
+}
+
+// newSHACLPathShapes writes the path as a SHACL property path. A comparison with the other path can only be expressed
+// when the other path is a single predicate and the operator is not a greater than comparison.
+func newSHACLPathShapes(schema *Schema, c *PathConstraint) ([]*egdm.Entity, error) {
+	var namespaceManager egdm.NamespaceManager
+	if schema.EntityCollection != nil {
+		namespaceManager = schema.EntityCollection.NamespaceManager
+	}
+	path, otherPath, err := c.GetPaths(namespaceManager)
+	if err != nil {
+		return nil, err
+	}
+
+	shape := egdm.NewEntity().SetID(c.GetID())
+	shape.SetReference(RDfTypeURI, SHACLPropertyShape)
+	if predicate, isPredicate := path.(*PredicatePath); isPredicate {
+		shape.SetReference(SHACLpath, predicate.Predicate)
+	} else {
+		shape.SetProperty(SHACLpath, shaclPath(path))
+	}
+	if minCard := c.GetMinAllowedOccurrences(); minCard > 0 {
+		shape.SetProperty(SHACLminCount, minCard)
+	}
+	if maxCard := c.GetMaxAllowedOccurrences(); maxCard >= 0 {
+		shape.SetProperty(SHACLmaxCount, maxCard)
+	}
+	if class, err := c.GetAllowedReferencedClass(); err == nil {
+		shape.SetReference(SHACLclass, class)
+	}
+	if otherPredicate, isPredicate := otherPath.(*PredicatePath); isPredicate {
+		if pair, ok := map[string]string{OperatorEquals: SHACLequals, OperatorNotEquals: SHACLdisjoint,
+			OperatorLessThan: SHACLlessThan, OperatorLessThanOrEquals: SHACLlessThanOrEquals}[c.GetOperator()]; ok {
+			shape.SetReference(pair, otherPredicate.Predicate)
+		}
+	}
+	return []*egdm.Entity{shape}, nil
+}
+
+// shaclPath returns the SHACL form of a path as a nested entity, sequences become JSON-LD lists
+func shaclPath(path PropertyPath) *egdm.Entity {
+	switch p := path.(type) {
+	case *PredicatePath:
+		return egdm.NewEntity().SetID(p.Predicate)
+	case *InversePath:
+		return egdm.NewEntity().SetProperty(SHACLinversePath, shaclPath(p.Path))
+	case *ZeroOrMorePath:
+		return egdm.NewEntity().SetProperty(SHACLzeroOrMorePath, shaclPath(p.Path))
+	case *AlternativePath:
+		return egdm.NewEntity().SetProperty(SHACLalternativePath, shaclPathList(p.Paths))
+	case *SequencePath:
+		return shaclPathList(p.Paths)
+	}
+	return nil
+}
+
+func shaclPathList(paths []PropertyPath) *egdm.Entity {
+	items := make([]any, len(paths))
+	for i, path := range paths {
+		items[i] = shaclPath(path)
+	}
+	return shaclList(items)
+}
+
+// shaclList returns the values as a JSON-LD list, as sh:in, sh:and, sh:or and sh:xone take RDF lists
+func shaclList(values []any) *egdm.Entity {
+	return egdm.NewEntity().SetProperty("@list", values)
+}
+
+// shaclIRIList returns a JSON-LD list of IRIs, like the shapes of a logical constraint
+func shaclIRIList(ids []string) *egdm.Entity {
+	items := make([]any, len(ids))
+	for i, id := range ids {
+		items[i] = egdm.NewEntity().SetID(id)
+	}
+	return shaclList(items)
+}
+
+// shaclMessages writes language variants as JSON-LD language tagged strings
+func shaclMessages(messages map[string]string) []any {
+	languages := make([]string, 0, len(messages))
+	for language := range messages {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+
+	values := make([]any, 0, len(messages))
+	for _, language := range languages {
+		if language == "" {
+			values = append(values, messages[language])
+			continue
+		}
+		values = append(values, egdm.NewEntity().SetProperty("@value", messages[language]).SetProperty("@language", language))
+	}
+	return values
+}
@@ -0,0 +1,148 @@
+package egcl
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	egdm "github.com/mimiro-io/entity-graph-data-model"
+)
+
+func TestGenerateSHACL(t *testing.T) {
+	schema, err := parseYaml([]byte(contactSchemaYaml + `
+- id: model:Employee
+  superclasses: [model:Contact]
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      referencedEntityClass: model:Company
+      maxCard: 1
+  conditionalConstraints:
+    - if:
+        propertyClass: model:status
+        equals: retired
+      then:
+        propertyConstraints:
+          - propertyClass: model:retiredDate
+            minCard: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shapes, err := GenerateSHACL(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shapeById := func(id string) *egdm.Entity {
+		for _, e := range shapes.GetEntities() {
+			if e.ID == id {
+				return e
+			}
+		}
+		return nil
+	}
+
+	contactShape := shapeById("http://data.mimiro.io/amodel/ContactShape")
+	if contactShape == nil {
+		t.Fatal("expected node shape for contact")
+	}
+	if target, _ := contactShape.GetFirstReferenceValue(SHACLtargetClass); target != "http://data.mimiro.io/amodel/Contact" {
+		t.Errorf("unexpected target class %s", target)
+	}
+	if name, _ := contactShape.GetFirstStringPropertyValue(SHACLname); name != "Contact" {
+		t.Errorf("unexpected name %s", name)
+	}
+	properties, _ := contactShape.GetReferenceValues(SHACLproperty)
+	nodes, _ := contactShape.GetReferenceValues(SHACLnode)
+	if len(properties) != 1 || len(nodes) != 3 {
+		t.Fatalf("expected 1 property shape and 3 node shapes, got %v and %v", properties, nodes)
+	}
+
+	name := shapeById(properties[0])
+	if path, _ := name.GetFirstReferenceValue(SHACLpath); path != "http://data.mimiro.io/amodel/name" {
+		t.Errorf("unexpected path %s", path)
+	}
+	if name.Properties[SHACLminCount] != 1 || name.Properties[SHACLmaxLength] != 20 {
+		t.Errorf("unexpected property shape %v", name.Properties)
+	}
+
+	operators := make([]string, 0)
+	for _, id := range nodes {
+		node := shapeById(id)
+		for _, operator := range []string{SHACLand, SHACLor, SHACLxone, SHACLnot} {
+			members, err := node.GetReferenceValues(operator)
+			if _, isList := node.Properties[operator]; isList {
+				members, err = shaclListIds(t, node, operator), nil
+			}
+			if err == nil {
+				operators = append(operators, strings.TrimPrefix(operator, SHACLUriExpansion))
+				for _, member := range members {
+					if shapeById(member) == nil {
+						t.Errorf("expected shape for member %s", member)
+					}
+				}
+			}
+		}
+	}
+	if !reflect.DeepEqual(operators, []string{"xone", "not", "or"}) {
+		t.Errorf("unexpected operators %v", operators)
+	}
+
+	employeeShape := shapeById("http://data.mimiro.io/amodel/EmployeeShape")
+	nodes, _ = employeeShape.GetReferenceValues(SHACLnode)
+	if len(nodes) != 2 || nodes[0] != "http://data.mimiro.io/amodel/ContactShape" {
+		t.Fatalf("expected superclass and conditional node shapes, got %v", nodes)
+	}
+	properties, _ = employeeShape.GetReferenceValues(SHACLproperty)
+	worksFor := shapeById(properties[0])
+	if class, _ := worksFor.GetFirstReferenceValue(SHACLclass); class != "http://data.mimiro.io/amodel/Company" {
+		t.Errorf("unexpected class %s", class)
+	}
+	conditional := shapeById(nodes[1])
+	if branches := shaclListIds(t, conditional, SHACLor); len(branches) != 2 {
+		t.Errorf("expected conditional as or of negated condition and consequence, got %v", branches)
+	}
+	then := shapeById(nodes[1] + shaclThenSuffix)
+	if members := shaclListIds(t, then, SHACLand); len(members) != 1 || shapeById(members[0]) == nil {
+		t.Errorf("expected consequence as a list of the then constraints, got %v", members)
+	}
+	values := shapeById(nodes[1] + shaclConditionValue).Properties[SHACLin].(*egdm.Entity).Properties["@list"]
+	if !reflect.DeepEqual(values, []any{"retired"}) {
+		t.Errorf("expected condition values as a list, got %v", values)
+	}
+
+	var buf bytes.Buffer
+	if err := shapes.WriteJSON_LD(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "http://www.w3.org/ns/shacl#") {
+		t.Error("expected shacl namespace in json-ld output")
+	}
+	if !strings.Contains(buf.String(), `"http://www.w3.org/ns/shacl#or":{"@list":[{"@id":`) {
+		t.Errorf("expected sh:or as a json-ld list, got %s", buf.String())
+	}
+}
+
+// shaclListIds returns the ids in the JSON-LD list of the property, failing when the value is not a list of IRIs
+func shaclListIds(t *testing.T, shape *egdm.Entity, property string) []string {
+	t.Helper()
+	list, ok := shape.Properties[property].(*egdm.Entity)
+	if !ok {
+		t.Fatalf("expected %s of %s to be a list, got %v", property, shape.ID, shape.Properties[property])
+	}
+	items, ok := list.Properties["@list"].([]any)
+	if !ok || len(list.Properties) != 1 || list.ID != "" {
+		t.Fatalf("expected %s of %s to be a list, got %v", property, shape.ID, list)
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		node, ok := item.(*egdm.Entity)
+		if !ok || node.ID == "" {
+			t.Fatalf("expected %s of %s to list IRIs, got %v", property, shape.ID, item)
+		}
+		ids[i] = node.ID
+	}
+	return ids
+}
@@ -1,11 +1,13 @@
 package egcl
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/mimiro-io/datahub-client-sdk-go"
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 	"github.com/pkg/errors"
 	"math"
+	"unicode/utf8"
 )
 
 type DataProvider interface {
@@ -21,6 +23,14 @@ type SchemaValidator interface {
 	ValidateEntityCollection(schema *Schema, entityCollection *egdm.EntityCollection) (ok bool, exceptions []*ConstraintViolation, err error)
 }
 
+const CoreUriExpansion = "http://data.mimiro.io/core/"
+const CorePartialsURI = CoreUriExpansion + "partials"
+const CoreDatasetURI = CoreUriExpansion + "dataset"
+
+var (
+	ErrUnexpectedEntityShape = errors.New("data provider returned an entity with an unexpected shape")
+)
+
 type NamespaceResolver interface {
 	ResolveNamespace(prefix string) (string, error)
 }
@@ -32,11 +42,24 @@ type ValidatorSettings struct {
 	ValidateRelated bool
 	// datasetsContext defines the set of datasets that are in play when checking referenced entities
 	DatasetsContext []string
+	// SeverityThreshold is the lowest severity that makes validation fail, violations below it are still reported.
+	// Defaults to SeverityViolation.
+	SeverityThreshold Severity
+	// Language selects the egcl:message variant used for violation messages, like en or nb-NO
+	Language string
+	// Profile selects the constraints that are checked, when nil all constraints that are not deactivated are checked
+	Profile *ValidationProfile
+	// IgnoreDeprecations turns off the warnings for data that uses deprecated classes and properties
+	IgnoreDeprecations bool
 }
 
 type Validator struct {
 	settings     *ValidatorSettings
 	dataProvider DataProvider
+	resolver     *ReferenceResolver
+	// localGraph holds the entities being validated, paths are evaluated against it when there is no data provider
+	localGraph *localGraph
+	observer   ValidationObserver
 }
 
 func NewValidator() *Validator {
@@ -48,8 +71,21 @@ func (v *Validator) WithSettings(settings *ValidatorSettings) *Validator {
 	return v
 }
 
+// WithDataProvider sets the provider used to access data. Entity lookups are routed through a ReferenceResolver
+// so that they are batched and cached, pass a configured ReferenceResolver to control its batch and cache sizes.
 func (v *Validator) WithDataProvider(provider DataProvider) *Validator {
-	v.dataProvider = provider
+	if provider == nil {
+		v.dataProvider = nil
+		v.resolver = nil
+		return v
+	}
+
+	resolver, ok := provider.(*ReferenceResolver)
+	if !ok {
+		resolver = NewReferenceResolver(provider)
+	}
+	v.dataProvider = resolver
+	v.resolver = resolver
 	return v
 }
 
@@ -63,29 +99,89 @@ const (
 	ReferenceNotFound
 	ReferenceTypeMismatch
 	AbstractEntityClassViolation
+	ValuePatternMismatch
+	MinValueNotMet
+	MaxValueExceeded
+	MinLengthNotMet
+	MaxLengthExceeded
+	ValueNotAllowed
+	ReferenceNotAllowed
+	LogicalConstraintNotSatisfied
+	PropertyComparisonFailed
+	DeprecatedEntityClassUsed
+	DeprecatedPropertyUsed
 )
 
 // for our purposes, we can use math.MaxInt32 as infinity
 const MaxInt = math.MaxInt32
 
 type ConstraintViolation struct {
-	Constraint    any
+	Constraint    ConstraintType
 	Entity        *egdm.Entity
 	ViolationType ViolationType
 	Message       string
+	// Severity is taken from the constraint that was checked for the entity
+	Severity Severity
+	// EntityClass is the class the entity was validated as an instance of
+	EntityClass string
+	// Property is the property or reference class, or path, that was checked
+	Property string
+	// Expected and Actual describe the values required by the constraint and those found
+	Expected any
+	Actual   any
+	// Causes holds the combined constraints that made a logical constraint fail, the ones that failed or, for not and
+	// xone, the ones that held
+	Causes []*ConstraintViolation
 }
 
-func NewConstraintViolation(constraint any, entity *egdm.Entity, violationType ViolationType, message string) *ConstraintViolation {
+func NewConstraintViolation(constraint ConstraintType, entity *egdm.Entity, violationType ViolationType, message string) *ConstraintViolation {
 	violation := &ConstraintViolation{}
 	violation.Constraint = constraint
 	violation.Entity = entity
 	violation.ViolationType = violationType
 	violation.Message = message
+	violation.Severity = DefaultSeverity
+	if constraint != nil {
+		violation.Severity = constraint.GetSeverity()
+	}
 	return violation
 }
 
+// MarshalJSON writes the violation with the ids of the entity and constraint instead of the entities themselves
+func (violation *ConstraintViolation) MarshalJSON() ([]byte, error) {
+	report := struct {
+		Entity        string                 `json:"entity,omitempty"`
+		EntityClass   string                 `json:"entityClass,omitempty"`
+		Constraint    string                 `json:"constraint,omitempty"`
+		ViolationType string                 `json:"violationType"`
+		Severity      string                 `json:"severity"`
+		Message       string                 `json:"message"`
+		Property      string                 `json:"property,omitempty"`
+		Expected      any                    `json:"expected,omitempty"`
+		Actual        any                    `json:"actual,omitempty"`
+		Causes        []*ConstraintViolation `json:"causes,omitempty"`
+	}{
+		EntityClass:   violation.EntityClass,
+		ViolationType: violation.ViolationType.String(),
+		Severity:      violation.Severity.String(),
+		Message:       violation.Message,
+		Property:      violation.Property,
+		Expected:      violation.Expected,
+		Actual:        violation.Actual,
+		Causes:        violation.Causes,
+	}
+	if violation.Entity != nil {
+		report.Entity = violation.Entity.ID
+	}
+	if violation.Constraint != nil {
+		report.Constraint = violation.Constraint.GetID()
+	}
+	return json.Marshal(report)
+}
+
 // ValidateDataset validates the given schema against the data in the named dataset
 func (v *Validator) ValidateDataset(schema *Schema, datasetName string) (ok bool, exceptions []*ConstraintViolation, err error) {
+	schema = v.profiledSchema(schema)
 	exceptions = make([]*ConstraintViolation, 0)
 	ok = true
 	err = nil
@@ -100,18 +196,22 @@ func (v *Validator) ValidateDataset(schema *Schema, datasetName string) (ok bool
 		return false, nil, err
 	}
 
-	// iterate over entities when next is not nil
+	// iterate over entities when next is not nil, validating them in batches so referenced entities can be prefetched
+	batch := make([]*egdm.Entity, 0, v.batchSize())
 	var entity *egdm.Entity
 	entity, err = datasetEntities.Next()
 	for entity != nil {
-		valid, entityExceptions, err := v.ValidateEntity(schema, entity)
-		if err != nil {
-			return false, nil, err
-		}
-
-		if !valid {
-			ok = false
-			exceptions = append(exceptions, entityExceptions...)
+		batch = append(batch, entity)
+		if len(batch) == cap(batch) {
+			valid, batchExceptions, err := v.validateBatch(schema, batch)
+			if err != nil {
+				return false, nil, err
+			}
+			if !valid {
+				ok = false
+			}
+			exceptions = append(exceptions, batchExceptions...)
+			batch = batch[:0]
 		}
 
 		entity, err = datasetEntities.Next()
@@ -120,26 +220,46 @@ func (v *Validator) ValidateDataset(schema *Schema, datasetName string) (ok bool
 		}
 	}
 
+	valid, batchExceptions, err := v.validateBatch(schema, batch)
+	if err != nil {
+		return false, nil, err
+	}
+	if !valid {
+		ok = false
+	}
+	exceptions = append(exceptions, batchExceptions...)
+
 	return
 }
 
 // ValidateSchema validates the given schema against data accessible to this validator
 func (v *Validator) ValidateSchema(schema *Schema) (ok bool, exceptions []*ConstraintViolation, err error) {
+	schema = v.profiledSchema(schema)
 	// get all classes defined in the schema
 	classes := schema.EntityClasses
 	exceptions = make([]*ConstraintViolation, 0)
+	ok = true
 
 	for _, class := range classes {
 		classId := class.Entity.ID
 
 		// get an iterator over all instances of a class
-		instances, err := v.dataProvider.Hop(classId, RDfTypeURI, v.settings.DatasetsContext, true, 5000)
+		instances, err := v.dataProvider.Hop(classId, RDfTypeURI, v.datasetsContext(), true, 5000)
 		entity, err := instances.Next()
 		if err != nil {
 			return false, nil, err
 		}
 
 		for entity != nil {
+			if v.observer != nil {
+				v.observer.ObserveInstance(schema, classId, entity)
+			}
+			for _, violation := range v.checkDeprecations(schema, classId, entity) {
+				if v.isFailure(violation) {
+					ok = false
+				}
+				exceptions = append(exceptions, violation)
+			}
 
 			// get all constraints for this class
 			constraints := schema.GetConstraintsForEntityClass(class.Entity.ID, true)
@@ -150,9 +270,15 @@ func (v *Validator) ValidateSchema(schema *Schema) (ok bool, exceptions []*Const
 					err = constraintError
 					return false, nil, err
 				}
+				if v.observer != nil {
+					v.observer.ObserveCheck(schema, classId, constraint, entity, valid, violation)
+				}
 
 				if !valid && violation != nil {
-					ok = false
+					v.renderMessage(schema, classId, constraint, violation)
+					if v.isFailure(violation) {
+						ok = false
+					}
 					exceptions = append(exceptions, violation)
 				}
 			}
@@ -164,17 +290,50 @@ func (v *Validator) ValidateSchema(schema *Schema) (ok bool, exceptions []*Const
 		}
 	}
 
-	isValid := len(exceptions) == 0
-	return isValid, exceptions, nil
+	return ok, exceptions, nil
 }
 
 // ValidateEntityCollection validates the given entity collection against the given schema
 func (v *Validator) ValidateEntityCollection(schema *Schema, entityCollection *egdm.EntityCollection) (ok bool, exceptions []*ConstraintViolation, err error) {
+	schema = v.profiledSchema(schema)
 	exceptions = make([]*ConstraintViolation, 0)
 	ok = true
 	err = nil
 
-	for _, entity := range entityCollection.Entities {
+	entities := entityCollection.Entities
+	if v.dataProvider == nil {
+		offline := *v
+		offline.localGraph = newLocalGraph(entities)
+		v = &offline
+	}
+	for start := 0; start < len(entities); start += v.batchSize() {
+		end := start + v.batchSize()
+		if end > len(entities) {
+			end = len(entities)
+		}
+
+		valid, batchExceptions, err := v.validateBatch(schema, entities[start:end])
+		if err != nil {
+			return false, nil, err
+		}
+
+		if !valid {
+			ok = false
+		}
+		exceptions = append(exceptions, batchExceptions...)
+	}
+
+	return
+}
+
+// validateBatch validates each entity in the batch after prefetching the entities they reference
+func (v *Validator) validateBatch(schema *Schema, entities []*egdm.Entity) (ok bool, exceptions []*ConstraintViolation, err error) {
+	exceptions = make([]*ConstraintViolation, 0)
+	ok = true
+
+	v.prefetchReferencedEntities(schema, entities)
+
+	for _, entity := range entities {
 		valid, entityExceptions, err := v.ValidateEntity(schema, entity)
 		if err != nil {
 			return false, nil, err
@@ -182,21 +341,81 @@ func (v *Validator) ValidateEntityCollection(schema *Schema, entityCollection *e
 
 		if !valid {
 			ok = false
-			exceptions = append(exceptions, entityExceptions...)
 		}
+		exceptions = append(exceptions, entityExceptions...)
 	}
 
 	return
 }
 
+// prefetchReferencedEntities resolves all entities referenced through reference constraints in one go,
+// so that the per entity checks are served from the resolver cache
+func (v *Validator) prefetchReferencedEntities(schema *Schema, entities []*egdm.Entity) {
+	if v.resolver == nil {
+		return
+	}
+	validateRelated := v.settings != nil && v.settings.ValidateRelated
+
+	ids := make([]string, 0)
+	conceptIds := make(map[string][]string)
+	for _, entity := range entities {
+		for _, class := range makeStringArray(entity.References[RDfTypeURI]) {
+			for _, constraint := range schema.GetConstraintsForEntityClass(class, true) {
+				referenceConstraint, isReferenceConstraint := constraint.(*ReferenceConstraint)
+				if !isReferenceConstraint {
+					continue
+				}
+				propertyURI, err := referenceConstraint.GetConstrainedPropertyClass()
+				if err != nil {
+					continue
+				}
+				refs := makeStringArray(entity.References[propertyURI])
+				if validateRelated {
+					ids = append(ids, refs...)
+				}
+				if _, err := referenceConstraint.GetConceptScheme(); err == nil {
+					dataset := referenceConstraint.GetConceptSchemeDataset()
+					conceptIds[dataset] = append(conceptIds[dataset], refs...)
+				}
+			}
+		}
+	}
+
+	for dataset, refs := range conceptIds {
+		var datasets []string
+		if dataset != "" {
+			datasets = []string{dataset}
+		}
+		v.resolver.Prefetch(refs, datasets)
+	}
+
+	v.resolver.Prefetch(ids, nil)
+}
+
+func (v *Validator) batchSize() int {
+	if v.resolver == nil {
+		return DefaultResolverBatchSize
+	}
+	return v.resolver.BatchSize()
+}
+
 func (v *Validator) ValidateEntity(schema *Schema, entity *egdm.Entity) (ok bool, exceptions []*ConstraintViolation, err error) {
+	schema = v.profiledSchema(schema)
 	exceptions = make([]*ConstraintViolation, 0)
 	ok = true
 	err = nil
 
+	if v.observer != nil {
+		defer func() {
+			if err == nil {
+				v.observer.ObserveEntity(schema, entity, ok, exceptions)
+			}
+		}()
+	}
+
 	// get entity classes
-	classes, ok := entity.References[RDfTypeURI]
-	if !ok {
+	classes, hasTypes := entity.References[RDfTypeURI]
+	if !hasTypes {
 		return
 	}
 
@@ -206,6 +425,16 @@ func (v *Validator) ValidateEntity(schema *Schema, entity *egdm.Entity) (ok bool
 	}
 
 	for _, class := range classArray {
+		if v.observer != nil {
+			v.observer.ObserveInstance(schema, class, entity)
+		}
+		for _, violation := range v.checkDeprecations(schema, class, entity) {
+			if v.isFailure(violation) {
+				ok = false
+			}
+			exceptions = append(exceptions, violation)
+		}
+
 		constraints := schema.GetConstraintsForEntityClass(class, true)
 		for _, constraint := range constraints {
 			// check if constraint is violated
@@ -214,9 +443,15 @@ func (v *Validator) ValidateEntity(schema *Schema, entity *egdm.Entity) (ok bool
 				err = constraintError
 				return
 			}
+			if v.observer != nil {
+				v.observer.ObserveCheck(schema, class, constraint, entity, valid, violation)
+			}
 
 			if !valid && violation != nil {
-				ok = false
+				v.renderMessage(schema, class, constraint, violation)
+				if v.isFailure(violation) {
+					ok = false
+				}
 				exceptions = append(exceptions, violation)
 			}
 		}
@@ -227,23 +462,19 @@ func (v *Validator) ValidateEntity(schema *Schema, entity *egdm.Entity) (ok bool
 
 // CheckConstraint checks if the given constraint is violated for the given entity. Returns false if the constraint is ok
 // and true and a constraint violation struct if not. Error is returned if something went wrong while checking the constraint.
-func (v *Validator) CheckConstraint(schema *Schema, constraint any, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
-	switch c := constraint.(type) {
-	case *ReferenceConstraint:
-		return v.CheckReferenceConstraint(entity, c)
-	case *InverseReferenceConstraint:
-		return v.CheckInverseReferenceConstraint(entity, c)
-	case *PropertyConstraint:
-		return v.CheckPropertyConstraint(entity, c)
-	case *IsAbstractConstraint:
-		// this checks if this entity is an implementation of a EntityClass that is defined as abstract
-		return v.CheckEntityIsAbstractConstraint(schema, entity, c)
+func (v *Validator) CheckConstraint(schema *Schema, constraint ConstraintType, entity *egdm.Entity) (bool, *ConstraintViolation, error) {
+	if constraint == nil {
+		return false, nil, errors.New("constraint type not supported")
 	}
-
-	return false, nil, errors.New("constraint type not supported")
+	valid, violation, err := constraint.Check(v, schema, entity)
+	if violation != nil {
+		// violations of nested constraints are reported with the severity of the constraint that was checked
+		violation.Severity = constraint.GetSeverity()
+	}
+	return valid, violation, err
 }
 
-func (v *Validator) CheckReferenceConstraint(entity *egdm.Entity, constraint *ReferenceConstraint) (bool, *ConstraintViolation, error) {
+func (v *Validator) CheckReferenceConstraint(schema *Schema, entity *egdm.Entity, constraint *ReferenceConstraint) (bool, *ConstraintViolation, error) {
 	propertyURI, err := constraint.GetConstrainedPropertyClass()
 	if err != nil {
 		return false, nil, err
@@ -261,42 +492,25 @@ func (v *Validator) CheckReferenceConstraint(entity *egdm.Entity, constraint *Re
 		case []string:
 			if len(values) < minCard {
 				cv := NewConstraintViolation(constraint, entity, MinReferenceOccurrenceNotMet,
-					fmt.Sprintf("min card is %d but found %d occurrences", minCard, len(values)))
+					fmt.Sprintf("min card is %d but found %d occurrences", minCard, len(values))).WithDetails(propertyURI, minCard, len(values))
 				return false, cv, nil
 			} else if len(values) > maxCard {
 				cv := NewConstraintViolation(constraint, entity, MaxReferenceOccurrenceExceeded,
-					fmt.Sprintf("max card is %d but found %d occurrences", maxCard, len(values)))
+					fmt.Sprintf("max card is %d but found %d occurrences", maxCard, len(values))).WithDetails(propertyURI, maxCard, len(values))
 				return false, cv, nil
 			}
-
-			// if enabled check related entity exists and is of correct type
-			if v.settings.ValidateRelated {
-				if v.dataProvider == nil {
-					return false, nil, errors.New("no data provider configured")
-				}
-
-				for _, ref := range values {
-					allowedReferencedClass, err := constraint.GetAllowedReferencedClass()
-					if err != nil {
-						return false, nil, err
-					}
-					valid, cv, err := v.CheckExistenceAndTypeOfReferencedEntity(ref, allowedReferencedClass)
-					if err != nil {
-						return false, nil, err
-					}
-					if !valid {
-						// this isnt ideal but slightly better than passing these in just to get added to the violation
-						cv.Entity = entity
-						cv.Constraint = constraint
-						return false, cv, nil
-					}
-				}
+			return v.checkReferencedEntities(schema, entity, constraint, values)
+		case string:
+			if minCard > 1 {
+				cv := NewConstraintViolation(constraint, entity, MinReferenceOccurrenceNotMet,
+					fmt.Sprintf("min card is %d but found %d occurrences", minCard, 1)).WithDetails(propertyURI, minCard, 1)
+				return false, cv, nil
 			}
-
+			return v.checkReferencedEntities(schema, entity, constraint, []string{values})
 		default:
 			if minCard > 1 {
 				cv := NewConstraintViolation(constraint, entity, MinReferenceOccurrenceNotMet,
-					fmt.Sprintf("min card is %d but found %d occurrences", minCard, 1))
+					fmt.Sprintf("min card is %d but found %d occurrences", minCard, 1)).WithDetails(propertyURI, minCard, 1)
 				return false, cv, nil
 			}
 		}
@@ -304,7 +518,7 @@ func (v *Validator) CheckReferenceConstraint(entity *egdm.Entity, constraint *Re
 		// check that the property is optional
 		if minCard > 0 {
 			v := NewConstraintViolation(constraint, entity, MinReferenceOccurrenceNotMet,
-				fmt.Sprintf("min card is %d but found %d occurrences", minCard, 0))
+				fmt.Sprintf("min card is %d but found %d occurrences", minCard, 0)).WithDetails(propertyURI, minCard, 0)
 			return false, v, nil
 		}
 	}
@@ -312,52 +526,246 @@ func (v *Validator) CheckReferenceConstraint(entity *egdm.Entity, constraint *Re
 	return true, nil, nil
 }
 
-func (v *Validator) CheckExistenceAndTypeOfReferencedEntity(entityId string, expectedType string) (valid bool, violation *ConstraintViolation, err error) {
+// checkReferencedEntities checks that the references are in the allowed vocabulary and, if enabled, that the
+// referenced entities exist and are of the correct type
+func (v *Validator) checkReferencedEntities(schema *Schema, entity *egdm.Entity, constraint *ReferenceConstraint, refs []string) (bool, *ConstraintViolation, error) {
+	valid, cv, err := v.checkReferenceVocabulary(entity, constraint, refs)
+	if err != nil || !valid {
+		return valid, cv, err
+	}
+
+	if v.settings == nil || !v.settings.ValidateRelated {
+		return true, nil, nil
+	}
+
+	if v.dataProvider == nil {
+		return false, nil, errors.New("no data provider configured")
+	}
+
+	allowedReferencedClass, err := constraint.GetAllowedReferencedClass()
+	if err != nil {
+		return false, nil, err
+	}
+
+	for _, ref := range refs {
+		valid, cv, err := v.CheckExistenceAndTypeOfReferencedEntity(schema, ref, allowedReferencedClass)
+		if err != nil {
+			return false, nil, err
+		}
+		if !valid {
+			// this isnt ideal but slightly better than passing these in just to get added to the violation
+			cv.Entity = entity
+			cv.Constraint = constraint
+			propertyURI, _ := constraint.GetConstrainedPropertyClass()
+			return false, cv.WithDetails(propertyURI, allowedReferencedClass, ref), nil
+		}
+	}
+
+	return true, nil, nil
+}
+
+// checkReferenceVocabulary checks references against the explicit list of allowed ids and the concept scheme of the
+// constraint. The list is checked offline, concept scheme membership is looked up through the data provider.
+func (v *Validator) checkReferenceVocabulary(entity *egdm.Entity, constraint *ReferenceConstraint, refs []string) (bool, *ConstraintViolation, error) {
+	propertyURI, _ := constraint.GetConstrainedPropertyClass()
+	allowed := constraint.GetAllowedReferences()
+	if allowed != nil {
+		for _, ref := range refs {
+			found := false
+			for _, a := range allowed {
+				if a == ref {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false, NewConstraintViolation(constraint, entity, ReferenceNotAllowed,
+					fmt.Sprintf("referenced entity %v is not one of %v", ref, allowed)).WithDetails(propertyURI, allowed, ref), nil
+			}
+		}
+	}
+
+	scheme, err := constraint.GetConceptScheme()
+	if err != nil {
+		return true, nil, nil
+	}
+	if v.dataProvider == nil {
+		return false, nil, errors.Errorf("no data provider configured to look up concept scheme %s", scheme)
+	}
+
+	var datasets []string
+	if dataset := constraint.GetConceptSchemeDataset(); dataset != "" {
+		datasets = []string{dataset}
+	}
+	for _, ref := range refs {
+		member, err := v.isConceptSchemeMember(ref, scheme, datasets)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "concept %v", ref)
+		}
+		if !member {
+			return false, NewConstraintViolation(constraint, entity, ReferenceNotAllowed,
+				fmt.Sprintf("referenced entity %v is not a concept in scheme %v", ref, scheme)).WithDetails(propertyURI, scheme, ref), nil
+		}
+	}
+
+	return true, nil, nil
+}
+
+// isConceptSchemeMember is true if a partial of the concept from one of the datasets is in the scheme or a top concept of it
+func (v *Validator) isConceptSchemeMember(conceptId string, scheme string, datasets []string) (bool, error) {
+	concept, err := v.dataProvider.GetEntity(conceptId, datasets)
+	if err != nil {
+		return false, err
+	}
+	if concept == nil || concept.IsDeleted {
+		return false, nil
+	}
+
+	partials, err := getPartials(concept)
+	if err != nil {
+		return false, err
+	}
+	for _, partial := range partials {
+		if partial.IsDeleted {
+			continue
+		}
+		if dataset, ok := partial.Properties[CoreDatasetURI].(string); ok && len(datasets) > 0 && dataset != datasets[0] {
+			continue
+		}
+		for _, reference := range []string{SKOSinScheme, SKOStopConceptOf} {
+			schemes, _ := partial.GetReferenceValues(reference)
+			for _, s := range schemes {
+				if s == scheme {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// CheckExistenceAndTypeOfReferencedEntity checks that the referenced entity exists and that it is an instance of the expected
+// class or of one of its subclasses. The types of all partials from datasets in context are taken into account.
+func (v *Validator) CheckExistenceAndTypeOfReferencedEntity(schema *Schema, entityId string, expectedType string) (valid bool, violation *ConstraintViolation, err error) {
 	entity, err := v.dataProvider.GetEntity(entityId, nil)
 	if err != nil {
 		return false, nil, err
 	}
 
-	if entity == nil {
-		return false, NewConstraintViolation(nil, nil, ReferenceNotFound, fmt.Sprintf("related entity with id %v", entityId)), nil
+	if entity == nil || entity.IsDeleted {
+		return false, NewConstraintViolation(nil, nil, ReferenceNotFound, fmt.Sprintf("referenced entity %v was not found", entityId)), nil
+	}
+
+	found, entityTypes, err := v.resolveReferencedEntityTypes(entity)
+	if err != nil {
+		return false, nil, errors.Wrapf(err, "referenced entity %v", entityId)
+	}
+
+	if !found {
+		return false, NewConstraintViolation(nil, nil, ReferenceNotFound, fmt.Sprintf("referenced entity %v was not found in the datasets in context", entityId)), nil
 	}
 
-	// entity is partials so need to look at each one and check the dataset it belongs to and then if correct check the type
-	partials := entity.Properties["http://data.mimiro.io/core/partials"]
-	if partials == nil {
-		return false, nil, errors.New("no partials found")
+	if !schema.IsInstanceOfClass(entityTypes, expectedType) {
+		return false, NewConstraintViolation(nil, nil, ReferenceTypeMismatch, fmt.Sprintf("expected type %v but found %v", expectedType, entityTypes)), nil
 	}
 
-	// iterate over partials and check if the dataset is correct
-	if partialsArray, ok := partials.([]*egdm.Entity); ok {
-		for _, partial := range partialsArray {
-			entityDataset := partial.Properties["http://data.mimiro.io/core/dataset"].(string)
-			if v.isDatasetInContext(entityDataset) {
-				// check type
-				entityType := partial.Properties["http://www.w3.org/1999/02/22-rdf-syntax-ns#type"].(string)
-				if entityType == expectedType {
-					return true, nil, nil
-				} else {
-					return false, NewConstraintViolation(nil, nil, ReferenceTypeMismatch, fmt.Sprintf("expected type %v but found %v", expectedType, entityType)), nil
+	return true, nil, nil
+}
+
+// resolveReferencedEntityTypes merges the rdf types of all partials that belong to a dataset in context. Found is false
+// when there are no such partials. An entity without partials is treated as a single partial without a dataset.
+func (v *Validator) resolveReferencedEntityTypes(entity *egdm.Entity) (found bool, types []string, err error) {
+	partials, err := getPartials(entity)
+	if err != nil {
+		return false, nil, err
+	}
+
+	types = make([]string, 0)
+	seen := make(map[string]bool)
+	for _, partial := range partials {
+		if partial.IsDeleted {
+			continue
+		}
+
+		dataset := ""
+		if value, ok := partial.Properties[CoreDatasetURI]; ok {
+			dataset, ok = value.(string)
+			if !ok {
+				return false, nil, errors.Wrapf(ErrUnexpectedEntityShape, "dataset of partial is %T, expected a string", value)
+			}
+		}
+		if !v.isDatasetInContext(dataset) {
+			continue
+		}
+		found = true
+
+		// egdm puts rdf type in the references, but accept it as a property as well
+		for _, value := range []any{partial.References[RDfTypeURI], partial.Properties[RDfTypeURI]} {
+			if value == nil {
+				continue
+			}
+			partialTypes, ok := toStringArray(value)
+			if !ok {
+				return false, nil, errors.Wrapf(ErrUnexpectedEntityShape, "rdf type of partial is %T, expected string or list of strings", value)
+			}
+			for _, t := range partialTypes {
+				if !seen[t] {
+					seen[t] = true
+					types = append(types, t)
 				}
 			}
 		}
 	}
 
-	return false, NewConstraintViolation(nil, nil, ReferenceNotFound, fmt.Sprintf("related entity with id %v", entityId)), nil
+	return found, types, nil
+}
+
+// getPartials returns the partials of an entity looked up without partial merging
+func getPartials(entity *egdm.Entity) ([]*egdm.Entity, error) {
+	value, ok := entity.Properties[CorePartialsURI]
+	if !ok || value == nil {
+		return []*egdm.Entity{entity}, nil
+	}
+
+	switch partials := value.(type) {
+	case []*egdm.Entity:
+		return partials, nil
+	case *egdm.Entity:
+		return []*egdm.Entity{partials}, nil
+	case []any:
+		result := make([]*egdm.Entity, 0, len(partials))
+		for _, p := range partials {
+			partial, ok := p.(*egdm.Entity)
+			if !ok || partial == nil {
+				return nil, errors.Wrapf(ErrUnexpectedEntityShape, "partial is %T, expected an entity", p)
+			}
+			result = append(result, partial)
+		}
+		return result, nil
+	default:
+		return nil, errors.Wrapf(ErrUnexpectedEntityShape, "partials are %T, expected a list of entities", value)
+	}
+}
+
+// datasetsContext returns the datasets in context, nil means every dataset is in context
+func (v *Validator) datasetsContext() []string {
+	if v.settings == nil {
+		return nil
+	}
+	return v.settings.DatasetsContext
 }
 
 func (v *Validator) isDatasetInContext(dataset string) bool {
-	if v.settings.DatasetsContext == nil {
+	datasets := v.datasetsContext()
+	if datasets == nil {
 		return true
-	} else {
-		for _, ds := range v.settings.DatasetsContext {
-			if ds == dataset {
-				return true
-			}
+	}
+	for _, ds := range datasets {
+		if ds == dataset {
+			return true
 		}
-		return false
 	}
+	return false
 }
 
 func (v *Validator) CheckInverseReferenceConstraint(entity *egdm.Entity, constraint *InverseReferenceConstraint) (bool, *ConstraintViolation, error) {
@@ -382,27 +790,28 @@ func (v *Validator) CheckPropertyConstraint(entity *egdm.Entity, constraint *Pro
 		case []any:
 			if len(values) < minCard {
 				cv := NewConstraintViolation(constraint, entity, MinPropertyOccurrenceNotMet,
-					fmt.Sprintf("min card is %d but found %d occurrences", minCard, len(values)))
+					fmt.Sprintf("min card is %d but found %d occurrences", minCard, len(values))).WithDetails(propertyURI, minCard, len(values))
 				return false, cv, nil
 			} else if len(values) > maxCard {
 				cv := NewConstraintViolation(constraint, entity, MaxPropertyOccurrenceExceeded,
-					fmt.Sprintf("max card is %d but found %d occurrences", maxCard, len(values)))
+					fmt.Sprintf("max card is %d but found %d occurrences", maxCard, len(values))).WithDetails(propertyURI, maxCard, len(values))
 				return false, cv, nil
 			}
 		default:
 			if minCard > 1 {
 				cv := NewConstraintViolation(constraint, entity, MinPropertyOccurrenceNotMet,
-					fmt.Sprintf("min card is %d but found %d occurrences", minCard, 1))
+					fmt.Sprintf("min card is %d but found %d occurrences", minCard, 1)).WithDetails(propertyURI, minCard, 1)
 				return false, cv, nil
 			}
 		}
 
-		// todo: check value data type and also value pattern if specified
+		// todo: check value data type
+		return v.checkPropertyValues(entity, constraint, toValueArray(value))
 	} else {
 		// check that the property is optional
 		if minCard > 0 {
 			v := NewConstraintViolation(constraint, entity, MinPropertyOccurrenceNotMet,
-				fmt.Sprintf("min card is %d but found %d occurrences", minCard, 0))
+				fmt.Sprintf("min card is %d but found %d occurrences", minCard, 0)).WithDetails(propertyURI, minCard, 0)
 			return false, v, nil
 		}
 	}
@@ -410,6 +819,63 @@ func (v *Validator) CheckPropertyConstraint(entity *egdm.Entity, constraint *Pro
 	return true, nil, nil
 }
 
+// checkPropertyValues checks each value against the pattern, range, length and allowed values of the constraint
+func (v *Validator) checkPropertyValues(entity *egdm.Entity, constraint *PropertyConstraint, values []any) (bool, *ConstraintViolation, error) {
+	vc, err := constraint.GetValueConstraint()
+	if err != nil {
+		return false, nil, err
+	}
+	if vc.IsEmpty() {
+		return true, nil, nil
+	}
+	propertyURI, _ := constraint.GetConstrainedPropertyClass()
+
+	for _, value := range values {
+		lexical := fmt.Sprint(value)
+
+		if vc.Pattern != nil && !vc.Pattern.MatchString(lexical) {
+			return false, NewConstraintViolation(constraint, entity, ValuePatternMismatch,
+				fmt.Sprintf("value %v does not match pattern %s", value, vc.Pattern.String())).WithDetails(propertyURI, vc.Pattern.String(), value), nil
+		}
+
+		if vc.MinLength >= 0 && utf8.RuneCountInString(lexical) < vc.MinLength {
+			return false, NewConstraintViolation(constraint, entity, MinLengthNotMet,
+				fmt.Sprintf("min length is %d but value %v has length %d", vc.MinLength, value, utf8.RuneCountInString(lexical))).WithDetails(propertyURI, vc.MinLength, value), nil
+		}
+		if vc.MaxLength >= 0 && utf8.RuneCountInString(lexical) > vc.MaxLength {
+			return false, NewConstraintViolation(constraint, entity, MaxLengthExceeded,
+				fmt.Sprintf("max length is %d but value %v has length %d", vc.MaxLength, value, utf8.RuneCountInString(lexical))).WithDetails(propertyURI, vc.MaxLength, value), nil
+		}
+
+		if vc.MinInclusive != nil || vc.MinExclusive != nil || vc.MaxInclusive != nil || vc.MaxExclusive != nil {
+			number, isNumber := toFloat(value)
+			if vc.MinInclusive != nil && (!isNumber || number < *vc.MinInclusive) {
+				return false, NewConstraintViolation(constraint, entity, MinValueNotMet,
+					fmt.Sprintf("min inclusive is %v but found value %v", *vc.MinInclusive, value)).WithDetails(propertyURI, *vc.MinInclusive, value), nil
+			}
+			if vc.MinExclusive != nil && (!isNumber || number <= *vc.MinExclusive) {
+				return false, NewConstraintViolation(constraint, entity, MinValueNotMet,
+					fmt.Sprintf("min exclusive is %v but found value %v", *vc.MinExclusive, value)).WithDetails(propertyURI, *vc.MinExclusive, value), nil
+			}
+			if vc.MaxInclusive != nil && (!isNumber || number > *vc.MaxInclusive) {
+				return false, NewConstraintViolation(constraint, entity, MaxValueExceeded,
+					fmt.Sprintf("max inclusive is %v but found value %v", *vc.MaxInclusive, value)).WithDetails(propertyURI, *vc.MaxInclusive, value), nil
+			}
+			if vc.MaxExclusive != nil && (!isNumber || number >= *vc.MaxExclusive) {
+				return false, NewConstraintViolation(constraint, entity, MaxValueExceeded,
+					fmt.Sprintf("max exclusive is %v but found value %v", *vc.MaxExclusive, value)).WithDetails(propertyURI, *vc.MaxExclusive, value), nil
+			}
+		}
+
+		if len(vc.AllowedValues) > 0 && !containsValue(vc.AllowedValues, value) {
+			return false, NewConstraintViolation(constraint, entity, ValueNotAllowed,
+				fmt.Sprintf("value %v is not one of %v", value, vc.AllowedValues)).WithDetails(propertyURI, vc.AllowedValues, value), nil
+		}
+	}
+
+	return true, nil, nil
+}
+
 func (v *Validator) CheckEntityIsAbstractConstraint(schema *Schema, entity *egdm.Entity, constraint *IsAbstractConstraint) (bool, *ConstraintViolation, error) {
 	// get the rdf type of the entity provided
 	classes, ok := entity.References[RDfTypeURI]
@@ -446,7 +912,7 @@ func (v *Validator) CheckGlobalIsAbstractConstraint(constraint *IsAbstractConstr
 	}
 
 	// use a limit of 1 as we only want to know if there are any instances
-	instances, err := v.dataProvider.Hop(abstractType, RDfTypeURI, v.settings.DatasetsContext, true, 1)
+	instances, err := v.dataProvider.Hop(abstractType, RDfTypeURI, v.datasetsContext(), true, 1)
 	if err != nil {
 		return false, nil, err
 	}
@@ -464,6 +930,82 @@ func (v *Validator) CheckGlobalIsAbstractConstraint(constraint *IsAbstractConstr
 	return true, nil, nil
 }
 
+// toValueArray returns the values of a single or multi valued property
+func toValueArray(val any) []any {
+	switch v := val.(type) {
+	case nil:
+		return []any{}
+	case []any:
+		return v
+	case []string:
+		res := make([]any, len(v))
+		for i, s := range v {
+			res[i] = s
+		}
+		return res
+	default:
+		return []any{v}
+	}
+}
+
+// toFloat converts numeric values, strings are not treated as numbers
+func toFloat(val any) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// containsValue compares numbers by value and everything else by its string form
+func containsValue(values []any, value any) bool {
+	number, isNumber := toFloat(value)
+	for _, candidate := range values {
+		if candidateNumber, candidateIsNumber := toFloat(candidate); isNumber && candidateIsNumber {
+			if candidateNumber == number {
+				return true
+			}
+		} else if !isNumber && !candidateIsNumber && fmt.Sprint(candidate) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// toStringArray converts a single or multi valued string value, returning false for any other shape
+func toStringArray(val any) ([]string, bool) {
+	switch v := val.(type) {
+	case []string:
+		return v, true
+	case string:
+		return []string{v}, true
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			res = append(res, s)
+		}
+		return res, true
+	default:
+		return nil, false
+	}
+}
+
 func makeStringArray(val interface{}) []string {
 	switch v := val.(type) {
 	case []string:
@@ -2,10 +2,12 @@ package egcl
 
 import (
 	"context"
+	"errors"
 	dh "github.com/mimiro-io/datahub"
 	"github.com/mimiro-io/datahub-client-sdk-go"
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -161,6 +163,310 @@ func TestValidationOfRemoteDataset(t *testing.T) {
 	}
 }
 
+const orgSchemaYaml = `
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:OrgUnit
+
+- id: model:Person
+  superclasses:
+    - model:OrgUnit
+
+- id: model:Document
+  referenceConstraints:
+    - referenceClass: model:owner
+      referencedEntityClass: model:OrgUnit
+`
+
+// newPartialsEntity builds an entity shaped like a datahub lookup result with unmerged partials
+func newPartialsEntity(id string, partials ...*egdm.Entity) *egdm.Entity {
+	entity := egdm.NewEntity().SetID(id)
+	entity.SetProperty("http://data.mimiro.io/core/partials", partials)
+	return entity
+}
+
+func newPartial(id string, dataset string, types any) *egdm.Entity {
+	partial := egdm.NewEntity().SetID(id)
+	partial.SetProperty("http://data.mimiro.io/core/dataset", dataset)
+	partial.SetReference(RDfTypeURI, types)
+	return partial
+}
+
+func TestValidateRelatedAcceptsSubclasses(t *testing.T) {
+	schema, err := parseYaml([]byte(orgSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	provider := newCountingDataProvider(
+		newPartialsEntity("http://data.mimiro.io/people/homer",
+			newPartial("http://data.mimiro.io/people/homer", "people", "http://data.mimiro.io/amodel/Person")),
+		newPartialsEntity("http://data.mimiro.io/people/multi",
+			newPartial("http://data.mimiro.io/people/multi", "people", []string{"http://data.mimiro.io/amodel/Other", "http://data.mimiro.io/amodel/Person"})),
+		newPartialsEntity("http://data.mimiro.io/things/doc",
+			newPartial("http://data.mimiro.io/things/doc", "things", "http://data.mimiro.io/amodel/Document")),
+	)
+	v := NewValidator().WithSettings(&ValidatorSettings{ValidateRelated: true}).WithDataProvider(provider)
+
+	document := func(owner string) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/d1")
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Document")
+		e.SetReference("http://data.mimiro.io/amodel/owner", []string{owner})
+		return e
+	}
+
+	for _, owner := range []string{"http://data.mimiro.io/people/homer", "http://data.mimiro.io/people/multi"} {
+		ok, violations, err := v.ValidateEntity(schema, document(owner))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || len(violations) != 0 {
+			t.Errorf("expected reference to %s to be valid, got %v", owner, violations)
+		}
+	}
+
+	ok, violations, err := v.ValidateEntity(schema, document("http://data.mimiro.io/things/doc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok || len(violations) != 1 || violations[0].ViolationType != ReferenceTypeMismatch {
+		t.Errorf("expected a reference type mismatch, got %v", violations)
+	}
+}
+
+func TestReferencedEntityPartials(t *testing.T) {
+	schema, err := parseYaml([]byte(orgSchemaYaml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lookup result as returned by the datahub query api with partial merging disabled
+	lookupResult := `[
+		{ "id" : "@context", "namespaces" : { "people" : "http://data.mimiro.io/people/", "model" : "http://data.mimiro.io/amodel/",
+			"rdf" : "http://www.w3.org/1999/02/22-rdf-syntax-ns#", "core" : "http://data.mimiro.io/core/" } },
+		{ "id" : "people:marge", "props" : { "core:partials" : [
+			{ "id" : "people:marge", "refs" : { "rdf:type" : "model:Other" }, "props" : { "core:dataset" : "crm" } },
+			{ "id" : "people:marge", "refs" : { "rdf:type" : [ "model:Person" ] }, "props" : { "core:dataset" : "hr" } }
+		] } }
+	]`
+	parsed, err := newParser().LoadEntityCollection(strings.NewReader(lookupResult))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	propertyTyped := newPartial("http://data.mimiro.io/people/lisa", "hr", nil)
+	delete(propertyTyped.References, RDfTypeURI)
+	propertyTyped.SetProperty(RDfTypeURI, []any{"http://data.mimiro.io/amodel/Person"})
+
+	provider := newCountingDataProvider(
+		parsed.Entities[0],
+		newPartialsEntity("http://data.mimiro.io/people/lisa", propertyTyped),
+		newPartialsEntity("http://data.mimiro.io/people/bad-dataset", egdm.NewEntity().SetProperty(CoreDatasetURI, 42)),
+		newPartialsEntity("http://data.mimiro.io/people/bad-type",
+			newPartial("http://data.mimiro.io/people/bad-type", "hr", map[string]any{"id": "model:Person"})),
+		egdm.NewEntity().SetID("http://data.mimiro.io/people/bad-partials").SetProperty(CorePartialsURI, "nope"),
+	)
+
+	check := func(datasets []string, id string) (bool, *ConstraintViolation, error) {
+		v := NewValidator().WithSettings(&ValidatorSettings{ValidateRelated: true, DatasetsContext: datasets}).WithDataProvider(provider)
+		return v.CheckExistenceAndTypeOfReferencedEntity(schema, id, "http://data.mimiro.io/amodel/OrgUnit")
+	}
+
+	valid, violation, err := check(nil, "http://data.mimiro.io/people/marge")
+	if err != nil || !valid {
+		t.Errorf("expected types to be merged across partials, got %v %v", violation, err)
+	}
+
+	valid, violation, err = check([]string{"hr"}, "http://data.mimiro.io/people/lisa")
+	if err != nil || !valid {
+		t.Errorf("expected rdf type property to be accepted, got %v %v", violation, err)
+	}
+
+	valid, violation, err = check([]string{"crm"}, "http://data.mimiro.io/people/marge")
+	if err != nil || valid || violation.ViolationType != ReferenceTypeMismatch {
+		t.Errorf("expected only the crm partial to be considered, got %v %v", violation, err)
+	}
+
+	valid, violation, err = check([]string{"other"}, "http://data.mimiro.io/people/marge")
+	if err != nil || valid || violation.ViolationType != ReferenceNotFound {
+		t.Fatalf("expected entity outside dataset context to be not found, got %v %v", violation, err)
+	}
+	if violation.Message != "referenced entity http://data.mimiro.io/people/marge was not found in the datasets in context" {
+		t.Errorf("unexpected message %q", violation.Message)
+	}
+
+	for _, id := range []string{"http://data.mimiro.io/people/bad-dataset", "http://data.mimiro.io/people/bad-type", "http://data.mimiro.io/people/bad-partials"} {
+		_, _, err = check(nil, id)
+		if !errors.Is(err, ErrUnexpectedEntityShape) {
+			t.Errorf("expected unexpected shape error for %s, got %v", id, err)
+		}
+	}
+}
+
+func TestPropertyValueConstraints(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Asset
+  propertyConstraints:
+    - propertyClass: model:status
+      in: [active, retired]
+    - propertyClass: model:code
+      pattern: "^[A-Z]{3}-[0-9]+$"
+      minLength: 5
+      maxLength: 8
+    - propertyClass: model:weight
+      minExclusive: 0
+      maxInclusive: 1000.5
+    - propertyClass: model:rating
+      minInclusive: 1
+      maxExclusive: 6
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{})
+	cases := []struct {
+		property  string
+		value     any
+		violation ViolationType
+	}{
+		{"status", "active", -1},
+		{"status", []any{"active", "retired"}, -1},
+		{"status", "deleted", ValueNotAllowed},
+		{"status", 1, ValueNotAllowed},
+		{"code", "ABC-12", -1},
+		{"code", "abc-12", ValuePatternMismatch},
+		{"code", "ABC-1", -1},
+		{"code", "AB-1", ValuePatternMismatch},
+		{"code", "ABC-12345", MaxLengthExceeded},
+		{"weight", 0.5, -1},
+		{"weight", 1000.5, -1},
+		{"weight", 0, MinValueNotMet},
+		{"weight", 1001, MaxValueExceeded},
+		{"weight", "heavy", MinValueNotMet},
+		{"rating", 1, -1},
+		{"rating", []any{5.9, 2}, -1},
+		{"rating", []any{3, 6}, MaxValueExceeded},
+		{"rating", 0.9, MinValueNotMet},
+	}
+
+	for _, c := range cases {
+		entity := egdm.NewEntity().SetID("http://data.mimiro.io/things/asset")
+		entity.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Asset")
+		entity.SetProperty("http://data.mimiro.io/amodel/"+c.property, c.value)
+
+		ok, violations, err := v.ValidateEntity(schema, entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.violation == -1 {
+			if !ok {
+				t.Errorf("expected %s %v to be valid, got %v", c.property, c.value, violations[0].Message)
+			}
+		} else if ok || len(violations) != 1 || violations[0].ViolationType != c.violation {
+			t.Errorf("expected %s %v to give violation %v, got %v", c.property, c.value, c.violation, violations)
+		}
+	}
+}
+
+func TestReferenceVocabularyConstraints(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    iso: http://data.mimiro.io/iso/
+    status: http://data.mimiro.io/status/
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Site
+  referenceConstraints:
+    - referenceClass: model:country
+      in: [iso:NO, iso:SE]
+    - referenceClass: model:status
+      conceptScheme: status:scheme
+      conceptSchemeDataset: codes
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	concept := func(id string, dataset string, scheme string, reference string) *egdm.Entity {
+		partial := egdm.NewEntity().SetID(id)
+		partial.SetProperty(CoreDatasetURI, dataset)
+		partial.SetReference(reference, scheme)
+		return newPartialsEntity(id, partial)
+	}
+	provider := &batchingDataProvider{newCountingDataProvider(
+		concept("http://data.mimiro.io/status/active", "codes", "http://data.mimiro.io/status/scheme", SKOSinScheme),
+		concept("http://data.mimiro.io/status/retired", "codes", "http://data.mimiro.io/status/scheme", SKOStopConceptOf),
+		concept("http://data.mimiro.io/status/other", "codes", "http://data.mimiro.io/status/otherScheme", SKOSinScheme),
+		concept("http://data.mimiro.io/status/elsewhere", "people", "http://data.mimiro.io/status/scheme", SKOSinScheme),
+	)}
+
+	site := func(country string, status string) *egdm.Entity {
+		e := egdm.NewEntity().SetID("http://data.mimiro.io/things/site")
+		e.SetReference(RDfTypeURI, "http://data.mimiro.io/amodel/Site")
+		e.SetReference("http://data.mimiro.io/amodel/country", country)
+		if status != "" {
+			e.SetReference("http://data.mimiro.io/amodel/status", []string{"http://data.mimiro.io/status/" + status})
+		}
+		return e
+	}
+
+	// the explicit list is checked without a data provider
+	offline := NewValidator().WithSettings(&ValidatorSettings{})
+	ok, _, err := offline.ValidateEntity(schema, site("http://data.mimiro.io/iso/NO", ""))
+	if err != nil || !ok {
+		t.Errorf("expected listed country to be valid, got %v", err)
+	}
+	ok, violations, err := offline.ValidateEntity(schema, site("http://data.mimiro.io/iso/DK", ""))
+	if err != nil || ok || violations[0].ViolationType != ReferenceNotAllowed {
+		t.Errorf("expected unlisted country to be rejected, got %v %v", violations, err)
+	}
+	_, _, err = offline.ValidateEntity(schema, site("http://data.mimiro.io/iso/NO", "active"))
+	if err == nil {
+		t.Error("expected concept scheme lookup without data provider to fail")
+	}
+
+	v := NewValidator().WithSettings(&ValidatorSettings{}).WithDataProvider(provider)
+	for status, expected := range map[string]bool{"active": true, "retired": true, "other": false, "elsewhere": false, "missing": false} {
+		ok, violations, err := v.ValidateEntity(schema, site("http://data.mimiro.io/iso/SE", status))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != expected {
+			t.Errorf("expected status %s valid to be %v, got %v", status, expected, violations)
+		}
+		if !ok && violations[0].ViolationType != ReferenceNotAllowed {
+			t.Errorf("expected reference not allowed for status %s, got %v", status, violations[0].ViolationType)
+		}
+	}
+
+	// concept lookups of a collection are batched
+	provider.batchCalls = 0
+	ec := egdm.NewEntityCollection(nil)
+	_ = ec.AddEntity(site("http://data.mimiro.io/iso/SE", "active"))
+	_ = ec.AddEntity(site("http://data.mimiro.io/iso/SE", "unknown"))
+	_ = ec.AddEntity(site("http://data.mimiro.io/iso/SE", "unknown2"))
+	if _, _, err := v.ValidateEntityCollection(schema, ec); err != nil {
+		t.Fatal(err)
+	}
+	if provider.batchCalls != 1 || provider.getCalls != 0 {
+		t.Errorf("expected one batch lookup of concepts, got %d batch and %d single", provider.batchCalls, provider.getCalls)
+	}
+}
+
 func StartTestDatahub(location string, port string) (*dh.DatahubInstance, error) {
 
 	cfg, err := dh.LoadConfig("")
@@ -2,11 +2,24 @@ package egcl
 
 import (
 	"fmt"
+	"hash/fnv"
+	"sort"
+
 	egdm "github.com/mimiro-io/entity-graph-data-model"
 	"gopkg.in/yaml.v3"
 )
 
 func parseYaml(data []byte) (*Schema, error) {
+	ec, err := parseYamlEntities("", data)
+	if err != nil {
+		return nil, err
+	}
+	return newCheckedSchema(ec, DefaultConstraintRegistry)
+}
+
+// parseYamlEntities turns the YAML shorthand into EGCL entities with expanded identifiers. The location of the document,
+// when known, is part of the generated constraint ids, so that the constraints of imported documents do not collide.
+func parseYamlEntities(location string, data []byte) (*egdm.EntityCollection, error) {
 	yamlSchema := make([]map[string]any, 0)
 	err := yaml.Unmarshal(data, &yamlSchema)
 	if err != nil {
@@ -26,7 +39,18 @@ func parseYaml(data []byte) (*Schema, error) {
 		nsm.StorePrefixExpansionMapping(key, value.(string))
 	}
 
-	constraintCount := 0
+	schemaEntity, err := newYamlSchemaEntity(yamlSchema[0])
+	if err != nil {
+		return nil, err
+	}
+	if schemaEntity != nil {
+		err := ec.AddEntity(schemaEntity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	constraintIds := newYamlConstraintIds(location)
 
 	yamlClasses := yamlSchema[1:]
 	for _, classData := range yamlClasses {
@@ -42,11 +66,18 @@ func parseYaml(data []byte) (*Schema, error) {
 		}
 		entityClass.SetID(id.(string))
 
-		for key, value := range classData {
+		// constraints are numbered in the order of the keys, which must not depend on the order of the map
+		keys := make([]string, 0, len(classData))
+		for key := range classData {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := classData[key]
 			switch key {
 			case "isAbstract":
 				abstractConstraint := egdm.NewEntity()
-				abstractConstraint.SetID(fmt.Sprintf("%s-constraint-%d", entityClass.ID, constraintCount))
+				abstractConstraint.SetID(constraintIds.next(entityClass.ID))
 				abstractConstraint.SetReference("rdf:type", "egcl:IsAbstractConstraint")
 				abstractConstraint.SetReference("egcl:entityClass", entityClass.ID)
 				// add to constraints
@@ -54,7 +85,6 @@ func parseYaml(data []byte) (*Schema, error) {
 				if err != nil {
 					return nil, err
 				}
-				constraintCount++
 			case "superclasses":
 				superClasses := make([]string, 0)
 				for _, v := range value.([]interface{}) {
@@ -65,6 +95,14 @@ func parseYaml(data []byte) (*Schema, error) {
 				entityClass.SetProperty("egcl:label", value.(string))
 			case "description":
 				entityClass.SetProperty("egcl:description", value.(string))
+			case "deprecated":
+				deprecated, ok := value.(bool)
+				if !ok {
+					return nil, fmt.Errorf("error deprecated of %s must be true or false", entityClass.ID)
+				}
+				entityClass.SetProperty("egcl:deprecated", deprecated)
+			case "replacedBy":
+				entityClass.SetReference("egcl:replacedBy", value.(string))
 			case "refs":
 				for k, v := range value.(map[interface{}]interface{}) {
 					entityClass.SetReference(k.(string), v.(string))
@@ -75,55 +113,153 @@ func parseYaml(data []byte) (*Schema, error) {
 				}
 			case "propertyConstraints":
 				for _, v := range value.([]any) {
-					propConstraint := egdm.NewEntity()
-					propConstraint.SetID(fmt.Sprintf("%s-constraint-%d", entityClass.ID, constraintCount))
-					propConstraint.SetReference("rdf:type", "egcl:PropertyConstraint")
+					propConstraint := newYamlPropertyConstraint(constraintIds.next(entityClass.ID), v.(map[string]any))
 					propConstraint.SetReference("egcl:entityClass", entityClass.ID)
-					constraintCount++
+
+					err := ec.AddEntity(propConstraint)
+					if err != nil {
+						return nil, err
+					}
+				}
+			case "referenceConstraints":
+				for _, v := range value.([]any) {
+					refConstraint := newYamlReferenceConstraint(constraintIds.next(entityClass.ID), v.(map[string]any))
+					refConstraint.SetReference("egcl:entityClass", entityClass.ID)
+
+					err := ec.AddEntity(refConstraint)
+					if err != nil {
+						return nil, err
+					}
+				}
+			case "comparisonConstraints":
+				for _, v := range value.([]any) {
+					comparison := egdm.NewEntity()
+					comparison.SetID(constraintIds.next(entityClass.ID))
+					comparison.SetReference("rdf:type", "egcl:PropertyComparisonConstraint")
+					comparison.SetReference("egcl:entityClass", entityClass.ID)
+
 					for k, val := range v.(map[string]any) {
 						switch k {
 						case "propertyClass":
-							propConstraint.SetReference("egcl:propertyClass", val.(string))
-						case "datatype":
-							propConstraint.SetProperty("egcl:datatype", val.(string))
-						case "minCard":
-							propConstraint.SetProperty("egcl:minCard", val.(int))
-						case "maxCard":
-							propConstraint.SetProperty("egcl:maxCard", val.(int))
+							comparison.SetReference("egcl:propertyClass", val.(string))
+						case "otherPropertyClass":
+							comparison.SetReference("egcl:otherPropertyClass", val.(string))
+						case "operator":
+							comparison.SetProperty("egcl:operator", val.(string))
 						}
 					}
+					setYamlConstraintMetadata(comparison, v.(map[string]any))
 
-					err := ec.AddEntity(propConstraint)
+					err := ec.AddEntity(comparison)
 					if err != nil {
 						return nil, err
 					}
 				}
-			case "referenceConstraints":
+			case "pathConstraints":
 				for _, v := range value.([]any) {
-					refConstraint := egdm.NewEntity()
-					refConstraint.SetID(fmt.Sprintf("%s-constraint-%d", entityClass.ID, constraintCount))
-					refConstraint.SetReference("rdf:type", "egcl:ReferenceConstraint")
-					refConstraint.SetReference("egcl:entityClass", entityClass.ID)
-					constraintCount++
+					pathConstraint := egdm.NewEntity()
+					pathConstraint.SetID(constraintIds.next(entityClass.ID))
+					pathConstraint.SetReference("rdf:type", "egcl:PathConstraint")
+					pathConstraint.SetReference("egcl:entityClass", entityClass.ID)
+
 					for k, val := range v.(map[string]any) {
 						switch k {
-						case "referenceClass":
-							refConstraint.SetReference("egcl:referenceClass", val.(string))
+						case "path", "otherPath", "operator":
+							// paths keep their prefixed names, they are expanded with the schema namespaces when parsed
+							pathConstraint.SetProperty("egcl:"+k, val.(string))
+						case "minCard", "maxCard":
+							card, ok := val.(int)
+							if !ok {
+								return nil, fmt.Errorf("error %s of path constraint %s must be an integer", k, pathConstraint.ID)
+							}
+							pathConstraint.SetProperty("egcl:"+k, card)
 						case "referencedEntityClass":
-							refConstraint.SetReference("egcl:referencedEntityClass", val.(string))
-						case "minCard":
-							refConstraint.SetProperty("egcl:minCard", val.(int))
-						case "maxCard":
-							refConstraint.SetProperty("egcl:maxCard", val.(int))
-						case "inverseReferenceClass":
-							refConstraint.SetReference("egcl:inverseReferenceClass", val.(string))
-						case "inverseMinCard":
-							refConstraint.SetProperty("egcl:inverseMinCard", val.(int))
-						case "inverseMaxCard":
-							refConstraint.SetProperty("egcl:inverseMaxCard", val.(int))
+							pathConstraint.SetReference("egcl:referencedEntityClass", val.(string))
 						}
 					}
-					err := ec.AddEntity(refConstraint)
+					setYamlConstraintMetadata(pathConstraint, v.(map[string]any))
+
+					err := ec.AddEntity(pathConstraint)
+					if err != nil {
+						return nil, err
+					}
+				}
+			case "logicalConstraints":
+				for _, v := range value.([]any) {
+					logical, err := newYamlLogicalConstraint(ec, entityClass.ID, constraintIds, v.(map[string]any))
+					if err != nil {
+						return nil, err
+					}
+					logical.SetReference("egcl:entityClass", entityClass.ID)
+
+					err = ec.AddEntity(logical)
+					if err != nil {
+						return nil, err
+					}
+				}
+			case "conditionalConstraints":
+				for _, v := range value.([]any) {
+					conditional := egdm.NewEntity()
+					conditional.SetID(constraintIds.next(entityClass.ID))
+					conditional.SetReference("rdf:type", "egcl:ConditionalConstraint")
+					conditional.SetReference("egcl:entityClass", entityClass.ID)
+
+					conditionalData := v.(map[string]any)
+					setYamlConstraintMetadata(conditional, conditionalData)
+					if condition, ok := conditionalData["if"].(map[string]any); ok {
+						for k, val := range condition {
+							switch k {
+							case "propertyClass":
+								conditional.SetReference("egcl:ifPropertyClass", val.(string))
+							case "referenceClass":
+								conditional.SetReference("egcl:ifReferenceClass", val.(string))
+							case "equals":
+								if _, isReference := condition["referenceClass"]; isReference {
+									conditional.SetReference("egcl:ifValue", val.(string))
+								} else {
+									conditional.SetProperty("egcl:ifValue", val)
+								}
+							case "in":
+								if _, isReference := condition["referenceClass"]; isReference {
+									values := make([]string, 0)
+									for _, a := range val.([]any) {
+										values = append(values, a.(string))
+									}
+									conditional.SetReference("egcl:ifValue", values)
+								} else {
+									conditional.SetProperty("egcl:ifValue", val.([]any))
+								}
+							}
+						}
+					}
+
+					// nested constraints have no entity class, they are only checked through the conditional constraint
+					nested := make([]string, 0)
+					if then, ok := conditionalData["then"].(map[string]any); ok {
+						if propertyConstraints, ok := then["propertyConstraints"].([]any); ok {
+							for _, pc := range propertyConstraints {
+								propConstraint := newYamlPropertyConstraint(constraintIds.next(entityClass.ID), pc.(map[string]any))
+								nested = append(nested, propConstraint.ID)
+								err := ec.AddEntity(propConstraint)
+								if err != nil {
+									return nil, err
+								}
+							}
+						}
+						if referenceConstraints, ok := then["referenceConstraints"].([]any); ok {
+							for _, rc := range referenceConstraints {
+								refConstraint := newYamlReferenceConstraint(constraintIds.next(entityClass.ID), rc.(map[string]any))
+								nested = append(nested, refConstraint.ID)
+								err := ec.AddEntity(refConstraint)
+								if err != nil {
+									return nil, err
+								}
+							}
+						}
+					}
+					conditional.SetReference("egcl:then", nested)
+
+					err := ec.AddEntity(conditional)
 					if err != nil {
 						return nil, err
 					}
@@ -138,11 +274,280 @@ func parseYaml(data []byte) (*Schema, error) {
 		}
 	}
 
+	for _, entity := range ec.Entities {
+		if severity, err := entity.GetFirstReferenceValue("egcl:severity"); err == nil && !isSeverityURI(severity) {
+			return nil, fmt.Errorf("error constraint %s has unknown severity %s", entity.ID, severity)
+		}
+	}
+
 	// expand prefixes
 	err = ec.ExpandNamespacePrefixes()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewSchema(ec), nil
+	return ec, nil
+}
+
+func newYamlPropertyConstraint(id string, data map[string]any) *egdm.Entity {
+	propConstraint := egdm.NewEntity()
+	propConstraint.SetID(id)
+	propConstraint.SetReference("rdf:type", "egcl:PropertyConstraint")
+	for k, val := range data {
+		switch k {
+		case "propertyClass":
+			propConstraint.SetReference("egcl:propertyClass", val.(string))
+		case "datatype":
+			propConstraint.SetReference("egcl:datatype", val.(string))
+		case "minCard":
+			propConstraint.SetProperty("egcl:minCard", val.(int))
+		case "maxCard":
+			propConstraint.SetProperty("egcl:maxCard", val.(int))
+		case "pattern":
+			propConstraint.SetProperty("egcl:pattern", val.(string))
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			propConstraint.SetProperty("egcl:"+k, val)
+		case "minLength", "maxLength":
+			propConstraint.SetProperty("egcl:"+k, val.(int))
+		case "in":
+			propConstraint.SetProperty("egcl:in", val.([]any))
+		}
+	}
+	setYamlConstraintMetadata(propConstraint, data)
+	return propConstraint
+}
+
+func newYamlReferenceConstraint(id string, data map[string]any) *egdm.Entity {
+	refConstraint := egdm.NewEntity()
+	refConstraint.SetID(id)
+	refConstraint.SetReference("rdf:type", "egcl:ReferenceConstraint")
+	for k, val := range data {
+		switch k {
+		case "referenceClass":
+			refConstraint.SetReference("egcl:referenceClass", val.(string))
+		case "referencedEntityClass":
+			refConstraint.SetReference("egcl:referencedEntityClass", val.(string))
+		case "minCard":
+			refConstraint.SetProperty("egcl:minCard", val.(int))
+		case "maxCard":
+			refConstraint.SetProperty("egcl:maxCard", val.(int))
+		case "inverseReferenceClass":
+			refConstraint.SetReference("egcl:inverseReferenceClass", val.(string))
+		case "inverseMinCard":
+			refConstraint.SetProperty("egcl:inverseMinCard", val.(int))
+		case "inverseMaxCard":
+			refConstraint.SetProperty("egcl:inverseMaxCard", val.(int))
+		case "in":
+			allowed := make([]string, 0)
+			for _, a := range val.([]any) {
+				allowed = append(allowed, a.(string))
+			}
+			refConstraint.SetReference("egcl:in", allowed)
+		case "conceptScheme":
+			refConstraint.SetReference("egcl:conceptScheme", val.(string))
+		case "conceptSchemeDataset":
+			refConstraint.SetProperty("egcl:conceptSchemeDataset", val.(string))
+		}
+	}
+	setYamlConstraintMetadata(refConstraint, data)
+	return refConstraint
+}
+
+var yamlLogicalConstraintTypes = map[string]string{
+	"and":  "egcl:AndConstraint",
+	"or":   "egcl:OrConstraint",
+	"xone": "egcl:XoneConstraint",
+	"not":  "egcl:NotConstraint",
+}
+
+// yamlConstraintIds numbers the constraints of a YAML document, which have no ids of their own
+type yamlConstraintIds struct {
+	document string
+	count    int
+}
+
+// newYamlConstraintIds identifies the document by a hash of its location, as the location itself may not be usable in
+// an id. Documents without a location number their constraints without it.
+func newYamlConstraintIds(location string) *yamlConstraintIds {
+	ids := &yamlConstraintIds{}
+	if location != "" {
+		hash := fnv.New32a()
+		hash.Write([]byte(location))
+		ids.document = fmt.Sprintf("%08x-", hash.Sum32())
+	}
+	return ids
+}
+
+// next returns the id of the next constraint of the class
+func (ids *yamlConstraintIds) next(classId string) string {
+	id := fmt.Sprintf("%s-constraint-%s%d", classId, ids.document, ids.count)
+	ids.count++
+	return id
+}
+
+// newYamlLogicalConstraint creates a logical constraint from a map with one of the keys and, or, xone or not. The combined
+// constraints, which can be property, reference or logical constraints, are added to the collection.
+func newYamlLogicalConstraint(ec *egdm.EntityCollection, classId string, constraintIds *yamlConstraintIds, data map[string]any) (*egdm.Entity, error) {
+	logical := egdm.NewEntity()
+	logical.SetID(constraintIds.next(classId))
+
+	setYamlConstraintMetadata(logical, data)
+
+	for _, operator := range []string{"and", "or", "xone", "not"} {
+		value, ok := data[operator]
+		if !ok {
+			continue
+		}
+		logical.SetReference("rdf:type", yamlLogicalConstraintTypes[operator])
+
+		// not can be given a single constraint instead of a list
+		branches, isList := value.([]any)
+		if !isList {
+			branches = []any{value}
+		}
+
+		members := make([]string, 0)
+		for _, b := range branches {
+			branch, ok := b.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("error %s in %s must list constraints", operator, classId)
+			}
+
+			var member *egdm.Entity
+			if _, ok := branch["propertyClass"]; ok {
+				member = newYamlPropertyConstraint(constraintIds.next(classId), branch)
+			} else if _, ok := branch["referenceClass"]; ok {
+				member = newYamlReferenceConstraint(constraintIds.next(classId), branch)
+			} else {
+				var err error
+				member, err = newYamlLogicalConstraint(ec, classId, constraintIds, branch)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			err := ec.AddEntity(member)
+			if err != nil {
+				return nil, err
+			}
+			members = append(members, member.ID)
+		}
+		logical.SetReference("egcl:constraints", members)
+		return logical, nil
+	}
+
+	return nil, fmt.Errorf("error logical constraint in %s needs one of and, or, xone or not", classId)
+}
+
+// setYamlConstraintMetadata sets the id, deactivated, tags, deprecated, replacedBy, severity and message keys shared by all
+// kinds of constraints.
+// The id replaces the generated one so that profiles can refer to the constraint. The message is a string, or a map from
+// language to string.
+func setYamlConstraintMetadata(constraint *egdm.Entity, data map[string]any) {
+	if id, ok := data["id"].(string); ok {
+		constraint.SetID(id)
+	}
+	if deactivated, ok := data["deactivated"].(bool); ok {
+		constraint.SetProperty("egcl:deactivated", deactivated)
+	}
+	switch tags := data["tags"].(type) {
+	case string:
+		constraint.SetProperty("egcl:tag", []any{tags})
+	case []any:
+		constraint.SetProperty("egcl:tag", tags)
+	}
+
+	if deprecated, ok := data["deprecated"].(bool); ok {
+		constraint.SetProperty("egcl:deprecated", deprecated)
+	}
+	if replacement, ok := data["replacedBy"].(string); ok {
+		constraint.SetReference("egcl:replacedBy", replacement)
+	}
+	if severity, ok := data["severity"]; ok {
+		constraint.SetReference("egcl:severity", yamlSeverity(severity))
+	}
+
+	switch message := data["message"].(type) {
+	case string:
+		constraint.SetProperty("egcl:message", message)
+	case map[string]any:
+		languages := make([]string, 0, len(message))
+		for language := range message {
+			languages = append(languages, language)
+		}
+		sort.Strings(languages)
+		variants := make([]any, 0, len(message))
+		for _, language := range languages {
+			variant := egdm.NewEntity()
+			variant.SetProperty(EGCLlanguage, language)
+			variant.SetProperty(EGCLtext, fmt.Sprint(message[language]))
+			variants = append(variants, variant)
+		}
+		constraint.SetProperty("egcl:message", variants)
+	}
+}
+
+// yamlSeverity maps info, warning and violation to the egcl severities, anything else is kept to be reported as unknown
+func yamlSeverity(val any) string {
+	name := fmt.Sprint(val)
+	if severity, err := ParseSeverity(name); err == nil {
+		return severity.URI()
+	}
+	return name
+}
+
+// newYamlSchemaEntity creates the egcl:Schema entity from the metadata and imports in the YAML context, or returns nil
+// if there are none. The identifiers are full URIs as the context need not declare the egcl and rdf prefixes.
+func newYamlSchemaEntity(context map[string]any) (*egdm.Entity, error) {
+	schemaEntity := egdm.NewEntity().SetID(DefaultSchemaEntityId)
+	schemaEntity.SetReference(RDfTypeURI, EGCLSchema)
+	hasMetadata := false
+
+	for key, value := range context {
+		switch key {
+		case "imports":
+			switch imports := value.(type) {
+			case string:
+				schemaEntity.SetProperty(EGCLimports, []any{imports})
+			case []any:
+				schemaEntity.SetProperty(EGCLimports, imports)
+			default:
+				return nil, fmt.Errorf("error imports must be a location or a list of locations")
+			}
+		case "baseURI":
+			schemaEntity.SetID(fmt.Sprint(value))
+			schemaEntity.SetProperty(EGCLbaseURI, fmt.Sprint(value))
+		case "version":
+			schemaEntity.SetProperty(EGCLversion, fmt.Sprint(value))
+		case "title":
+			schemaEntity.SetProperty(EGCLtitle, fmt.Sprint(value))
+		case "description":
+			schemaEntity.SetProperty(EGCLDescription, fmt.Sprint(value))
+		case "owners":
+			switch owners := value.(type) {
+			case string:
+				schemaEntity.SetProperty(EGCLowner, []any{owners})
+			case []any:
+				schemaEntity.SetProperty(EGCLowner, owners)
+			}
+		case "deprecated":
+			deprecated, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("error deprecated must be true or false")
+			}
+			schemaEntity.SetProperty(EGCLdeprecated, deprecated)
+		case "deprecationDate":
+			schemaEntity.SetProperty(EGCLdeprecationDate, yamlDate(value))
+		case "removalDate":
+			schemaEntity.SetProperty(EGCLremovalDate, yamlDate(value))
+		default:
+			continue
+		}
+		hasMetadata = true
+	}
+
+	if !hasMetadata {
+		return nil, nil
+	}
+	return schemaEntity, nil
 }
@@ -1,7 +1,9 @@
 package egcl
 
 import (
+	"fmt"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -36,3 +38,83 @@ func TestParseYAML(t *testing.T) {
 		t.Errorf("expected schema to have 4 constraints, got %d", len(schema.Constraints))
 	}
 }
+
+func TestParseYAMLDatatype(t *testing.T) {
+	schema, err := parseYaml([]byte(`
+- id: "@context"
+  namespaces:
+    model: http://data.mimiro.io/amodel/
+    xsd: http://www.w3.org/2001/XMLSchema#
+    rdf: http://www.w3.org/1999/02/22-rdf-syntax-ns#
+    egcl: http://data.mimiro.io/egcl/
+
+- id: model:Person
+  propertyConstraints:
+    - propertyClass: model:name
+      datatype: xsd:string
+    - propertyClass: model:nickname
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datatypes := make(map[string]string)
+	for _, constraint := range schema.Constraints {
+		if propertyConstraint, ok := constraint.(*PropertyConstraint); ok {
+			property, _ := propertyConstraint.GetConstrainedPropertyClass()
+			datatypes[property] = propertyConstraint.GetDataType()
+		}
+	}
+
+	// the datatype is a reference, so that its prefix is expanded like in JSON-LD schemas
+	if datatype := datatypes["http://data.mimiro.io/amodel/name"]; datatype != "http://www.w3.org/2001/XMLSchema#string" {
+		t.Errorf("expected expanded xsd:string datatype, got %s", datatype)
+	}
+	if datatype := datatypes["http://data.mimiro.io/amodel/nickname"]; datatype != EGCLAny {
+		t.Errorf("expected any datatype when none is given, got %s", datatype)
+	}
+}
+
+func TestParseYAMLConstraintIdsAreStable(t *testing.T) {
+	document := []byte(contactSchemaYaml + `
+- id: model:Employee
+  isAbstract: true
+  propertyConstraints:
+    - propertyClass: model:employeeNumber
+      minCard: 1
+  referenceConstraints:
+    - referenceClass: model:worksFor
+      maxCard: 1
+  conditionalConstraints:
+    - if:
+        propertyClass: model:status
+        equals: retired
+      then:
+        propertyConstraints:
+          - propertyClass: model:retiredDate
+            minCard: 1
+`)
+
+	constraintIds := func() map[string]string {
+		ec, err := parseYamlEntities("schemas/contact.yaml", document)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := make(map[string]string)
+		for _, entity := range ec.Entities {
+			if isOfType(entity, EGCLEntityClass) {
+				continue
+			}
+			description := fmt.Sprintf("%v %v", entity.References, entity.Properties)
+			ids[entity.ID] = description
+		}
+		return ids
+	}
+
+	expected := constraintIds()
+	for i := 0; i < 30; i++ {
+		if ids := constraintIds(); !reflect.DeepEqual(ids, expected) {
+			t.Fatalf("expected the same constraint ids on every parse, got %v and %v", expected, ids)
+		}
+	}
+}